@@ -2,349 +2,7408 @@ package main
 
 import (
 	"bufio"
+	"bytes"
+	"cmp"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	crand "crypto/rand"
+	"crypto/tls"
+	"embed"
+	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
+	"flag"
 	"fmt"
+	"hash/maphash"
+	"io"
+	"io/fs"
 	"log"
+	"math"
 	"math/rand"
 	"net/http"
+	"net/url"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"regexp"
+	"runtime/debug"
+	"slices"
+	"sort"
 	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
 	"github.com/go-chi/cors"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/crypto/bcrypt"
 )
 
 // ==== Data Models ====
 
+// ID identifies a board, list, card, label, rule, snapshot or template. With
+// the default numeric strategy IDs are decimal numbers and are written to
+// JSON as numbers, as they always have been; with KANBAN_ID_STRATEGY=uuid new
+// IDs are UUIDs and are written as strings. Either form is read back, so a
+// store can hold both. The empty ID means "none".
+type ID string
+
+// idStrategy is KANBAN_ID_STRATEGY: "numeric" or "uuid".
+var idStrategy = "numeric"
+
+// newID returns a fresh ID in the configured strategy. Numeric IDs are
+// nanosecond timestamps with a little jitter against collisions; UUIDs are
+// version 7, which also sort by creation time.
+func newID() ID {
+	if idStrategy == "uuid" {
+		return newUUID()
+	}
+	return ID(strconv.FormatInt(time.Now().UnixNano()+int64(rand.Intn(1000)), 10))
+}
+
+func newUUID() ID {
+	var u [16]byte
+	_, _ = crand.Read(u[6:])
+	ms := time.Now().UnixMilli()
+	for i := 5; i >= 0; i-- {
+		u[i] = byte(ms)
+		ms >>= 8
+	}
+	u[6] = u[6]&0x0f | 0x70 // version 7
+	u[8] = u[8]&0x3f | 0x80 // RFC 9562 variant
+	h := hex.EncodeToString(u[:])
+	return ID(h[:8] + "-" + h[8:12] + "-" + h[12:16] + "-" + h[16:20] + "-" + h[20:])
+}
+
+// numeric reports whether id is a positive decimal that fits an int64.
+func (id ID) numeric() bool {
+	n, err := strconv.ParseInt(string(id), 10, 64)
+	return err == nil && n > 0 && strconv.FormatInt(n, 10) == string(id)
+}
+
+// timestamp is when id was created, as encoded in it: the nanoseconds of a
+// numeric ID, the milliseconds of a version 7 UUID. Zero for other IDs.
+func (id ID) timestamp() time.Time {
+	if id.numeric() {
+		n, _ := strconv.ParseInt(string(id), 10, 64)
+		return time.Unix(0, n)
+	}
+	h := strings.ReplaceAll(string(id), "-", "")
+	if len(h) != 32 || h[12] != '7' {
+		return time.Time{}
+	}
+	ms, err := strconv.ParseInt(h[:12], 16, 64)
+	if err != nil {
+		return time.Time{}
+	}
+	return time.UnixMilli(ms)
+}
+
+// compareIDs orders IDs by the creation time encoded in them, so numeric
+// and UUID IDs interleave correctly, then by their text.
+func compareIDs(a, b ID) int {
+	return cmp.Or(a.timestamp().Compare(b.timestamp()), strings.Compare(string(a), string(b)))
+}
+
+func (id ID) MarshalJSON() ([]byte, error) {
+	switch {
+	case id == "":
+		return []byte("0"), nil // as the numeric zero value always read
+	case id.numeric():
+		return []byte(id), nil
+	}
+	return json.Marshal(string(id))
+}
+
+func (id *ID) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		return nil
+	}
+	if len(data) > 0 && data[0] == '"' {
+		var s string
+		if err := json.Unmarshal(data, &s); err != nil {
+			return err
+		}
+		*id = parseID(s)
+		return nil
+	}
+	n, err := strconv.ParseInt(string(data), 10, 64)
+	if err != nil {
+		return fmt.Errorf("id must be a number or a string, not %s", data)
+	}
+	*id = ""
+	if n != 0 {
+		*id = ID(strconv.FormatInt(n, 10))
+	}
+	return nil
+}
+
 type Board struct {
-	ID     int64  `json:"id"`
+	ID     ID     `json:"id"`
 	Title  string `json:"title"`
+	Slug   string `json:"slug,omitempty"` // usable in place of the id in URLs; stable across renames
 	Lists  []List `json:"lists"`
 	Events int64  `json:"events"` // monotonically increasing event id
+	Closed bool   `json:"closed"` // finished boards: hidden from listBoards, read-only
+	// DefaultDueDays gives new cards without a due date one N days out; 0 = none.
+	DefaultDueDays int `json:"defaultDueDays,omitempty"`
+	// DefaultListID receives quick-added cards; 0 means the first list.
+	DefaultListID ID `json:"defaultListId,omitempty"`
+	// LastActivityAt is bumped by every read and mutation; see janitor.
+	LastActivityAt time.Time  `json:"lastActivityAt"`
+	Labels         []Label    `json:"labels,omitempty"`
+	Fields         []FieldDef `json:"fields,omitempty"` // custom field definitions
+	Rules          []Rule     `json:"rules,omitempty"`  // automation, see Rule
+	// Archive holds cards taken off the board but kept for reference.
+	Archive []Card `json:"archive,omitempty"`
+	// AutoColorFromLabel colors cards after their first (primary) label
+	// unless the card has an explicit color.
+	AutoColorFromLabel bool     `json:"autoColorFromLabel,omitempty"`
+	Tags               []string `json:"tags,omitempty"` // free-form grouping, see listBoards
+	// ClientID is an optional client-generated UUID that makes creation
+	// idempotent (see Store.clientIDs).
+	ClientID string `json:"clientId,omitempty"`
+	// Flow accumulates, per list id, how long cards stayed before leaving.
+	Flow map[ID]*FlowStat `json:"flow,omitempty"`
+	// Protected boards need a password or unlock token; the hash itself is
+	// kept out of the board (see Store.passwords).
+	Protected bool `json:"protected,omitempty"`
+	// Theme is presentation only; the server stores and returns it.
+	Theme *Theme `json:"theme,omitempty"`
+	// WatchMentions makes users @mentioned in a card description watchers.
+	WatchMentions bool `json:"watchMentions,omitempty"`
+	// Prefix and Card.Number make human-friendly references like "PROJ-42".
+	Prefix         string `json:"prefix,omitempty"`
+	NextCardNumber int    `json:"nextCardNumber"` // never reused, see nextCardNumber
+	// MoveHook, when set, must approve moves between lists; see vetMove.
+	MoveHook *MoveHook `json:"moveHook,omitempty"`
+}
+
+// BoardSnapshot is a named restore point for a board: a deep copy taken at
+// CreatedAt. Snapshots are kept in the data file beside the boards, not in
+// them, so they don't weigh on board responses.
+type BoardSnapshot struct {
+	ID        ID        `json:"id"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"createdAt"`
+	Board     *Board    `json:"board"`
+}
+
+// maxSnapshots caps restore points per board; the oldest go first.
+const maxSnapshots = 20
+
+// MoveHook is an external validation service for card moves. FailOpen
+// allows moves while it is unreachable; by default they are refused.
+type MoveHook struct {
+	URL      string `json:"url"`
+	FailOpen bool   `json:"failOpen,omitempty"`
+}
+
+// Theme lets multi-board UIs tell boards apart.
+type Theme struct {
+	PrimaryColor string `json:"primaryColor,omitempty"` // #rgb or #rrggbb
+	AccentColor  string `json:"accentColor,omitempty"`
+	Icon         string `json:"icon,omitempty"` // a single emoji
+}
+
+// FieldDef defines a board-scoped custom field. Type is one of text, number,
+// date (RFC 3339) or select (value must be one of Options).
+type FieldDef struct {
+	Name    string   `json:"name"`
+	Type    string   `json:"type"`
+	Options []string `json:"options,omitempty"`
+}
+
+// Rule is a board automation rule. Types:
+//   - "on-complete-move-to": a card marked done moves to ListID
+//   - "on-due-passed-add-label": an open card past its due date gets LabelID
+type Rule struct {
+	ID      ID     `json:"id"`
+	Type    string `json:"type"`
+	ListID  ID     `json:"listId,omitempty"`
+	LabelID ID     `json:"labelId,omitempty"`
+}
+
+type Label struct {
+	ID    ID     `json:"id"`
+	Name  string `json:"name"`
+	Color string `json:"color"`
 }
 
 type List struct {
-	ID       int64  `json:"id"`
+	ID       ID     `json:"id"`
 	Title    string `json:"title"`
 	Position int    `json:"position"`
 	Cards    []Card `json:"cards"`
+	// CardTemplate pre-fills cards created in this list (e.g. a bug report form).
+	CardTemplate *CardTemplate `json:"cardTemplate,omitempty"`
+	// MaxVisible caps how many cards getBoard returns in Cards; the rest are
+	// returned in OverflowCards. Display only: creation is never blocked.
+	MaxVisible    int    `json:"maxVisible,omitempty"`
+	OverflowCards []Card `json:"overflowCards,omitempty"` // response-only, never stored
+}
+
+type CardTemplate struct {
+	Description string   `json:"description,omitempty"`
+	Checklist   []string `json:"checklist,omitempty"`
 }
 
 type Card struct {
-	ID          int64      `json:"id"`
-	Title       string     `json:"title"`
-	Description string     `json:"description"`
-	Position    int        `json:"position"`
-	Due         *time.Time `json:"due,omitempty"`
+	ID                   ID              `json:"id"`
+	Title                string          `json:"title"`
+	Description          string          `json:"description"`
+	Position             int             `json:"position"`
+	Rank                 float64         `json:"rank"` // ordering key within the list; Position follows it
+	Due                  *time.Time      `json:"due,omitempty"`
+	Start                *time.Time      `json:"start,omitempty"`
+	EstimateHours        float64         `json:"estimateHours,omitempty"`
+	Checklist            []ChecklistItem `json:"checklist,omitempty"`
+	DescriptionTruncated bool            `json:"descriptionTruncated,omitempty"`
+	Number               int             `json:"number,omitempty"`    // per-board sequence, see Board.Prefix
+	Labels               []ID            `json:"labels,omitempty"`    // label ids; the first is primary
+	Assignees            []string        `json:"assignees,omitempty"` // user names
+	Watchers             []string        `json:"watchers,omitempty"`  // added by @mentions, see Board.WatchMentions
+	CoverURL             string          `json:"coverUrl,omitempty"`  // http(s) image shown as the card cover
+	Color                string          `json:"color,omitempty"`
+	// ColorFromLabel marks Color as auto-assigned (safe to recompute).
+	ColorFromLabel bool           `json:"colorFromLabel,omitempty"`
+	Done           bool           `json:"done"`
+	CompletedAt    *time.Time     `json:"completedAt,omitempty"`
+	CustomFields   map[string]any `json:"customFields,omitempty"`
+	ArchivedAt     *time.Time     `json:"archivedAt,omitempty"`
+	ArchivedFrom   ID             `json:"archivedFrom,omitempty"` // list id, set while in Board.Archive
+	Blocks         []ID           `json:"blocks,omitempty"`       // cards waiting on this one
+	BlockedBy      []ID           `json:"blockedBy,omitempty"`    // cards this one waits on
+	TimeLogs       []TimeLog      `json:"timeLogs,omitempty"`
+	TotalMinutes   int            `json:"totalMinutes"`
+	CreatedAt      time.Time      `json:"createdAt"`
+	UpdatedAt      time.Time      `json:"updatedAt"`     // last edit or move
+	ListEnteredAt  time.Time      `json:"listEnteredAt"` // arrival in the current list
+	// AgeSeconds and IdleSeconds are derived from the timestamps above in
+	// board responses; they are never stored.
+	AgeSeconds  int64 `json:"ageSeconds,omitempty"`
+	IdleSeconds int64 `json:"idleSeconds,omitempty"`
+	// DescriptionExcerpt and HasMoreDescription stand in for Description
+	// with getBoard?descriptions=excerpt; also response-only.
+	DescriptionExcerpt string `json:"descriptionExcerpt,omitempty"`
+	HasMoreDescription bool   `json:"hasMoreDescription,omitempty"`
+}
+
+// FlowStat sums the completed stays of cards in one list.
+type FlowStat struct {
+	Cards   int   `json:"cards"`
+	Seconds int64 `json:"seconds"`
+}
+
+type ChecklistItem struct {
+	Text string `json:"text"`
+	Done bool   `json:"done"`
+}
+
+type TimeLog struct {
+	User     string    `json:"user"`
+	Minutes  int       `json:"minutes"`
+	Note     string    `json:"note"`
+	LoggedAt time.Time `json:"loggedAt"`
+}
+
+// SharedTemplate is a server-wide card template any board can instantiate.
+// Labels are matched by name against the target board's labels.
+type SharedTemplate struct {
+	ID          ID       `json:"id"`
+	Title       string   `json:"title"`
+	Description string   `json:"description,omitempty"`
+	Labels      []string `json:"labels,omitempty"`
+	Checklist   []string `json:"checklist,omitempty"`
+}
+
+// ==== Configuration ====
+
+// Config holds every server option. LoadConfig fills it from the
+// environment and command-line flags; unset variables keep the defaults
+// from DefaultConfig. The variable for each field is noted beside it.
+type Config struct {
+	Addr     string // listen address (":8080")
+	DataPath string // KANBAN_DATA
+	Persist  bool   // KANBAN_PERSIST; false keeps everything in memory
+	Pretty   bool   // KANBAN_PRETTY; indent the data file
+	Strict   bool   // -strict; refuse to start on a corrupt data file
+	// EncryptionKey is a base64 AES key for the data file
+	// (KANBAN_ENCRYPTION_KEY).
+	EncryptionKey string
+	SaveTimeout   time.Duration // KANBAN_SAVE_TIMEOUT; 0 waits forever
+	WAL           bool          // KANBAN_WAL; see "Write-ahead log"
+
+	ServeUI bool // KANBAN_SERVE_UI; serve the bundled web UI at /app
+
+	IDStrategy string // KANBAN_ID_STRATEGY: "numeric" or "uuid"; see ID
+
+	MoveHookTimeout time.Duration // KANBAN_MOVE_HOOK_TIMEOUT; see Board.MoveHook
+	// MoveHookAllow lists the URL prefixes board move hooks may point at
+	// (KANBAN_MOVE_HOOK_ALLOW, comma-separated). Empty disables move hooks.
+	MoveHookAllow []string
+
+	MaxDescription  int // KANBAN_MAX_DESCRIPTION, characters; 0 = no limit
+	ExcerptLength   int // KANBAN_DESCRIPTION_EXCERPT, characters
+	DueMinYear      int // KANBAN_DUE_MIN_YEAR; refuse due dates before it; 0 = no bound
+	DueMaxYears     int // KANBAN_DUE_MAX_YEARS; refuse due dates further ahead; 0 = no bound
+	MaxBatch        int // KANBAN_MAX_BATCH, ids per batch request; 0 = no limit
+	StreamThreshold int // KANBAN_STREAM_THRESHOLD, bytes
+
+	EventLogSize   int           // KANBAN_SSE_REPLAY
+	SSEBuffer      int           // KANBAN_SSE_BUFFER, events per connection
+	SSEMax         int           // KANBAN_SSE_MAX; 0 = no limit
+	SSEMaxPerBoard int           // KANBAN_SSE_MAX_PER_BOARD; 0 = no limit
+	CoalesceMax    int           // KANBAN_SSE_COALESCE; 0 = off
+	CoalesceWindow time.Duration // KANBAN_SSE_COALESCE_WINDOW
+
+	JanitorDays   int  // KANBAN_JANITOR_DAYS; 0 = off
+	JanitorDryRun bool // KANBAN_JANITOR_DRY_RUN
+
+	AdminToken string // KANBAN_ADMIN_TOKEN; empty disables /admin
+
+	ReadTimeout  time.Duration // KANBAN_READ_TIMEOUT; 0 = none
+	WriteTimeout time.Duration // KANBAN_WRITE_TIMEOUT
+	IdleTimeout  time.Duration // KANBAN_IDLE_TIMEOUT
+	TLSCert      string        // -cert or KANBAN_TLS_CERT
+	TLSKey       string        // -key or KANBAN_TLS_KEY
+
+	// OTLPEndpoint receives traces: OTEL_EXPORTER_OTLP_TRACES_ENDPOINT, or
+	// OTEL_EXPORTER_OTLP_ENDPOINT + "/v1/traces". Empty disables tracing.
+	OTLPEndpoint string
+	ServiceName  string // OTEL_SERVICE_NAME
+}
+
+// DefaultConfig returns the settings used when nothing is configured.
+func DefaultConfig() Config {
+	return Config{
+		Addr:            ":8080",
+		DataPath:        "./data/kanban.json",
+		Persist:         true,
+		Pretty:          true,
+		IDStrategy:      "numeric",
+		SaveTimeout:     10 * time.Second,
+		MoveHookTimeout: 3 * time.Second,
+		MaxDescription:  10000,
+		ExcerptLength:   200,
+		MaxBatch:        500,
+		StreamThreshold: 1 << 20,
+		EventLogSize:    500,
+		SSEBuffer:       16,
+		CoalesceWindow:  time.Second,
+		ReadTimeout:     15 * time.Second,
+		WriteTimeout:    30 * time.Second,
+		IdleTimeout:     120 * time.Second,
+		ServiceName:     "kanban-lite",
+	}
+}
+
+// LoadConfig reads flags from args (without the program name) and the
+// environment through getenv, and validates the result. All problems are
+// reported together.
+func LoadConfig(args []string, getenv func(string) string) (Config, error) {
+	cfg := DefaultConfig()
+	var errs []error
+	str := func(name string, dst *string) {
+		if v := getenv(name); v != "" {
+			*dst = v
+		}
+	}
+	boolean := func(name string, dst *bool) {
+		if v := getenv(name); v != "" {
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %q is not a boolean", name, v))
+				return
+			}
+			*dst = b
+		}
+	}
+	integer := func(name string, min int, dst *int) {
+		if v := getenv(name); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < min {
+				errs = append(errs, fmt.Errorf("%s: %q must be an integer >= %d", name, v, min))
+				return
+			}
+			*dst = n
+		}
+	}
+	duration := func(name string, dst *time.Duration) {
+		if v := getenv(name); v != "" {
+			d, err := time.ParseDuration(v)
+			if err != nil || d < 0 {
+				errs = append(errs, fmt.Errorf("%s: %q is not a duration such as 30s or 2m", name, v))
+				return
+			}
+			*dst = d
+		}
+	}
+
+	str("KANBAN_DATA", &cfg.DataPath)
+	boolean("KANBAN_PERSIST", &cfg.Persist)
+	boolean("KANBAN_PRETTY", &cfg.Pretty)
+	str("KANBAN_ENCRYPTION_KEY", &cfg.EncryptionKey)
+	duration("KANBAN_SAVE_TIMEOUT", &cfg.SaveTimeout)
+	boolean("KANBAN_WAL", &cfg.WAL)
+	boolean("KANBAN_SERVE_UI", &cfg.ServeUI)
+	str("KANBAN_ID_STRATEGY", &cfg.IDStrategy)
+	duration("KANBAN_MOVE_HOOK_TIMEOUT", &cfg.MoveHookTimeout)
+	if v := getenv("KANBAN_MOVE_HOOK_ALLOW"); v != "" {
+		for _, prefix := range strings.Split(v, ",") {
+			prefix = strings.TrimSpace(prefix)
+			if p, err := url.Parse(prefix); err != nil || (p.Scheme != "http" && p.Scheme != "https") || p.Host == "" {
+				errs = append(errs, fmt.Errorf("KANBAN_MOVE_HOOK_ALLOW: %q is not an absolute http(s) URL", prefix))
+				continue
+			}
+			cfg.MoveHookAllow = append(cfg.MoveHookAllow, prefix)
+		}
+	}
+	integer("KANBAN_MAX_DESCRIPTION", 0, &cfg.MaxDescription)
+	integer("KANBAN_DESCRIPTION_EXCERPT", 1, &cfg.ExcerptLength)
+	integer("KANBAN_DUE_MIN_YEAR", 0, &cfg.DueMinYear)
+	integer("KANBAN_DUE_MAX_YEARS", 0, &cfg.DueMaxYears)
+	integer("KANBAN_MAX_BATCH", 0, &cfg.MaxBatch)
+	integer("KANBAN_STREAM_THRESHOLD", 0, &cfg.StreamThreshold)
+	integer("KANBAN_SSE_REPLAY", 1, &cfg.EventLogSize)
+	integer("KANBAN_SSE_BUFFER", 1, &cfg.SSEBuffer)
+	integer("KANBAN_SSE_MAX", 0, &cfg.SSEMax)
+	integer("KANBAN_SSE_MAX_PER_BOARD", 0, &cfg.SSEMaxPerBoard)
+	integer("KANBAN_SSE_COALESCE", 0, &cfg.CoalesceMax)
+	duration("KANBAN_SSE_COALESCE_WINDOW", &cfg.CoalesceWindow)
+	integer("KANBAN_JANITOR_DAYS", 0, &cfg.JanitorDays)
+	boolean("KANBAN_JANITOR_DRY_RUN", &cfg.JanitorDryRun)
+	str("KANBAN_ADMIN_TOKEN", &cfg.AdminToken)
+	duration("KANBAN_READ_TIMEOUT", &cfg.ReadTimeout)
+	duration("KANBAN_WRITE_TIMEOUT", &cfg.WriteTimeout)
+	duration("KANBAN_IDLE_TIMEOUT", &cfg.IdleTimeout)
+	str("KANBAN_TLS_CERT", &cfg.TLSCert)
+	str("KANBAN_TLS_KEY", &cfg.TLSKey)
+	if base := getenv("OTEL_EXPORTER_OTLP_ENDPOINT"); base != "" {
+		cfg.OTLPEndpoint = strings.TrimSuffix(base, "/") + "/v1/traces"
+	}
+	str("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT", &cfg.OTLPEndpoint)
+	str("OTEL_SERVICE_NAME", &cfg.ServiceName)
+
+	fs := flag.NewFlagSet("kanban-lite", flag.ContinueOnError)
+	fs.StringVar(&cfg.TLSCert, "cert", cfg.TLSCert, "TLS certificate file (enables HTTPS and HTTP/2)")
+	fs.StringVar(&cfg.TLSKey, "key", cfg.TLSKey, "TLS private key file")
+	fs.BoolVar(&cfg.Strict, "strict", cfg.Strict, "refuse to start if the data file is corrupt")
+	if err := fs.Parse(args); err != nil {
+		errs = append(errs, err)
+	}
+
+	if cfg.CoalesceWindow == 0 {
+		errs = append(errs, errors.New("KANBAN_SSE_COALESCE_WINDOW must be positive"))
+	}
+	if cfg.EncryptionKey != "" {
+		if _, err := newAEAD(cfg.EncryptionKey); err != nil {
+			errs = append(errs, fmt.Errorf("KANBAN_ENCRYPTION_KEY: %w", err))
+		}
+	}
+	if cfg.IDStrategy != "numeric" && cfg.IDStrategy != "uuid" {
+		errs = append(errs, errors.New("KANBAN_ID_STRATEGY must be numeric or uuid"))
+	}
+	if (cfg.TLSCert == "") != (cfg.TLSKey == "") {
+		errs = append(errs, errors.New("tls: both -cert and -key are required"))
+	}
+	return cfg, errors.Join(errs...)
+}
+
+// String renders the effective configuration for the startup log, with
+// secrets masked.
+func (c Config) String() string {
+	mask := func(v string) string {
+		if v == "" {
+			return ""
+		}
+		return "(set)"
+	}
+	c.EncryptionKey, c.AdminToken = mask(c.EncryptionKey), mask(c.AdminToken)
+	type plain Config // drop the String method to avoid recursing
+	return fmt.Sprintf("%+v", plain(c))
 }
 
 // ==== In-memory store with JSON persistence ====
 
+// dataFile is the layout of the data file.
+type dataFile struct {
+	Boards    map[ID]*Board          `json:"boards"`
+	Templates []SharedTemplate       `json:"templates,omitempty"`
+	Snapshots map[ID][]BoardSnapshot `json:"snapshots,omitempty"`
+}
+
 type Store struct {
 	mu     sync.RWMutex
+	cfg    Config // as given to NewStore; shared with workspace stores
 	path   string
-	boards map[int64]*Board
-	// streams: boardID -> list of subscriber channels
-	streams map[int64]map[chan []byte]struct{}
+	boards map[ID]*Board
+	// streams: boardID -> set of live subscribers, guarded by subMu rather
+	// than mu so fanout never holds up mutations
+	subMu   sync.RWMutex
+	streams map[ID]map[*subscriber]struct{}
+	subBuf  int
+	// logs: boardID -> recent events, mirrored to disk for SSE resume
+	logs   map[ID][]Event
+	logCap int
+	// logWrites: event log changes waiting for disk, oldest first, written
+	// by writeEventLogs outside s.mu; logWriting is set while it runs.
+	logMu      sync.Mutex
+	logWrites  []logWrite
+	logWriting bool
+	// persist=false keeps everything in memory: load and save become no-ops
+	// and the event log never touches disk (tests, throwaway demos).
+	persist bool
+	// burst coalescing for SSE; see coalesce
+	coalesceMax    int
+	coalesceWindow time.Duration
+	bursts         map[ID]*burst
+	// queues: boardID -> events waiting for fanout; a board has a drain
+	// goroutine exactly while it has an entry here. fanMu guards queues and
+	// bursts; broadcast takes it inside mu, drain never takes mu.
+	fanMu  sync.Mutex
+	queues map[ID][]Event
+	// maxDesc caps card descriptions, in characters (0 = unlimited)
+	maxDesc int
+	// maxBatch caps ids per batch request (0 = unlimited); see decodeBatch
+	maxBatch int
+	// pretty indents the data file (diff-friendly); false writes it compact
+	pretty bool
+	// slugs: board slug -> board id, for human-friendly URLs
+	slugs map[string]ID
+	// strict makes load fail on a corrupt data file instead of moving it aside.
+	strict bool
+	// passwords: boardID -> password hash, persisted in passwords.json so
+	// it never shows up in board responses; tokens are unlock grants
+	passwords map[ID]string
+	tokens    map[string]unlockToken
+	// templates: the server-wide card template library
+	templates []SharedTemplate
+	// clientIDs: client-supplied board UUID -> board id
+	clientIDs map[string]ID
+	// listKeys: (board, Idempotency-Key) -> list created with it
+	listKeys map[listKey]keyedList
+	// aead encrypts the data file when set (KANBAN_ENCRYPTION_KEY)
+	aead cipher.AEAD
+	// saveTimeout bounds how long save waits for the disk (0 = forever).
+	// writing serializes writes; written is the newest snapshot on disk
+	// (guarded by writing) and saveSeq numbers snapshots as they are taken.
+	saveTimeout time.Duration
+	writing     chan struct{}
+	written     int64
+	saveSeq     atomic.Int64
+	saveStalled atomic.Bool
+	// hooks calls board move hooks (KANBAN_MOVE_HOOK_TIMEOUT)
+	hooks *http.Client
+	// loaded is set once load succeeds; until then the API answers 503
+	// (see Server.ready) rather than serve an empty store.
+	loaded atomic.Bool
+	// wal: see "Write-ahead log". walMu orders appends and checkpoints;
+	// walSeen holds each board as last persisted (see walState),
+	// walUnlogged the unlogged count, walSize the log's size and walLimit
+	// the size at which save writes a full snapshot instead.
+	wal         bool
+	walMu       sync.Mutex
+	walSeen     map[ID]*walState
+	walUnlogged int64
+	walSize     int64
+	walLimit    int64
+	// unlogged counts changes to data outside boards (templates, board
+	// snapshots), which the write-ahead log doesn't cover; guarded by mu.
+	unlogged int64
+	// snapshots: board id -> its restore points, oldest first
+	snapshots map[ID][]BoardSnapshot
+}
+
+// subscriber is one SSE connection. When its buffer overflows the event is
+// dropped and resync is signalled so the client knows to re-fetch the board.
+type subscriber struct {
+	ch      chan Event
+	resync  chan struct{}
+	dropped atomic.Int64
+}
+
+// Change describes one mutation for broadcast. Every SSE payload has the same
+// shape: which entity, what happened to it, and only the fields that changed
+// (the whole entity on create). Object is the full entity after the change,
+// sent only to subscribers that ask for ?verbose=true.
+type Change struct {
+	Entity string
+	Op     string
+	ID     ID
+	Fields any
+	Object any
+}
+
+// Event is one broadcast, as kept in the per-board event log.
+type Event struct {
+	ID       int64           `json:"id"`
+	Type     string          `json:"type"` // Entity + "." + Op
+	Entity   string          `json:"entity"`
+	Op       string          `json:"op"`
+	EntityID ID              `json:"entityId"`
+	Fields   json.RawMessage `json:"fields,omitempty"`
+	Object   json.RawMessage `json:"object,omitempty"`
+	At       *time.Time      `json:"at,omitempty"` // unset on events logged by older versions
+}
+
+// NewStore returns an empty store for cfg.DataPath; call load to read it.
+// cfg should come from LoadConfig or DefaultConfig.
+func NewStore(cfg Config) *Store {
+	s := &Store{
+		cfg:      cfg,
+		path:     cfg.DataPath,
+		boards:   map[ID]*Board{},
+		streams:  map[ID]map[*subscriber]struct{}{},
+		subBuf:   cfg.SSEBuffer,
+		logs:     map[ID][]Event{},
+		logCap:   cfg.EventLogSize,
+		persist:  cfg.Persist,
+		bursts:   map[ID]*burst{},
+		queues:   map[ID][]Event{},
+		slugs:    map[string]ID{},
+		maxDesc:  cfg.MaxDescription,
+		maxBatch: cfg.MaxBatch,
+		pretty:   cfg.Pretty,
+		strict:   cfg.Strict,
+
+		coalesceMax:    cfg.CoalesceMax,
+		coalesceWindow: cfg.CoalesceWindow,
+		passwords:      map[ID]string{},
+		tokens:         map[string]unlockToken{},
+		clientIDs:      map[string]ID{},
+		listKeys:       map[listKey]keyedList{},
+		saveTimeout:    cfg.SaveTimeout,
+		writing:        make(chan struct{}, 1),
+		hooks: &http.Client{
+			Timeout: cfg.MoveHookTimeout,
+			// a redirect could lead outside KANBAN_MOVE_HOOK_ALLOW
+			CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+		},
+		wal:       cfg.WAL && cfg.Persist,
+		walSeen:   map[ID]*walState{},
+		snapshots: map[ID][]BoardSnapshot{},
+	}
+	if cfg.EncryptionKey != "" {
+		aead, err := newAEAD(cfg.EncryptionKey)
+		if err != nil {
+			panic("NewStore: " + err.Error()) // LoadConfig rejects bad keys
+		}
+		s.aead = aead
+	}
+	return s
 }
 
-func NewStore(path string) *Store {
-	return &Store{path: path, boards: map[int64]*Board{}, streams: map[int64]map[chan []byte]struct{}{}}
+// withPath returns an empty store for another data file that shares this
+// store's settings.
+func (s *Store) withPath(path string) *Store {
+	cfg := s.cfg
+	cfg.DataPath = path
+	return NewStore(cfg)
 }
 
-func (s *Store) load() error {
+func (s *Store) load(ctx context.Context) (err error) {
+	defer func() {
+		if err == nil {
+			s.loaded.Store(true)
+		}
+	}()
+	if !s.persist {
+		return nil
+	}
+	_, sp := startSpan(ctx, "store.load")
+	defer func() { endSpan(sp, err) }()
 	s.mu.Lock()
 	defer s.mu.Unlock()
+	if err := s.loadPasswords(); err != nil {
+		return err
+	}
 	f, err := os.Open(s.path)
 	if errors.Is(err, os.ErrNotExist) {
-		return nil
+		return s.replayWAL()
 	}
 	if err != nil {
 		return err
 	}
 	defer f.Close()
-	dec := json.NewDecoder(f)
-	return dec.Decode(&s.boards)
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return err
+	}
+	if bytes.HasPrefix(data, encHeader[:len(encMagic)]) {
+		// never treat an undecryptable file as corrupt: that would start empty
+		if data, err = s.decrypt(data); err != nil {
+			return fmt.Errorf("data file %s: %w", s.path, err)
+		}
+	}
+	var raw json.RawMessage
+	var file dataFile
+	if err = json.NewDecoder(bytes.NewReader(data)).Decode(&raw); err == nil {
+		err = json.Unmarshal(raw, &file)
+	}
+	if err == nil && file.Boards == nil {
+		// files from before templates are a bare id -> board map
+		err = json.Unmarshal(raw, &file.Boards)
+	}
+	if err == nil {
+		if file.Boards != nil {
+			s.boards = file.Boards
+		}
+		s.templates = file.Templates
+		if file.Snapshots != nil {
+			s.snapshots = file.Snapshots
+		}
+		for id, b := range s.boards {
+			normalizeBoard(b)
+			b.Protected = s.passwords[id] != ""
+		}
+		s.indexSlugs()
+		return s.replayWAL()
+	}
+	if s.strict {
+		return err
+	}
+	// A truncated or malformed file shouldn't brick the service: set it aside
+	// for inspection and start empty.
+	bad := fmt.Sprintf("%s.corrupt.%d", s.path, time.Now().Unix())
+	f.Close()
+	if rerr := os.Rename(s.path, bad); rerr != nil {
+		return fmt.Errorf("%w (and moving it aside failed: %v)", err, rerr)
+	}
+	log.Printf("WARNING: data file %s is unreadable (%v); moved to %s, starting with an empty store", s.path, err, bad)
+	s.boards = map[ID]*Board{}
+	s.slugs = map[string]ID{}
+	return s.replayWAL()
 }
 
-func (s *Store) save() error {
+func (s *Store) save(ctx context.Context) (err error) {
+	if !s.persist {
+		return nil
+	}
+	_, sp := startSpan(ctx, "store.save")
+	defer func() { endSpan(sp, err) }()
+	if s.wal {
+		return s.appendWAL()
+	}
 	s.mu.RLock()
-	defer s.mu.RUnlock()
+	data, err := s.encode()
+	seq := s.saveSeq.Add(1)
+	s.mu.RUnlock()
+	if err != nil {
+		return err
+	}
+	return s.write(seq, data)
+}
+
+// errSaveTimeout reports a data file write that did not finish within
+// saveTimeout. The write carries on in the background.
+var errSaveTimeout = errors.New("data file write timed out")
+
+// write puts a snapshot on disk without holding s.mu, so a hung filesystem
+// (a stale NFS mount, say) can't wedge the server. Writes are serialized and
+// a snapshot older than the one already written is skipped. If the write
+// takes longer than saveTimeout, write gives up waiting and marks the store
+// stalled until some write completes; see Server.writable.
+func (s *Store) write(seq int64, data []byte) error {
+	done := make(chan error, 1)
+	go func() {
+		s.writing <- struct{}{}
+		defer func() { <-s.writing }()
+		var err error
+		if seq > s.written {
+			if err = s.writeFile(data); err == nil {
+				s.written = seq
+			}
+		}
+		s.saveStalled.Store(false)
+		done <- err
+	}()
+	if s.saveTimeout <= 0 {
+		return <-done
+	}
+	timer := time.NewTimer(s.saveTimeout)
+	defer timer.Stop()
+	select {
+	case err := <-done:
+		return err
+	case <-timer.C:
+		if !s.saveStalled.Swap(true) {
+			log.Printf("save: writing %s took longer than %s; rejecting changes until it finishes", s.path, s.saveTimeout)
+		}
+		return errSaveTimeout
+	}
+}
+
+// writeFile atomically replaces the data file with data.
+func (s *Store) writeFile(data []byte) error {
 	tmp := s.path + ".tmp"
 	if err := os.MkdirAll(filepath.Dir(s.path), 0o755); err != nil {
 		return err
 	}
-	f, err := os.Create(tmp)
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
+
+// encode serializes the store (encrypted when configured); the caller holds
+// s.mu.
+func (s *Store) encode() ([]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	if s.pretty && s.aead == nil {
+		enc.SetIndent("", "  ")
+	}
+	if err := enc.Encode(dataFile{Boards: s.boards, Templates: s.templates, Snapshots: s.snapshots}); err != nil {
+		return nil, err
+	}
+	if s.aead != nil {
+		return s.encrypt(buf.Bytes()), nil
+	}
+	return buf.Bytes(), nil
+}
+
+// ---- Write-ahead log ----
+//
+// With KANBAN_WAL=true, save doesn't rewrite the data file. It compares each
+// board whose Events moved since the last save with what the log already
+// holds and appends one compact JSON line per changed entity (a board's
+// settings, a list, a card, or a deletion of one) to <data>.wal, then
+// fsyncs it, so a save costs the lines and cards it touched rather than the
+// whole store. Once the log outgrows the last snapshot (or templates or
+// board snapshots change, since they aren't logged; see Store.unlogged)
+// save writes a full snapshot and truncates the log: a checkpoint. load
+// replays the log over the snapshot. Lines are encrypted like the data file
+// when that is.
+
+// walMinLimit keeps small stores from checkpointing every few saves.
+const walMinLimit = 1 << 20
+
+// walEntry is one line of the log. Op is one of
+//
+//	board.set    Value is the board without its lists and archive
+//	board.delete
+//	list.set     Value is the list without its cards
+//	list.delete  ID is the list
+//	card.set     Value is the card, now in list List (or the archive)
+//	card.delete  ID is the card
+type walEntry struct {
+	Op       string          `json:"op"`
+	Board    ID              `json:"board"`
+	List     ID              `json:"list,omitempty"`
+	Archived bool            `json:"archived,omitempty"`
+	ID       ID              `json:"id,omitempty"`
+	Value    json.RawMessage `json:"value,omitempty"`
+}
+
+// walState is what the snapshot plus the log hold for one board: its Events
+// and a hash of each entity's JSON, so appendWAL logs only what changed.
+type walState struct {
+	events int64
+	header uint64
+	lists  map[ID]uint64
+	cards  map[ID]walCard
+}
+
+// walCard is where a logged card sits, and its hash.
+type walCard struct {
+	list     ID // empty when archived
+	archived bool
+	hash     uint64
+}
+
+// walSeed seeds the entity hashes; they are never written anywhere.
+var walSeed = maphash.MakeSeed()
+
+func (s *Store) walPath() string { return s.path + ".wal" }
+
+// walEntities calls fn with the encoded header, each list and each card of b,
+// in the order replay needs them: the board before its lists, lists before
+// their cards.
+func walEntities(b *Board, fn func(e walEntry) error) error {
+	header := *b
+	header.Lists, header.Archive = nil, nil
+	v, err := json.Marshal(header)
 	if err != nil {
 		return err
 	}
-	enc := json.NewEncoder(f)
-	enc.SetIndent("", "  ")
-	if err := enc.Encode(s.boards); err != nil {
-		f.Close()
+	if err := fn(walEntry{Op: "board.set", Board: b.ID, Value: v}); err != nil {
 		return err
 	}
-	f.Close()
-	return os.Rename(tmp, s.path)
+	for _, lst := range b.Lists {
+		l := lst
+		l.Cards = nil
+		if v, err = json.Marshal(l); err != nil {
+			return err
+		}
+		if err := fn(walEntry{Op: "list.set", Board: b.ID, ID: l.ID, Value: v}); err != nil {
+			return err
+		}
+	}
+	card := func(list ID, archived bool, c *Card) error {
+		v, err := json.Marshal(c)
+		if err != nil {
+			return err
+		}
+		return fn(walEntry{Op: "card.set", Board: b.ID, List: list, Archived: archived, ID: c.ID, Value: v})
+	}
+	for _, lst := range b.Lists {
+		for i := range lst.Cards {
+			if err := card(lst.ID, false, &lst.Cards[i]); err != nil {
+				return err
+			}
+		}
+	}
+	for i := range b.Archive {
+		if err := card("", true, &b.Archive[i]); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
-// ---- Event broadcasting (SSE) ----
-func (s *Store) broadcast(boardID int64, typ string, data any) {
-	msg := struct {
-		Type string `json:"type"`
-		Data any    `json:"data"`
-	}{typ, data}
-	b, _ := json.Marshal(msg)
+// walDiff appends to buf the lines that turn prev (nil: a board the log
+// hasn't seen) into b, and returns b's state. With buf nil it only computes
+// the state.
+func (s *Store) walDiff(buf *bytes.Buffer, b *Board, prev *walState) (*walState, error) {
+	if prev == nil {
+		prev = &walState{}
+	}
+	st := &walState{events: b.Events, lists: map[ID]uint64{}, cards: map[ID]walCard{}}
+	err := walEntities(b, func(e walEntry) error {
+		h := maphash.Bytes(walSeed, e.Value)
+		var changed bool
+		switch e.Op {
+		case "board.set":
+			st.header, changed = h, h != prev.header
+		case "list.set":
+			st.lists[e.ID] = h
+			old, ok := prev.lists[e.ID]
+			changed = !ok || old != h
+		default:
+			c := walCard{list: e.List, archived: e.Archived, hash: h}
+			st.cards[e.ID] = c
+			old, ok := prev.cards[e.ID]
+			changed = !ok || old != c
+		}
+		if !changed || buf == nil {
+			return nil
+		}
+		return s.walLine(buf, e)
+	})
+	if err != nil || buf == nil {
+		return st, err
+	}
+	// cards first: a deleted list's cards are gone or moved by now
+	for id := range prev.cards {
+		if _, ok := st.cards[id]; !ok {
+			if err := s.walLine(buf, walEntry{Op: "card.delete", Board: b.ID, ID: id}); err != nil {
+				return st, err
+			}
+		}
+	}
+	for id := range prev.lists {
+		if _, ok := st.lists[id]; !ok {
+			if err := s.walLine(buf, walEntry{Op: "list.delete", Board: b.ID, ID: id}); err != nil {
+				return st, err
+			}
+		}
+	}
+	return st, nil
+}
+
+// walStates records the state of every board; the caller holds s.mu.
+func (s *Store) walStates() (map[ID]*walState, error) {
+	seen := make(map[ID]*walState, len(s.boards))
+	for id, b := range s.boards {
+		st, err := s.walDiff(nil, b, nil)
+		if err != nil {
+			return nil, err
+		}
+		seen[id] = st
+	}
+	return seen, nil
+}
 
+// appendWAL logs the changes since the last save, or checkpoints.
+func (s *Store) appendWAL() error {
+	s.walMu.Lock()
+	defer s.walMu.Unlock()
 	s.mu.RLock()
-	subs := s.streams[boardID]
-	for ch := range subs {
-		select {
-		case ch <- b:
-		default: /* drop if slow */
+	if s.walSize > s.walLimit || s.unlogged != s.walUnlogged {
+		s.mu.RUnlock()
+		return s.checkpointLocked()
+	}
+	var buf bytes.Buffer
+	var err error
+	for id, b := range s.boards {
+		prev := s.walSeen[id]
+		if prev != nil && prev.events == b.Events {
+			continue
+		}
+		var st *walState
+		if st, err = s.walDiff(&buf, b, prev); err != nil {
+			break
+		}
+		s.walSeen[id] = st
+	}
+	for id := range s.walSeen {
+		if s.boards[id] == nil && err == nil {
+			err = s.walLine(&buf, walEntry{Op: "board.delete", Board: id})
+			delete(s.walSeen, id)
 		}
 	}
 	s.mu.RUnlock()
+	if err == nil && buf.Len() > 0 {
+		err = appendSync(s.walPath(), buf.Bytes())
+	}
+	if err != nil {
+		s.walSize = s.walLimit + 1 // what was skipped goes into a snapshot next time
+		return err
+	}
+	s.walSize += int64(buf.Len())
+	return nil
 }
 
-func (s *Store) subscribe(boardID int64) (ch chan []byte, cancel func()) {
-	ch = make(chan []byte, 16)
-	s.mu.Lock()
-	if s.streams[boardID] == nil {
-		s.streams[boardID] = map[chan []byte]struct{}{}
+// walLine encodes e as one log line onto buf.
+func (s *Store) walLine(buf *bytes.Buffer, e walEntry) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
 	}
-	s.streams[boardID][ch] = struct{}{}
-	s.mu.Unlock()
-	return ch, func() {
-		s.mu.Lock()
-		delete(s.streams[boardID], ch)
-		close(ch)
-		s.mu.Unlock()
+	if s.aead != nil {
+		data = []byte(base64.StdEncoding.EncodeToString(s.encrypt(data)))
+	}
+	buf.Write(data)
+	buf.WriteByte('\n')
+	return nil
+}
+
+// appendSync appends data to the file at path and flushes it to disk.
+func appendSync(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err = f.Write(data); err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// checkpoint writes a full snapshot and empties the log.
+func (s *Store) checkpoint() error {
+	s.walMu.Lock()
+	defer s.walMu.Unlock()
+	return s.checkpointLocked()
+}
+
+// checkpointLocked is checkpoint with walMu held. Saves waiting on walMu
+// meanwhile log their changes against the new snapshot afterwards. If the
+// snapshot isn't known to be on disk the log is kept, and replaying it over
+// either snapshot gives the same boards.
+func (s *Store) checkpointLocked() error {
+	s.mu.RLock()
+	data, err := s.encode()
+	seq := s.saveSeq.Add(1)
+	var seen map[ID]*walState
+	if err == nil {
+		seen, err = s.walStates()
+	}
+	unlogged := s.unlogged
+	s.mu.RUnlock()
+	if err != nil {
+		return err
+	}
+	if err := s.write(seq, data); err != nil {
+		return err
+	}
+	if err := os.Truncate(s.walPath(), 0); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	s.walSeen, s.walUnlogged, s.walSize = seen, unlogged, 0
+	s.walLimit = max(int64(len(data)), walMinLimit)
+	return nil
+}
+
+// replayWAL applies the log over the snapshot just loaded and records what
+// is now persisted; the caller holds s.mu. A torn last line (a crash during
+// an append) is dropped; damage anywhere else is an error, as starting
+// without those changes would quietly lose them.
+func (s *Store) replayWAL() error {
+	if !s.wal {
+		return nil
+	}
+	data, err := os.ReadFile(s.walPath())
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	lines := bytes.Split(data, []byte("\n"))
+	touched := map[ID]bool{}
+	n := 0
+	for i, line := range lines {
+		if len(line) == 0 {
+			continue
+		}
+		var e walEntry
+		if err := s.decodeWALLine(line, &e); err != nil {
+			if i == len(lines)-1 {
+				// cut it off, or the next append would extend it
+				log.Printf("WARNING: %s ends in an incomplete entry; dropping it", s.walPath())
+				data = data[:len(data)-len(line)]
+				if err := os.Truncate(s.walPath(), int64(len(data))); err != nil {
+					return err
+				}
+				break
+			}
+			return fmt.Errorf("write-ahead log %s, line %d: %w", s.walPath(), i+1, err)
+		}
+		if err := s.applyWAL(e); err != nil {
+			return fmt.Errorf("write-ahead log %s, line %d: %w", s.walPath(), i+1, err)
+		}
+		touched[e.Board] = true
+		n++
+	}
+	for id := range touched {
+		if b := s.boards[id]; b != nil {
+			normalizeBoard(b)
+			b.Protected = s.passwords[id] != ""
+		}
+	}
+	if n > 0 {
+		s.indexSlugs()
+		log.Printf("wal: replayed %d entries from %s", n, s.walPath())
+	}
+	if s.walSeen, err = s.walStates(); err != nil {
+		return err
+	}
+	s.walUnlogged, s.walSize, s.walLimit = s.unlogged, int64(len(data)), walMinLimit
+	if fi, err := os.Stat(s.path); err == nil {
+		s.walLimit = max(fi.Size(), walMinLimit)
+	}
+	return nil
+}
+
+// applyWAL applies one log entry to the boards; the caller holds s.mu.
+func (s *Store) applyWAL(e walEntry) error {
+	switch e.Op {
+	case "board.set":
+		var h Board
+		if err := json.Unmarshal(e.Value, &h); err != nil {
+			return err
+		}
+		if b := s.boards[e.Board]; b != nil {
+			h.Lists, h.Archive = b.Lists, b.Archive
+		}
+		if h.Lists == nil {
+			h.Lists = []List{}
+		}
+		s.boards[e.Board] = &h
+		return nil
+	case "board.delete":
+		delete(s.boards, e.Board)
+		return nil
+	}
+	b := s.boards[e.Board]
+	if b == nil {
+		return fmt.Errorf("%s on unknown board %s", e.Op, e.Board)
+	}
+	switch e.Op {
+	case "list.set":
+		var l List
+		if err := json.Unmarshal(e.Value, &l); err != nil {
+			return err
+		}
+		if old := findList(b, l.ID); old != nil {
+			l.Cards = old.Cards
+			*old = l
+		} else {
+			l.Cards = []Card{}
+			b.Lists = append(b.Lists, l)
+		}
+	case "list.delete":
+		b.Lists = slices.DeleteFunc(b.Lists, func(l List) bool { return l.ID == e.ID })
+	case "card.set":
+		var c Card
+		if err := json.Unmarshal(e.Value, &c); err != nil {
+			return err
+		}
+		if e.Archived {
+			// keep archive order: an edit replaces the card where it is
+			if i := slices.IndexFunc(b.Archive, func(a Card) bool { return a.ID == c.ID }); i >= 0 {
+				b.Archive[i] = c
+				return nil
+			}
+			dropWALCard(b, c.ID)
+			b.Archive = append(b.Archive, c)
+			return nil
+		}
+		lst := findList(b, e.List)
+		if lst == nil {
+			return fmt.Errorf("card %s in unknown list %s", c.ID, e.List)
+		}
+		dropWALCard(b, c.ID)
+		lst = findList(b, e.List)
+		lst.Cards = append(lst.Cards, c) // normalizeBoard sorts by Position
+	case "card.delete":
+		dropWALCard(b, e.ID)
+	default:
+		return fmt.Errorf("unknown operation %q", e.Op)
+	}
+	return nil
+}
+
+// dropWALCard removes card id from b's lists or archive, wherever it is.
+func dropWALCard(b *Board, id ID) {
+	match := func(c Card) bool { return c.ID == id }
+	for i := range b.Lists {
+		b.Lists[i].Cards = slices.DeleteFunc(b.Lists[i].Cards, match)
+	}
+	b.Archive = slices.DeleteFunc(b.Archive, match)
+}
+
+// decodeWALLine parses one log line, decrypting it first if needed.
+func (s *Store) decodeWALLine(line []byte, e *walEntry) error {
+	if line[0] != '{' {
+		enc, err := base64.StdEncoding.DecodeString(string(line))
+		if err != nil {
+			return err
+		}
+		if len(enc) <= len(encHeader) {
+			return errors.New("encrypted entry is truncated")
+		}
+		if line, err = s.decrypt(enc); err != nil {
+			return err
+		}
+	}
+	return json.Unmarshal(line, e)
+}
+
+// ---- Compaction ----
+
+// CompactReport summarizes a compaction.
+type CompactReport struct {
+	Boards        int   `json:"boards"`
+	Lists         int   `json:"lists"`
+	Cards         int   `json:"cards"`
+	Archived      int   `json:"archived"`
+	ArchivePurged int   `json:"archivePurged"`
+	RefsDropped   int   `json:"refsDropped"` // dangling links, labels, rules, flow stats
+	Passwords     int   `json:"passwordsDropped"`
+	BytesBefore   int64 `json:"bytesBefore"`
+	BytesAfter    int64 `json:"bytesAfter"`
+}
+
+// compact normalizes every board, drops references to things that no longer
+// exist (and archived cards archived before purgeBefore, when set), then
+// rewrites the data file. Without the WAL the snapshot is encoded under the
+// same write lock as the cleanup, so nothing slips in between. With it the
+// lock is released before checkpoint re-reads the boards, so writes landing
+// in between are written too; that is harmless, as they apply on top of the
+// cleaned boards.
+func (s *Store) compact(purgeBefore time.Time) (CompactReport, error) {
+	s.mu.Lock()
+	var rep CompactReport
+	if fi, err := os.Stat(s.path); err == nil {
+		rep.BytesBefore = fi.Size()
+	}
+	for _, b := range s.boards {
+		normalizeBoard(b)
+		if !purgeBefore.IsZero() {
+			kept := b.Archive[:0]
+			for _, c := range b.Archive {
+				if c.ArchivedAt != nil && c.ArchivedAt.Before(purgeBefore) {
+					rep.ArchivePurged++
+					continue
+				}
+				kept = append(kept, c)
+			}
+			b.Archive = kept
+		}
+		rep.RefsDropped += compactBoard(b)
+		rep.Boards++
+		rep.Lists += len(b.Lists)
+		rep.Archived += len(b.Archive)
+		for _, l := range b.Lists {
+			rep.Cards += len(l.Cards)
+		}
+	}
+	for id := range s.passwords {
+		if s.boards[id] == nil {
+			delete(s.passwords, id)
+			rep.Passwords++
+		}
+	}
+	if rep.Passwords > 0 {
+		if err := s.savePasswords(); err != nil {
+			s.mu.Unlock()
+			return rep, err
+		}
+	}
+	if !s.persist {
+		s.mu.Unlock()
+		return rep, nil
+	}
+	if s.wal {
+		// the logged boards predate the cleanup: replace them as well
+		s.mu.Unlock()
+		if err := s.checkpoint(); err != nil {
+			return rep, err
+		}
+	} else {
+		data, err := s.encode()
+		seq := s.saveSeq.Add(1)
+		s.mu.Unlock()
+		if err != nil {
+			return rep, err
+		}
+		if err := s.write(seq, data); err != nil {
+			return rep, err
+		}
+	}
+	if fi, err := os.Stat(s.path); err == nil {
+		rep.BytesAfter = fi.Size()
+	}
+	return rep, nil
+}
+
+// compactBoard removes dangling references from b and returns how many.
+func compactBoard(b *Board) int {
+	n := 0
+	cards := map[ID]bool{}
+	for _, l := range b.Lists {
+		for _, c := range l.Cards {
+			cards[c.ID] = true
+		}
+	}
+	labels := map[ID]bool{}
+	for _, lb := range b.Labels {
+		labels[lb.ID] = true
+	}
+	keep := func(ids []ID, ok map[ID]bool) []ID {
+		var out []ID
+		for _, id := range ids {
+			if ok[id] {
+				out = append(out, id)
+			} else {
+				n++
+			}
+		}
+		return out
+	}
+	for i := range b.Lists {
+		for j := range b.Lists[i].Cards {
+			c := &b.Lists[i].Cards[j]
+			c.Blocks, c.BlockedBy = keep(c.Blocks, cards), keep(c.BlockedBy, cards)
+			c.Labels = keep(c.Labels, labels)
+		}
+	}
+	if b.DefaultListID != "" && findList(b, b.DefaultListID) == nil {
+		b.DefaultListID = ""
+		n++
+	}
+	rules := b.Rules[:0]
+	for _, ru := range b.Rules {
+		if (ru.ListID != "" && findList(b, ru.ListID) == nil) || (ru.LabelID != "" && findLabel(b, ru.LabelID) == nil) {
+			n++
+			continue
+		}
+		rules = append(rules, ru)
+	}
+	b.Rules = rules
+	for id := range b.Flow {
+		if findList(b, id) == nil {
+			delete(b.Flow, id)
+			n++
+		}
+	}
+	return n
+}
+
+// ---- Encryption at rest ----
+//
+// With KANBAN_ENCRYPTION_KEY set the data file is AES-GCM encrypted:
+// encHeader (magic + format version), a 12-byte nonce, then the sealed JSON.
+// The header is authenticated as additional data.
+
+const encMagic = "KANBAN-ENC"
+
+var encHeader = []byte(encMagic + "\x01")
+
+// newAEAD builds the cipher for a base64 AES-128/192/256 key.
+func newAEAD(key64 string) (cipher.AEAD, error) {
+	key, err := base64.StdEncoding.DecodeString(key64)
+	if err != nil {
+		return nil, fmt.Errorf("encryption key is not base64: %w", err)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("encryption key must be 16, 24 or 32 bytes: %w", err)
+	}
+	return cipher.NewGCM(block)
+}
+
+func (s *Store) encrypt(plain []byte) []byte {
+	nonce := make([]byte, s.aead.NonceSize())
+	_, _ = crand.Read(nonce)
+	out := append(append([]byte{}, encHeader...), nonce...)
+	return s.aead.Seal(out, nonce, plain, encHeader)
+}
+
+func (s *Store) decrypt(data []byte) ([]byte, error) {
+	if s.aead == nil {
+		return nil, errors.New("file is encrypted but KANBAN_ENCRYPTION_KEY is not set")
+	}
+	if !bytes.HasPrefix(data, encHeader) {
+		return nil, fmt.Errorf("unsupported encryption format version %d", data[len(encMagic)])
+	}
+	data = data[len(encHeader):]
+	n := s.aead.NonceSize()
+	if len(data) < n {
+		return nil, errors.New("encrypted file is truncated")
+	}
+	plain, err := s.aead.Open(nil, data[:n], data[n:], encHeader)
+	if err != nil {
+		return nil, errors.New("cannot decrypt (wrong KANBAN_ENCRYPTION_KEY or damaged file)")
+	}
+	return plain, nil
+}
+
+// ---- Board slugs ----
+
+var (
+	slugStrip = regexp.MustCompile(`[^\p{L}\p{N}]+`)
+	slugMarks = regexp.MustCompile(`\p{M}+`)
+	// slugFold transliterates common Latin letters with diacritics.
+	slugFold = strings.NewReplacer(
+		"à", "a", "á", "a", "â", "a", "ã", "a", "ä", "a", "å", "a", "ą", "a", "ă", "a",
+		"æ", "ae", "ç", "c", "ć", "c", "č", "c", "ď", "d", "đ", "d",
+		"è", "e", "é", "e", "ê", "e", "ë", "e", "ę", "e", "ě", "e",
+		"ğ", "g", "ì", "i", "í", "i", "î", "i", "ï", "i", "ı", "i", "ł", "l",
+		"ñ", "n", "ń", "n", "ň", "n", "ò", "o", "ó", "o", "ô", "o", "õ", "o", "ö", "o", "ø", "o", "ő", "o",
+		"œ", "oe", "ř", "r", "ś", "s", "š", "s", "ş", "s", "ß", "ss", "ť", "t", "ţ", "t",
+		"ù", "u", "ú", "u", "û", "u", "ü", "u", "ů", "u", "ű", "u", "ý", "y", "ÿ", "y",
+		"ź", "z", "ż", "z", "ž", "z", "þ", "th", "ð", "d",
+	)
+)
+
+var uuidPattern = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}$`)
+
+// slugify turns a title into a URL slug ("Project Alpha" -> "project-alpha").
+// Accented Latin letters are transliterated ("Café" -> "cafe"); letters of
+// other scripts are kept ("看板" stays, percent-encoded in URLs) and
+// symbols such as emoji become separators. All-digit slugs are prefixed so
+// they can't be mistaken for board ids.
+func slugify(title string) string {
+	folded := slugFold.Replace(slugMarks.ReplaceAllString(strings.ToLower(title), ""))
+	slug := strings.Trim(slugStrip.ReplaceAllString(folded, "-"), "-")
+	if slug == "" {
+		return ""
+	}
+	if _, err := strconv.ParseInt(slug, 10, 64); err == nil {
+		slug = "board-" + slug
+	}
+	return slug
+}
+
+// assignSlug gives b a unique slug derived from its title, adding a numeric
+// suffix on collision. Caller holds s.mu for writing.
+func (s *Store) assignSlug(b *Board) {
+	base := slugify(b.Title)
+	if base == "" {
+		return
+	}
+	slug := base
+	for n := 2; ; n++ {
+		if _, taken := s.slugs[slug]; !taken {
+			break
+		}
+		slug = base + "-" + strconv.Itoa(n)
+	}
+	b.Slug = slug
+	s.slugs[slug] = b.ID
+}
+
+// indexSlugs rebuilds the slug index after load, backfilling slugs for boards
+// saved before slugs existed (oldest first, so suffixes are deterministic).
+func (s *Store) indexSlugs() {
+	s.slugs = map[string]ID{}
+	s.clientIDs = map[string]ID{}
+	ids := make([]ID, 0, len(s.boards))
+	for id, b := range s.boards {
+		ids = append(ids, id)
+		if b.Slug != "" {
+			s.slugs[b.Slug] = id
+		}
+		if b.ClientID != "" {
+			s.clientIDs[b.ClientID] = id
+		}
+	}
+	slices.SortFunc(ids, compareIDs)
+	for _, id := range ids {
+		if b := s.boards[id]; b.Slug == "" {
+			s.assignSlug(b)
+		}
+	}
+}
+
+// boardRef resolves a {boardID} URL segment, which may be an id or a slug.
+// Unknown refs resolve to "", which matches no board; only IDs of existing
+// boards come back, since they end up in file names (eventLogPath).
+func (s *Store) boardRef(ref string) ID {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if id := parseID(ref); s.boards[id] != nil {
+		return id
+	}
+	return s.slugs[ref]
+}
+
+// ---- Event broadcasting (SSE) ----
+
+// SSE connection caps (KANBAN_SSE_MAX, KANBAN_SSE_MAX_PER_BOARD; 0 = no
+// limit). sseOpen counts streams across all workspaces.
+var (
+	sseLimit, sseBoardLimit int
+	sseOpen                 atomic.Int64
+	errTooManyStreams       = errors.New("too many event streams")
+)
+
+// broadcast records an event in the board's log and queues it for the
+// board's subscribers. Event ids follow the board's Events counter. Fanout
+// happens on a per-board goroutine outside s.mu, so a mutation's latency
+// doesn't grow with the number of subscribers; events still go out in log
+// order.
+func (s *Store) broadcast(ctx context.Context, boardID ID, c Change) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.broadcastLocked(ctx, boardID, c)
+}
+
+// broadcastLocked is broadcast for callers already holding s.mu for writing,
+// so that a change and its event id come from the same critical section.
+func (s *Store) broadcastLocked(ctx context.Context, boardID ID, c Change) {
+	_, sp := startSpan(ctx, "store.broadcast", attribute.String("board.id", string(boardID)), attribute.String("event.type", c.Entity+"."+c.Op))
+	defer sp.End()
+	e := Event{Type: c.Entity + "." + c.Op, Entity: c.Entity, Op: c.Op, EntityID: c.ID}
+	e.Fields, _ = json.Marshal(c.Fields)
+	if c.Object != nil {
+		e.Object, _ = json.Marshal(c.Object)
+	}
+
+	now := time.Now().UTC() // under the lock, so log order is time order
+	e.At = &now
+	if b := s.boards[boardID]; b != nil {
+		e.ID = b.Events
+		b.LastActivityAt = now // every mutation broadcasts
+	}
+	// concurrent mutations can broadcast out of order; ids must stay unique
+	if hist := s.eventLog(boardID); len(hist) > 0 && e.ID <= hist[len(hist)-1].ID {
+		e.ID = hist[len(hist)-1].ID + 1
+	}
+	s.appendEvent(boardID, e)
+	s.fanMu.Lock() // still under s.mu, so the queue is in id order
+	q, running := s.queues[boardID]
+	s.queues[boardID] = append(q, e)
+	s.fanMu.Unlock()
+	if !running {
+		go s.drain(boardID)
+	}
+}
+
+// drain fans out a board's queued events in order. It exits once the queue
+// is empty; the next broadcast starts a new one, so idle or deleted boards
+// keep no goroutine.
+func (s *Store) drain(boardID ID) {
+	for {
+		s.fanMu.Lock()
+		q := s.queues[boardID]
+		if len(q) == 0 {
+			delete(s.queues, boardID)
+			s.fanMu.Unlock()
+			return
+		}
+		s.queues[boardID] = nil
+		s.fanMu.Unlock()
+		for _, e := range q {
+			s.fanMu.Lock()
+			absorbed := s.coalesce(boardID, e)
+			s.fanMu.Unlock()
+			if !absorbed {
+				s.fanout(boardID, e)
+			}
+		}
+	}
+}
+
+// fanout delivers e to the board's live subscribers. Sends never block, so
+// holding subMu only delays subscribing and unsubscribing.
+func (s *Store) fanout(boardID ID, e Event) {
+	s.subMu.RLock()
+	defer s.subMu.RUnlock()
+	for sub := range s.streams[boardID] {
+		select {
+		case sub.ch <- e:
+		default:
+			// slow consumer: drop, but make sure it hears about it
+			sub.dropped.Add(1)
+			select {
+			case sub.resync <- struct{}{}:
+			default: // a resync is already pending
+			}
+		}
+	}
+}
+
+// touch records read activity on a board.
+func (s *Store) touch(boardID ID) {
+	s.mu.Lock()
+	if b := s.boards[boardID]; b != nil {
+		b.LastActivityAt = time.Now().UTC()
+	}
+	s.mu.Unlock()
+}
+
+// lastActive is when a board was last used; boards saved before activity
+// tracking fall back to their creation time, which is encoded in the id.
+func lastActive(b *Board) time.Time {
+	if b.LastActivityAt.IsZero() {
+		return b.ID.timestamp()
+	}
+	return b.LastActivityAt
+}
+
+// janitor closes open boards idle for longer than maxIdle, checking every
+// interval. In dry-run mode it only logs what it would close.
+func (s *Store) janitor(maxIdle, interval time.Duration, dryRun bool) {
+	for range time.Tick(interval) {
+		cutoff := time.Now().Add(-maxIdle)
+		var closed []ID
+		s.mu.Lock()
+		for _, b := range s.boards {
+			if b.Closed || lastActive(b).After(cutoff) {
+				continue
+			}
+			if dryRun {
+				log.Printf("janitor: would close idle board %s %q (last active %s)", b.ID, b.Title, lastActive(b).Format(time.RFC3339))
+				continue
+			}
+			log.Printf("janitor: closing idle board %s %q (last active %s)", b.ID, b.Title, lastActive(b).Format(time.RFC3339))
+			b.Closed = true
+			b.Events++
+			closed = append(closed, b.ID)
+		}
+		s.mu.Unlock()
+		if len(closed) == 0 {
+			continue
+		}
+		_ = s.save(context.Background())
+		for _, id := range closed {
+			s.broadcast(context.Background(), id, Change{Entity: "board", Op: "closed", ID: id, Fields: map[string]any{"closed": true}})
+		}
+	}
+}
+
+// ---- Automation rules ----
+//
+// Changes made by rules never trigger rules themselves, so rules can't loop.
+
+// completionTarget finds the first on-complete-move-to rule and the list it
+// sends cards completed in lst to; both are nil if such cards stay.
+func completionTarget(b *Board, lst *List) (*List, *Rule) {
+	for i, rule := range b.Rules {
+		if rule.Type != "on-complete-move-to" {
+			continue
+		}
+		to := findList(b, rule.ListID)
+		if to == nil || to.ID == lst.ID {
+			return nil, nil
+		}
+		return to, &b.Rules[i]
+	}
+	return nil, nil
+}
+
+// completionRule applies the first on-complete-move-to rule to the card at
+// lst.Cards[idx], which was just marked done, if the move hook approved that
+// move (see Server.vetMove): approved is the target list it approved. It
+// returns the move to broadcast, or nil if no rule moved the card. Caller
+// holds s.mu for writing.
+func completionRule(b *Board, lst *List, idx int, approved ID) *Change {
+	if to, rule := completionTarget(b, lst); to != nil && to.ID == approved {
+		c := lst.Cards[idx]
+		lst.Cards = append(lst.Cards[:idx], lst.Cards[idx+1:]...)
+		reindex(lst)
+		leaveList(b, lst, to, &c)
+		c = insertCard(to, c, -1, nil)
+		return &Change{Entity: "card", Op: "moved", ID: c.ID, Fields: map[string]any{"listId": to.ID, "position": c.Position, "rank": c.Rank, "rule": rule.ID}, Object: c}
+	}
+	return nil
+}
+
+// dueRules applies on-due-passed-add-label rules every interval.
+func (s *Store) dueRules(interval time.Duration) {
+	for range time.Tick(interval) {
+		s.applyDueRules(time.Now())
+	}
+}
+
+func (s *Store) applyDueRules(now time.Time) {
+	type change struct {
+		boardID ID
+		c       Change
+	}
+	var changes []change
+	s.mu.Lock()
+	for _, b := range s.boards {
+		if b.Closed {
+			continue
+		}
+		for _, rule := range b.Rules {
+			if rule.Type != "on-due-passed-add-label" || findLabel(b, rule.LabelID) == nil {
+				continue
+			}
+			for i := range b.Lists {
+				for j := range b.Lists[i].Cards {
+					c := &b.Lists[i].Cards[j]
+					if c.Done || c.Due == nil || c.Due.After(now) {
+						continue
+					}
+					labels := addID(c.Labels, rule.LabelID)
+					if len(labels) == len(c.Labels) {
+						continue // already labelled
+					}
+					c.Labels = labels
+					autoColor(b, c)
+					c.UpdatedAt = now.UTC()
+					changes = append(changes, change{b.ID, Change{Entity: "card", Op: "updated", ID: c.ID, Fields: map[string]any{"labels": c.Labels, "color": c.Color, "rule": rule.ID}, Object: *c}})
+				}
+			}
+		}
+	}
+	s.mu.Unlock()
+	if len(changes) == 0 {
+		return
+	}
+	// one event per change, as if each had been its own request
+	for _, ch := range changes {
+		s.mu.Lock()
+		if b := s.boards[ch.boardID]; b != nil {
+			b.Events++
+		}
+		s.mu.Unlock()
+		s.broadcast(context.Background(), ch.boardID, ch.c)
+	}
+	_ = s.save(context.Background())
+}
+
+// ---- Burst coalescing ----
+//
+// Off by default. With coalesceMax > 0, once a board emits more than
+// coalesceMax events within coalesceWindow, further events in that window are
+// not sent individually; subscribers get one board.changed hint when the
+// window closes and should re-fetch the board. Events are still logged, so
+// Last-Event-ID replay is unaffected.
+
+type burst struct {
+	start   time.Time
+	n       int
+	pending *Event // latest suppressed event, flushed as board.changed
+}
+
+// coalesce reports whether e was absorbed into a burst. Caller holds s.fanMu.
+func (s *Store) coalesce(boardID ID, e Event) bool {
+	if s.coalesceMax <= 0 {
+		return false
+	}
+	now := time.Now()
+	bu := s.bursts[boardID]
+	if bu == nil || now.Sub(bu.start) >= s.coalesceWindow {
+		if bu != nil && bu.pending != nil {
+			bu.n++
+			bu.pending = &e // flush for the previous window is still due
+			return true
+		}
+		s.bursts[boardID] = &burst{start: now, n: 1}
+		return false
+	}
+	bu.n++
+	if bu.n <= s.coalesceMax {
+		return false
+	}
+	if bu.pending == nil {
+		time.AfterFunc(bu.start.Add(s.coalesceWindow).Sub(now), func() { s.flushBurst(boardID) })
+	}
+	bu.pending = &e
+	return true
+}
+
+// flushBurst sends the single board.changed hint for a coalesced burst.
+func (s *Store) flushBurst(boardID ID) {
+	s.fanMu.Lock()
+	bu := s.bursts[boardID]
+	if bu == nil || bu.pending == nil {
+		s.fanMu.Unlock()
+		return
+	}
+	delete(s.bursts, boardID)
+	s.fanMu.Unlock()
+	fields, _ := json.Marshal(map[string]int{"coalesced": bu.n - s.coalesceMax})
+	// carry the last suppressed id so Last-Event-ID moves past the burst
+	s.fanout(boardID, Event{ID: bu.pending.ID, Type: "board.changed", Entity: "board", Op: "changed", EntityID: boardID, Fields: fields})
+}
+
+// ---- Event log (SSE resume) ----
+//
+// Each board keeps its most recent logCap events in an append-only JSON-lines
+// file next to the data file (events/<boardID>.jsonl), so clients reconnecting
+// with Last-Event-ID can catch up even across a server restart. The file is
+// compacted back to logCap entries once it grows past twice that. The files
+// are written in the background, after the in-memory log; a slow disk delays
+// them, never the change being logged.
+
+func (s *Store) eventLogPath(boardID ID) string {
+	return filepath.Join(filepath.Dir(s.path), "events", string(boardID)+".jsonl")
+}
+
+// eventLog returns the board's cached log, reading it from disk on first use.
+// Caller must hold s.mu for writing.
+func (s *Store) eventLog(boardID ID) []Event {
+	if hist, ok := s.logs[boardID]; ok {
+		return hist
+	}
+	var hist []Event
+	if !s.persist {
+		s.logs[boardID] = hist
+		return hist
+	}
+	if f, err := os.Open(s.eventLogPath(boardID)); err == nil {
+		sc := bufio.NewScanner(f)
+		sc.Buffer(make([]byte, 0, 64*1024), 16<<20)
+		for sc.Scan() {
+			var e Event
+			if json.Unmarshal(sc.Bytes(), &e) == nil {
+				hist = append(hist, e)
+			}
+		}
+		f.Close()
+	}
+	s.logs[boardID] = hist
+	return hist
+}
+
+// appendEvent adds e to the board's log and queues the matching file write.
+// Caller must hold s.mu for writing.
+func (s *Store) appendEvent(boardID ID, e Event) {
+	hist := append(s.eventLog(boardID), e)
+	w := logWrite{path: s.eventLogPath(boardID), event: e}
+	if len(hist) > 2*s.logCap {
+		hist = append([]Event(nil), hist[len(hist)-s.logCap:]...)
+		w.rewrite = hist
+	}
+	s.logs[boardID] = hist
+	if !s.persist {
+		return
+	}
+	s.logMu.Lock()
+	s.logWrites = append(s.logWrites, w)
+	running := s.logWriting
+	s.logWriting = true
+	s.logMu.Unlock()
+	if !running {
+		go s.writeEventLogs()
+	}
+}
+
+// logWrite is one queued event log change: append event to the file at
+// path, or replace its contents with rewrite when compacting.
+type logWrite struct {
+	path    string
+	event   Event
+	rewrite []Event
+}
+
+// writeEventLogs applies queued log writes in order until the queue is
+// empty. It takes turns with data file writes (s.writing), so the two never
+// compete for the disk.
+func (s *Store) writeEventLogs() {
+	for {
+		s.logMu.Lock()
+		batch := s.logWrites
+		s.logWrites = nil
+		if len(batch) == 0 {
+			s.logWriting = false
+			s.logMu.Unlock()
+			return
+		}
+		s.logMu.Unlock()
+		s.writing <- struct{}{}
+		for _, w := range batch {
+			if err := w.apply(); err != nil {
+				log.Printf("event log %s: %v", w.path, err)
+			}
+		}
+		<-s.writing
+	}
+}
+
+func (w logWrite) apply() error {
+	if err := os.MkdirAll(filepath.Dir(w.path), 0o755); err != nil {
+		return err
+	}
+	if w.rewrite != nil {
+		return writeEventLog(w.path, w.rewrite)
+	}
+	f, err := os.OpenFile(w.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	line, _ := json.Marshal(w.event)
+	_, err = f.Write(append(line, '\n'))
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// writeEventLog rewrites a log file atomically with the given entries.
+func writeEventLog(path string, hist []Event) error {
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(f)
+	for _, e := range hist {
+		if err := enc.Encode(e); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	f.Close()
+	return os.Rename(tmp, path)
+}
+
+// eventsSince returns logged events with an id greater than last, limited to
+// the retention window, plus the oldest and newest ids still available for
+// replay (0 when the log is empty). Caller must hold s.mu for writing.
+func (s *Store) eventsSince(boardID ID, last int64) (missed []Event, oldest, newest int64) {
+	hist := s.eventLog(boardID)
+	if len(hist) > s.logCap {
+		hist = hist[len(hist)-s.logCap:]
+	}
+	missed = []Event{}
+	for _, e := range hist {
+		if e.ID > last {
+			missed = append(missed, e)
+		}
+	}
+	if len(hist) > 0 {
+		oldest, newest = hist[0].ID, hist[len(hist)-1].ID
+	}
+	return missed, oldest, newest
+}
+
+// subscribe registers a live subscriber for boardID; cancel unregisters it.
+// It fails with errTooManyStreams when a connection cap is reached.
+func (s *Store) subscribe(boardID ID) (sub *subscriber, cancel func(), err error) {
+	sub = &subscriber{ch: make(chan Event, s.subBuf), resync: make(chan struct{}, 1)}
+	s.subMu.Lock()
+	if sseBoardLimit > 0 && len(s.streams[boardID]) >= sseBoardLimit {
+		s.subMu.Unlock()
+		return nil, nil, errTooManyStreams
+	}
+	if n := sseOpen.Add(1); sseLimit > 0 && n > int64(sseLimit) {
+		sseOpen.Add(-1)
+		s.subMu.Unlock()
+		return nil, nil, errTooManyStreams
+	}
+	if s.streams[boardID] == nil {
+		s.streams[boardID] = map[*subscriber]struct{}{}
+	}
+	s.streams[boardID][sub] = struct{}{}
+	s.subMu.Unlock()
+	return sub, func() {
+		s.subMu.Lock()
+		delete(s.streams[boardID], sub)
+		close(sub.ch)
+		s.subMu.Unlock()
+		sseOpen.Add(-1)
+		if n := sub.dropped.Load(); n > 0 {
+			log.Printf("sse board %s: subscriber dropped %d events", boardID, n)
+		}
+	}, nil
+}
+
+// ---- Idempotent list creation ----
+
+// listKeyTTL is how long a list creation key is remembered. Keys live in
+// memory only: they cover client retries, not restarts.
+const listKeyTTL = 24 * time.Hour
+
+type listKey struct {
+	boardID ID
+	key     string
+}
+
+type keyedList struct {
+	listID  ID
+	expires time.Time
+}
+
+// keyedList returns the list created earlier on boardID with key, or nil if
+// there is none (never seen, expired, or the list is gone). Expired keys
+// are swept on the way. Caller holds s.mu for writing.
+func (s *Store) keyedList(boardID ID, key string) *List {
+	now := time.Now()
+	for k, v := range s.listKeys {
+		if now.After(v.expires) {
+			delete(s.listKeys, k)
+		}
+	}
+	v, ok := s.listKeys[listKey{boardID, key}]
+	if !ok {
+		return nil
+	}
+	return findList(s.boards[boardID], v.listID)
+}
+
+// ---- Board passwords ----
+//
+// Hashes are bcrypt and live in passwords.json next to the data file.
+
+const (
+	passwordCost = bcrypt.DefaultCost
+	unlockTTL    = time.Hour
+)
+
+// errPasswordTooLong: bcrypt only reads the first 72 bytes.
+var errPasswordTooLong = errors.New("password must be at most 72 bytes")
+
+type unlockToken struct {
+	boardID ID
+	expires time.Time
+}
+
+func (s *Store) passwordsPath() string {
+	return filepath.Join(filepath.Dir(s.path), "passwords.json")
+}
+
+// loadPasswords reads the password file. Caller holds s.mu for writing.
+func (s *Store) loadPasswords() error {
+	data, err := os.ReadFile(s.passwordsPath())
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, &s.passwords)
+}
+
+// savePasswords writes the password file. Caller holds s.mu.
+func (s *Store) savePasswords() error {
+	if !s.persist {
+		return nil
+	}
+	data, _ := json.Marshal(s.passwords)
+	if err := os.MkdirAll(filepath.Dir(s.path), 0o755); err != nil {
+		return err
+	}
+	tmp := s.passwordsPath() + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.passwordsPath())
+}
+
+func hashPassword(password string) (string, error) {
+	if len(password) > 72 {
+		return "", errPasswordTooLong
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), passwordCost)
+	return string(hash), err
+}
+
+func checkPassword(hash, password string) bool {
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+}
+
+// issueToken grants access to a board for unlockTTL. Caller holds s.mu for
+// writing.
+func (s *Store) issueToken(boardID ID) (string, time.Time) {
+	now := time.Now()
+	for t, g := range s.tokens {
+		if now.After(g.expires) {
+			delete(s.tokens, t)
+		}
+	}
+	raw := make([]byte, 24)
+	_, _ = crand.Read(raw)
+	token := base64.RawURLEncoding.EncodeToString(raw)
+	exp := now.Add(unlockTTL).UTC()
+	s.tokens[token] = unlockToken{boardID: boardID, expires: exp}
+	return token, exp
+}
+
+// unlocked reports whether r may access boardID: the board is unprotected,
+// or r carries a valid X-Board-Token (or ?token=) or X-Board-Password.
+func (s *Store) unlocked(boardID ID, r *http.Request) bool {
+	s.mu.RLock()
+	hash := s.passwords[boardID]
+	token := r.Header.Get("X-Board-Token")
+	if token == "" {
+		token = r.URL.Query().Get("token")
+	}
+	g, ok := s.tokens[token]
+	s.mu.RUnlock()
+	if hash == "" {
+		return true
+	}
+	if ok && g.boardID == boardID && time.Now().Before(g.expires) {
+		return true
+	}
+	pw := r.Header.Get("X-Board-Password")
+	return pw != "" && checkPassword(hash, pw)
+}
+
+// ==== Helpers ====
+
+// streamThreshold is the response size (bytes) above which writeJSON stops
+// buffering and streams the rest (KANBAN_STREAM_THRESHOLD).
+var streamThreshold = 1 << 20
+
+// writeJSON buffers small responses so they go out with a Content-Length and
+// an encoding failure can still become a 500. Once a response outgrows
+// streamThreshold it is streamed instead; a failure past that point can only
+// be logged (the status is already sent).
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	sw := &spillWriter{w: w, code: code, limit: streamThreshold}
+	enc := json.NewEncoder(sw)
+	if pw, ok := w.(*prettyWriter); ok && pw.pretty {
+		enc.SetIndent("", "  ")
+	}
+	err := enc.Encode(v)
+	switch {
+	case err != nil && sw.spilled:
+		log.Printf("writeJSON: response truncated mid-stream: %v", err)
+	case err != nil:
+		log.Printf("writeJSON: encode failed: %v", err)
+		w.WriteHeader(500)
+		w.Write([]byte(`{"error":"internal server error"}` + "\n"))
+	case !sw.spilled:
+		w.Header().Set("Content-Length", strconv.Itoa(sw.buf.Len()))
+		w.WriteHeader(code)
+		w.Write(sw.buf.Bytes())
+	}
+}
+
+// prettyWriter marks a response for indented JSON; see prettyResponses.
+type prettyWriter struct {
+	http.ResponseWriter
+	pretty bool
+}
+
+func (pw *prettyWriter) Flush() {
+	if f, ok := pw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (pw *prettyWriter) Unwrap() http.ResponseWriter { return pw.ResponseWriter }
+
+// prettyResponses indents JSON bodies of GET requests carrying ?pretty=true,
+// for reading responses by hand. Responses are compact otherwise.
+func prettyResponses(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet && r.URL.Query().Get("pretty") == "true" {
+			w = &prettyWriter{ResponseWriter: w, pretty: true}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// spillWriter buffers up to limit bytes, then sends the header and everything
+// buffered so far and passes further writes straight through.
+type spillWriter struct {
+	w       http.ResponseWriter
+	code    int
+	limit   int
+	buf     bytes.Buffer
+	spilled bool
+}
+
+func (sw *spillWriter) Write(p []byte) (int, error) {
+	if sw.spilled {
+		return sw.w.Write(p)
+	}
+	if sw.buf.Len()+len(p) <= sw.limit {
+		return sw.buf.Write(p)
+	}
+	sw.spilled = true
+	sw.w.WriteHeader(sw.code)
+	if _, err := sw.w.Write(sw.buf.Bytes()); err != nil {
+		return 0, err
+	}
+	sw.buf.Reset()
+	return sw.w.Write(p)
+}
+
+// errBatchTooLarge rejects a batch request with more items than maxBatch.
+var errBatchTooLarge = errors.New("too many items in one request")
+
+// decodeBatch reads a JSON object from body and returns its field array of
+// ids. Other members are decoded into the matching entry of extra, if any,
+// and skipped otherwise. Items are counted while decoding, so an oversized
+// batch is refused at item max+1 without reading (or buffering) the rest of
+// the body. max <= 0 means no limit. A missing field yields nil; an empty
+// array yields an empty, non-nil slice.
+func decodeBatch(body io.Reader, field string, max int, extra map[string]any) ([]ID, error) {
+	dec := json.NewDecoder(body)
+	if t, err := dec.Token(); err != nil || t != json.Delim('{') {
+		return nil, errors.New("expected a JSON object")
+	}
+	var ids []ID
+	for dec.More() {
+		t, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		if key, _ := t.(string); key != field {
+			var dst any = new(json.RawMessage)
+			if v, ok := extra[key]; ok {
+				dst = v
+			}
+			if err := dec.Decode(dst); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if t, err := dec.Token(); err != nil || t != json.Delim('[') {
+			return nil, fmt.Errorf("%s must be an array", field)
+		}
+		ids = []ID{}
+		for dec.More() {
+			if max > 0 && len(ids) == max {
+				return nil, fmt.Errorf("%w: %s takes at most %d", errBatchTooLarge, field, max)
+			}
+			var id ID
+			if err := dec.Decode(&id); err != nil {
+				return nil, err
+			}
+			ids = append(ids, id)
+		}
+		if _, err := dec.Token(); err != nil {
+			return nil, err
+		}
+	}
+	return ids, nil
+}
+
+// parseID reads an ID from a URL or string field. Numbers are normalised,
+// so "042" finds the same thing as 42.
+func parseID(s string) ID {
+	if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+		if n <= 0 {
+			return ""
+		}
+		return ID(strconv.FormatInt(n, 10))
+	}
+	return ID(s)
+}
+
+// validateSchedule checks the start/due/estimate combination of a card.
+// It returns an error message, or "" when the values are acceptable.
+func validateSchedule(start, due *time.Time, estimate float64) string {
+	if start != nil && due != nil && start.After(*due) {
+		return "start must not be after due"
+	}
+	if estimate < 0 {
+		return "estimateHours must be >= 0"
+	}
+	return ""
+}
+
+// dueError checks a due date a client sent against the optional sanity
+// bounds (KANBAN_DUE_MIN_YEAR, KANBAN_DUE_MAX_YEARS), which catch epoch-0
+// and other garbage timestamps. It returns an error message naming the
+// allowed range, or "".
+func (s *Store) dueError(due *time.Time) string {
+	if due == nil || (s.cfg.DueMinYear == 0 && s.cfg.DueMaxYears == 0) {
+		return ""
+	}
+	var earliest, latest time.Time
+	if s.cfg.DueMinYear > 0 {
+		earliest = time.Date(s.cfg.DueMinYear, time.January, 1, 0, 0, 0, 0, time.UTC)
+	}
+	if s.cfg.DueMaxYears > 0 {
+		latest = time.Now().UTC().AddDate(s.cfg.DueMaxYears, 0, 0)
+	}
+	if (earliest.IsZero() || !due.Before(earliest)) && (latest.IsZero() || !due.After(latest)) {
+		return ""
+	}
+	switch {
+	case latest.IsZero():
+		return "due must not be before " + earliest.Format(time.RFC3339)
+	case earliest.IsZero():
+		return "due must not be after " + latest.Format(time.RFC3339)
+	}
+	return "due must be between " + earliest.Format(time.RFC3339) + " and " + latest.Format(time.RFC3339)
+}
+
+// requestTZ is the client's zone for day-based bucketing: ?tz, else the
+// X-Timezone header, else UTC. Accepts what parseTZ does.
+func requestTZ(r *http.Request) (*time.Location, error) {
+	tz := r.URL.Query().Get("tz")
+	if tz == "" {
+		tz = r.Header.Get("X-Timezone")
+	}
+	if tz == "" {
+		return time.UTC, nil
+	}
+	return parseTZ(tz)
+}
+
+// inUTC returns a UTC copy of t (nil stays nil). Card times are stored in
+// UTC whatever offset the client sent.
+func inUTC(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	u := t.UTC()
+	return &u
+}
+
+// parseTZ accepts a UTC offset ("+02:00", "-0530", "Z") or an IANA zone name.
+func parseTZ(tz string) (*time.Location, error) {
+	if strings.HasPrefix(tz, " ") {
+		tz = "+" + tz[1:] // an unescaped '+' in a query string arrives as a space
+	}
+	for _, layout := range []string{"Z07:00", "Z0700"} {
+		if t, err := time.Parse(layout, tz); err == nil {
+			_, off := t.Zone()
+			return time.FixedZone(tz, off), nil
+		}
+	}
+	return time.LoadLocation(tz)
+}
+
+// normalizeLists sorts a board's lists by Position and renumbers them 0..n-1,
+// healing duplicate or gapped positions from imported or hand-edited files.
+func normalizeLists(b *Board) {
+	sort.SliceStable(b.Lists, func(i, j int) bool { return b.Lists[i].Position < b.Lists[j].Position })
+	for i := range b.Lists {
+		b.Lists[i].Position = i
+	}
+}
+
+// normalizeBoard applies normalizeLists and does the same for every list's
+// cards (see reindex for how ranks follow).
+func normalizeBoard(b *Board) {
+	normalizeLists(b)
+	for i := range b.Lists {
+		l := &b.Lists[i]
+		sort.SliceStable(l.Cards, func(x, y int) bool { return l.Cards[x].Position < l.Cards[y].Position })
+		reindex(l)
+		// cards from before timestamps: the id encodes the creation time
+		for j := range l.Cards {
+			c := &l.Cards[j]
+			if c.CreatedAt.IsZero() {
+				c.CreatedAt = c.ID.timestamp().UTC()
+			}
+			if c.UpdatedAt.IsZero() {
+				c.UpdatedAt = c.CreatedAt
+			}
+			if c.ListEnteredAt.IsZero() {
+				c.ListEnteredAt = c.CreatedAt // best guess for older cards
+			}
+			c.Due, c.Start = inUTC(c.Due), inUTC(c.Start) // older files kept client offsets
+		}
+	}
+	numberCards(b)
+}
+
+// nextCardNumber hands out b's next card number. The counter only moves
+// forward, so numbers of deleted cards are never reused.
+func nextCardNumber(b *Board) int {
+	b.NextCardNumber = max(b.NextCardNumber, 1)
+	n := b.NextCardNumber
+	b.NextCardNumber++
+	return n
+}
+
+// numberCards raises b's counter above every number in use and numbers the
+// cards from before numbering existed, archived ones included.
+func numberCards(b *Board) {
+	for _, l := range b.Lists {
+		for _, c := range l.Cards {
+			b.NextCardNumber = max(b.NextCardNumber, c.Number+1)
+		}
+	}
+	for _, c := range b.Archive {
+		b.NextCardNumber = max(b.NextCardNumber, c.Number+1)
+	}
+	for i := range b.Lists {
+		for j := range b.Lists[i].Cards {
+			if c := &b.Lists[i].Cards[j]; c.Number == 0 {
+				c.Number = nextCardNumber(b)
+			}
+		}
+	}
+	for i := range b.Archive {
+		if c := &b.Archive[i]; c.Number == 0 {
+			c.Number = nextCardNumber(b)
+		}
+	}
+}
+
+// prefixPattern: short upper-case project keys such as "PROJ" or "OPS2".
+var prefixPattern = regexp.MustCompile(`^[A-Z][A-Z0-9]{0,9}$`)
+
+// maxTitle caps titles, in characters (runes, so emoji and CJK count as one
+// each rather than by their UTF-8 length).
+const maxTitle = 200
+
+// titleTooLong returns the error message for an over-long title, or "".
+func titleTooLong(t string) string {
+	if utf8.RuneCountInString(t) > maxTitle {
+		return fmt.Sprintf("title exceeds %d characters", maxTitle)
+	}
+	return ""
+}
+
+// cleanTitle normalizes a title: control characters are dropped, line breaks
+// become spaces and surrounding whitespace is trimmed.
+func cleanTitle(t string) string {
+	t = strings.Map(func(r rune) rune {
+		switch {
+		case r == '\n' || r == '\r' || r == '\t':
+			return ' '
+		case unicode.IsControl(r) || r == utf8.RuneError:
+			return -1
+		}
+		return r
+	}, t)
+	return strings.TrimSpace(t)
+}
+
+// cleanDescription drops control characters other than tabs and newlines
+// (CRLF becomes LF) and trims surrounding whitespace.
+func cleanDescription(d string) string {
+	d = strings.ReplaceAll(d, "\r\n", "\n")
+	d = strings.Map(func(r rune) rune {
+		if (unicode.IsControl(r) && r != '\n' && r != '\t') || r == utf8.RuneError {
+			return -1
+		}
+		return r
+	}, d)
+	return strings.TrimSpace(d)
+}
+
+// cleanTags trims tags and drops empty and duplicate ones (case-insensitive;
+// the first spelling wins).
+func cleanTags(tags []string) []string {
+	out := []string{}
+	seen := map[string]bool{}
+	for _, t := range tags {
+		t = cleanTitle(t)
+		if k := strings.ToLower(t); t != "" && !seen[k] {
+			seen[k] = true
+			out = append(out, t)
+		}
+	}
+	return out
+}
+
+var hexColor = regexp.MustCompile(`^#(?:[0-9a-fA-F]{3}|[0-9a-fA-F]{6})$`)
+
+// validateLabel returns an error message for a bad board label, or "".
+// Every path that defines a label checks it here.
+func validateLabel(l Label) string {
+	if l.Color != "" && !hexColor.MatchString(l.Color) {
+		return "label color must be #rgb or #rrggbb"
+	}
+	return ""
+}
+
+// validateTheme returns an error message for a bad theme, or "".
+func validateTheme(t *Theme) string {
+	for name, c := range map[string]string{"primaryColor": t.PrimaryColor, "accentColor": t.AccentColor} {
+		if c != "" && !hexColor.MatchString(c) {
+			return name + " must be a hex color like #1e90ff"
+		}
+	}
+	if t.Icon != "" && !isEmoji(t.Icon) {
+		return "icon must be a single emoji"
+	}
+	return ""
+}
+
+// isEmoji loosely checks for one emoji: symbols only, plus the joiners,
+// variation selectors and modifiers that compose multi-rune emoji.
+func isEmoji(s string) bool {
+	if utf8.RuneCountInString(s) > 10 {
+		return false
+	}
+	for _, r := range s {
+		switch {
+		case unicode.In(r, unicode.So, unicode.Sk):
+		case r == 0x200d, r == 0xfe0f, r == 0x20e3: // ZWJ, VS16, keycap
+		case strings.ContainsRune("0123456789#*", r) && strings.HasSuffix(s, "\u20e3"): // keycap base ("1️⃣")
+		case r >= 0xe0020 && r <= 0xe007f: // tag sequences (subdivision flags)
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// coverError returns the error message for a bad cover URL, or "". Only
+// absolute http(s) URLs are accepted; "" (no cover) is fine.
+func coverError(u string) string {
+	if u == "" {
+		return ""
+	}
+	p, err := url.Parse(u)
+	if err != nil || (p.Scheme != "http" && p.Scheme != "https") || p.Host == "" || len(u) > 2048 {
+		return "coverUrl must be an absolute http(s) URL"
+	}
+	return ""
+}
+
+// mentionPattern finds @username; the leading group keeps e-mail addresses
+// from matching.
+var mentionPattern = regexp.MustCompile(`(?:^|[^\w@])@([\w-]+)`)
+
+// mentions returns the users @mentioned in text, de-duplicated ignoring case.
+func mentions(text string) []string {
+	var names []string
+	for _, m := range mentionPattern.FindAllStringSubmatch(text, -1) {
+		names = append(names, m[1])
+	}
+	return cleanAssignees(names)
+}
+
+// noteMentions returns the users mentioned in c's description that weren't
+// in before, adding them to the card's watchers when the board asks for it.
+func noteMentions(b *Board, c *Card, before string) []string {
+	old := map[string]bool{}
+	for _, u := range mentions(before) {
+		old[strings.ToLower(u)] = true
+	}
+	var added []string
+	for _, u := range mentions(c.Description) {
+		if !old[strings.ToLower(u)] {
+			added = append(added, u)
+		}
+	}
+	if len(added) > 0 && b.WatchMentions {
+		c.Watchers = cleanAssignees(append(c.Watchers, added...))
+	}
+	return added
+}
+
+// announceMentions broadcasts card.mention for users newly mentioned on a
+// card, as its own event after the edit that introduced them.
+func (s *Server) announceMentions(ctx context.Context, boardID, cardID ID, users []string) {
+	if len(users) == 0 {
+		return
+	}
+	s.store.mu.Lock()
+	b := s.store.boards[boardID]
+	if b == nil {
+		s.store.mu.Unlock()
+		return
+	}
+	b.Events++
+	s.store.mu.Unlock()
+	s.store.broadcast(ctx, boardID, Change{Entity: "card", Op: "mention", ID: cardID, Fields: map[string]any{"cardId": cardID, "users": users}})
+}
+
+// cleanAssignees normalizes a card's assignees like tags (trimmed, no
+// duplicates ignoring case); nil when none are left.
+func cleanAssignees(names []string) []string {
+	if out := cleanTags(names); len(out) > 0 {
+		return out
+	}
+	return nil
+}
+
+// hasTags reports whether b carries any (or, with all, every) of tags.
+func hasTags(b *Board, tags []string, all bool) bool {
+	for _, want := range tags {
+		found := false
+		for _, t := range b.Tags {
+			if strings.EqualFold(t, want) {
+				found = true
+				break
+			}
+		}
+		if found != all {
+			return found
+		}
+	}
+	return all
+}
+
+// limitDescription enforces max (in characters) on a description. Over the
+// limit it either truncates (truncate=true) or reports an error message.
+func limitDescription(desc string, max int, truncate bool) (out string, truncated bool, errMsg string) {
+	if max <= 0 || utf8.RuneCountInString(desc) <= max {
+		return desc, false, ""
+	}
+	if !truncate {
+		return desc, false, fmt.Sprintf("description exceeds %d characters (pass ?truncate=true to cut it)", max)
+	}
+	return string([]rune(desc)[:max]), true, ""
+}
+
+// validRank reports whether a client-supplied rank is usable.
+func validRank(r *float64) bool {
+	return r == nil || (!math.IsNaN(*r) && !math.IsInf(*r, 0))
+}
+
+// reindex renumbers Position after a list changed. Ranks are left alone while
+// they still increase strictly; otherwise (legacy data, bulk appends) they are
+// reset to 1..n in the current order.
+func reindex(l *List) {
+	ok := true
+	for i := range l.Cards {
+		l.Cards[i].Position = i
+		if i > 0 && l.Cards[i].Rank <= l.Cards[i-1].Rank {
+			ok = false
+		}
+	}
+	if !ok {
+		for i := range l.Cards {
+			l.Cards[i].Rank = float64(i + 1)
+		}
+	}
+}
+
+// insertCard places c in l. With a rank, the card goes where that rank sorts;
+// otherwise at pos (appended when out of range) with a rank between its
+// neighbours. Every insert counts as an update of the card (UpdatedAt).
+// Inserts run under the store lock, so concurrent requests are applied one
+// after the other; two clients sending the same rank (or a gap too narrow
+// for a float midpoint) leave the list re-ranked 1..n by reindex rather than
+// with ties.
+// Returns the card as stored.
+func insertCard(l *List, c Card, pos int, rank *float64) Card {
+	c.UpdatedAt = time.Now().UTC()
+	if c.CreatedAt.IsZero() {
+		c.CreatedAt = c.UpdatedAt
+	}
+	if c.ListEnteredAt.IsZero() {
+		c.ListEnteredAt = c.UpdatedAt
+	}
+	reindex(l)
+	n := len(l.Cards)
+	switch {
+	case rank != nil:
+		c.Rank = *rank
+		pos = sort.Search(n, func(i int) bool { return l.Cards[i].Rank > c.Rank })
+	case pos < 0 || pos >= n:
+		pos = n
+		c.Rank = 1
+		if n > 0 {
+			c.Rank = l.Cards[n-1].Rank + 1
+		}
+	case pos == 0:
+		c.Rank = l.Cards[0].Rank - 1
+	default:
+		c.Rank = (l.Cards[pos-1].Rank + l.Cards[pos].Rank) / 2
+	}
+	l.Cards = append(l.Cards, Card{})
+	copy(l.Cards[pos+1:], l.Cards[pos:])
+	l.Cards[pos] = c
+	reindex(l)
+	return l.Cards[pos]
+}
+
+// leaveList records the end of c's stay in from when it moves to another
+// list, and restarts its list clock. Call before insertCard.
+func leaveList(b *Board, from, to *List, c *Card) {
+	if from.ID == to.ID {
+		return
+	}
+	now := time.Now().UTC()
+	if b.Flow == nil {
+		b.Flow = map[ID]*FlowStat{}
+	}
+	st := b.Flow[from.ID]
+	if st == nil {
+		st = &FlowStat{}
+		b.Flow[from.ID] = st
+	}
+	st.Cards++
+	st.Seconds += int64(now.Sub(c.ListEnteredAt).Seconds())
+	c.ListEnteredAt = now
+}
+
+// addID appends id to ids unless already present.
+func addID(ids []ID, id ID) []ID {
+	for _, x := range ids {
+		if x == id {
+			return ids
+		}
+	}
+	return append(ids, id)
+}
+
+// removeID returns ids without id.
+func removeID(ids []ID, id ID) []ID {
+	out := ids[:0]
+	for _, x := range ids {
+		if x != id {
+			out = append(out, x)
+		}
+	}
+	if len(out) == 0 {
+		return nil
+	}
+	return out
+}
+
+// withExcerpts swaps each card's description for an excerpt of at most n
+// characters, in place; cards must be a copy.
+func withExcerpts(cards []Card, n int) {
+	for i := range cards {
+		c := &cards[i]
+		c.DescriptionExcerpt, c.HasMoreDescription, _ = limitDescription(c.Description, n, true)
+		c.Description = ""
+	}
+}
+
+// withAges returns a copy of cards with AgeSeconds and IdleSeconds filled in.
+func withAges(cards []Card, now time.Time) []Card {
+	if cards == nil {
+		return nil
+	}
+	out := make([]Card, len(cards))
+	for i, c := range cards {
+		c.AgeSeconds = int64(now.Sub(c.CreatedAt).Seconds())
+		c.IdleSeconds = int64(now.Sub(c.UpdatedAt).Seconds())
+		out[i] = c
+	}
+	return out
+}
+
+// cardOrder is one ?cardSort= view of a list. Cards for which has is false
+// (no due date, no priority) sort last whichever the direction.
+type cardOrder struct {
+	has  func(c *Card) bool
+	less func(a, b *Card) bool
+}
+
+var cardOrders = map[string]*cardOrder{
+	"":         nil, // position: stored order
+	"position": nil,
+	"due": {
+		has:  func(c *Card) bool { return c.Due != nil },
+		less: func(a, b *Card) bool { return a.Due.Before(*b.Due) },
+	},
+	"priority": {
+		has: func(c *Card) bool { _, ok := c.CustomFields["priority"].(float64); return ok },
+		less: func(a, b *Card) bool {
+			return a.CustomFields["priority"].(float64) < b.CustomFields["priority"].(float64)
+		},
+	},
+	"created": {less: func(a, b *Card) bool { return a.CreatedAt.Before(b.CreatedAt) }},
+	"title":   {less: func(a, b *Card) bool { return strings.ToLower(a.Title) < strings.ToLower(b.Title) }},
+}
+
+// sortCards returns a sorted copy of cards for display; the stored order is
+// untouched. Ties keep position order.
+func sortCards(cards []Card, o *cardOrder, desc bool) []Card {
+	if o == nil && !desc {
+		return cards
+	}
+	out := append([]Card(nil), cards...)
+	if o == nil {
+		slices.Reverse(out)
+		return out
+	}
+	sort.SliceStable(out, func(i, j int) bool {
+		a, b := &out[i], &out[j]
+		if o.has != nil && o.has(a) != o.has(b) {
+			return o.has(a)
+		}
+		if o.has != nil && !o.has(a) {
+			return false
+		}
+		if desc {
+			return o.less(b, a)
+		}
+		return o.less(a, b)
+	})
+	return out
+}
+
+// parseAge parses a duration that may also be given in days ("7d", "1.5d").
+func parseAge(v string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(v, "d"); ok {
+		n, err := strconv.ParseFloat(days, 64)
+		if err != nil || n < 0 || math.IsInf(n, 0) {
+			return 0, fmt.Errorf("invalid duration %q", v)
+		}
+		return time.Duration(n * float64(24*time.Hour)), nil
+	}
+	return time.ParseDuration(v)
+}
+
+// splitOverflow partitions a list's cards for display according to MaxVisible.
+func splitOverflow(l List) List {
+	if l.MaxVisible > 0 && len(l.Cards) > l.MaxVisible {
+		l.OverflowCards = l.Cards[l.MaxVisible:]
+		l.Cards = l.Cards[:l.MaxVisible]
+	}
+	return l
+}
+
+// validateCustomFields checks card values against the board's field
+// definitions. A nil value is allowed (it clears the field on update).
+func validateCustomFields(b *Board, vals map[string]any) string {
+	for name, v := range vals {
+		var def *FieldDef
+		for i := range b.Fields {
+			if b.Fields[i].Name == name {
+				def = &b.Fields[i]
+				break
+			}
+		}
+		if def == nil {
+			return "unknown custom field " + strconv.Quote(name)
+		}
+		if v == nil {
+			continue
+		}
+		ok := false
+		switch def.Type {
+		case "text":
+			_, ok = v.(string)
+		case "number":
+			_, ok = v.(float64)
+		case "date":
+			if str, isStr := v.(string); isStr {
+				_, err := time.Parse(time.RFC3339, str)
+				ok = err == nil
+			}
+		case "select":
+			if str, isStr := v.(string); isStr {
+				for _, opt := range def.Options {
+					ok = ok || opt == str
+				}
+			}
+		}
+		if !ok {
+			return fmt.Sprintf("custom field %q expects a %s value", name, def.Type)
+		}
+	}
+	return ""
+}
+
+// findLabel returns the board label with the given id, or nil.
+func findLabel(b *Board, id ID) *Label {
+	for i := range b.Labels {
+		if b.Labels[i].ID == id {
+			return &b.Labels[i]
+		}
+	}
+	return nil
+}
+
+// autoColor applies AutoColorFromLabel: a card without an explicit color
+// takes its primary label's color, and loses it again with its last label.
+func autoColor(b *Board, c *Card) {
+	if !b.AutoColorFromLabel || (c.Color != "" && !c.ColorFromLabel) {
+		return
+	}
+	c.Color, c.ColorFromLabel = "", false
+	if len(c.Labels) > 0 {
+		if l := findLabel(b, c.Labels[0]); l != nil && l.Color != "" {
+			c.Color, c.ColorFromLabel = l.Color, true
+		}
+	}
+}
+
+// defaultList is where quick-added cards go: the board's DefaultListID if it
+// still exists, else the first list. Nil for a board without lists.
+func defaultList(b *Board) *List {
+	if l := findList(b, b.DefaultListID); l != nil {
+		return l
+	}
+	if len(b.Lists) == 0 {
+		return nil
+	}
+	return &b.Lists[0]
+}
+
+// unlinkCard drops every dependency reference to a deleted card.
+func unlinkCard(b *Board, id ID) {
+	for i := range b.Lists {
+		for j := range b.Lists[i].Cards {
+			c := &b.Lists[i].Cards[j]
+			c.Blocks = removeID(c.Blocks, id)
+			c.BlockedBy = removeID(c.BlockedBy, id)
+		}
+	}
+}
+
+// findCardIn returns the card with the given id in l and its index, or -1.
+func findCardIn(l *List, cardID ID) (*Card, int) {
+	for i := range l.Cards {
+		if l.Cards[i].ID == cardID {
+			return &l.Cards[i], i
+		}
+	}
+	return nil, -1
+}
+
+// findList returns the list with the given id, or nil.
+func findList(b *Board, listID ID) *List {
+	for i := range b.Lists {
+		if b.Lists[i].ID == listID {
+			return &b.Lists[i]
+		}
+	}
+	return nil
+}
+
+// findCard locates a card anywhere on the board; returns its list and index.
+func findCard(b *Board, cardID ID) (*List, int) {
+	for i := range b.Lists {
+		for j := range b.Lists[i].Cards {
+			if b.Lists[i].Cards[j].ID == cardID {
+				return &b.Lists[i], j
+			}
+		}
+	}
+	return nil, -1
+}
+
+// notFound replaces chi's plain-text 404 with the JSON error shape.
+func notFound(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, 404, map[string]string{"error": "no route for " + r.URL.Path})
+}
+
+// methodNotAllowed replaces chi's plain-text 405 with the JSON error shape.
+func methodNotAllowed(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, 405, map[string]string{"error": "method " + r.Method + " not allowed on " + r.URL.Path})
+}
+
+//go:embed ui
+var uiFiles embed.FS
+
+// uiRoutes serves the bundled web UI at /app and redirects / there. The UI
+// has a prefix of its own, so no API or SSE route can be shadowed by a file.
+func uiRoutes(r chi.Router) {
+	files, _ := fs.Sub(uiFiles, "ui") // only fails for an invalid path
+	r.Get("/", func(w http.ResponseWriter, r *http.Request) { http.Redirect(w, r, "/app", http.StatusFound) })
+	// StripSlashes turns "/app/" into "/app"
+	r.Get("/app", func(w http.ResponseWriter, r *http.Request) { http.ServeFileFS(w, r, files, "index.html") })
+	r.Handle("/app/*", http.StripPrefix("/app/", http.FileServerFS(files)))
+}
+
+// recoverJSON turns a handler panic into a logged stack trace and a JSON 500,
+// keeping the server (and other connections) alive. If the handler had
+// already started its response, the status can't change and a JSON body
+// would corrupt what was sent, so the response just ends there.
+func recoverJSON(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		defer func() {
+			rec := recover()
+			if rec == nil {
+				return
+			}
+			if rec == http.ErrAbortHandler {
+				panic(rec) // let net/http abort the response as intended
+			}
+			log.Printf("panic [%s] %s %s: %v\n%s", middleware.GetReqID(r.Context()), r.Method, r.URL.Path, rec, debug.Stack())
+			if ww.Status() != 0 {
+				return // headers are out; nothing sensible left to send
+			}
+			writeJSON(ww, 500, map[string]string{"error": "internal server error"})
+		}()
+		next.ServeHTTP(ww, r)
+	})
+}
+
+// ==== Tracing ====
+
+// tracerName is the instrumentation scope of the spans made here.
+const tracerName = "github.com/saloneepathan/kanban-lite"
+
+// startSpan starts a span as a child of the one in ctx, if any. Spans come
+// from the global OpenTelemetry provider: a no-op until setupTracing
+// installs the SDK, so untraced servers pay next to nothing.
+func startSpan(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer(tracerName).Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// endSpan ends sp, marking it failed when err is non-nil.
+func endSpan(sp trace.Span, err error) {
+	if err != nil {
+		sp.RecordError(err)
+		sp.SetStatus(codes.Error, err.Error())
+	}
+	sp.End()
+}
+
+// setupTracing installs the OpenTelemetry SDK: spans are batched and
+// exported over OTLP/HTTP to cfg.OTLPEndpoint, and incoming W3C traceparent
+// headers continue the caller's trace. shutdown flushes what is pending.
+func setupTracing(ctx context.Context, cfg Config) (shutdown func(context.Context) error, err error) {
+	exp, err := otlptracehttp.New(ctx, otlptracehttp.WithEndpointURL(cfg.OTLPEndpoint))
+	if err != nil {
+		return nil, err
+	}
+	res, err := resource.Merge(resource.Default(), resource.NewSchemaless(attribute.String("service.name", cfg.ServiceName)))
+	if err != nil {
+		return nil, err
+	}
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exp, sdktrace.WithBatchTimeout(5*time.Second)),
+		sdktrace.WithResource(res),
+	)
+	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	return tp.Shutdown, nil
+}
+
+// traceRequests wraps each request in an otelhttp server span (continuing
+// an incoming traceparent), named after the chi route once it has matched
+// and tagged with the request ID. It is only installed when tracing is on.
+func traceRequests(next http.Handler) http.Handler {
+	named := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r)
+		sp := trace.SpanFromContext(r.Context())
+		sp.SetAttributes(attribute.String("request.id", middleware.GetReqID(r.Context())))
+		if rc := chi.RouteContext(r.Context()); rc != nil && rc.RoutePattern() != "" {
+			sp.SetName(r.Method + " " + rc.RoutePattern())
+			sp.SetAttributes(attribute.String("http.route", rc.RoutePattern()))
+		}
+	})
+	return otelhttp.NewHandler(named, "http.server", otelhttp.WithSpanNameFormatter(func(_ string, r *http.Request) string {
+		return r.Method + " " + r.URL.Path
+	}))
+}
+
+// ==== Workspaces ====
+//
+// A workspace is an independent board set with its own Store and data file,
+// addressed as /w/{name}/boards/... or with ?workspace=name. Stores are opened
+// lazily on first use and cached. Layout, next to the default data file:
+//
+//	data/kanban.json                          default workspace
+//	data/workspaces/<name>/kanban.json        named workspace
+//	data/workspaces/<name>/events/<id>.jsonl  its SSE event logs
+
+var workspaceName = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,63}$`)
+
+type Workspaces struct {
+	mu   sync.Mutex
+	base *Store // the default store; workspaces copy its settings
+	open map[string]http.Handler
+}
+
+func NewWorkspaces(base *Store) *Workspaces {
+	return &Workspaces{base: base, open: map[string]http.Handler{}}
+}
+
+// handler returns the cached router for a workspace, opening its store on
+// first use.
+func (ws *Workspaces) handler(name string) (http.Handler, error) {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	if h, ok := ws.open[name]; ok {
+		return h, nil
+	}
+	dir := filepath.Join(filepath.Dir(ws.base.path), "workspaces", name)
+	store := ws.base.withPath(filepath.Join(dir, filepath.Base(ws.base.path)))
+	if err := store.load(context.Background()); err != nil {
+		return nil, err
+	}
+	go store.dueRules(time.Minute)
+	r := chi.NewRouter()
+	r.NotFound(notFound)
+	r.MethodNotAllowed(methodNotAllowed)
+	r.Use(NewServer(store).ready, NewServer(store).writable)
+	apiRoutes(r, store)
+	ws.open[name] = r
+	return r, nil
+}
+
+func (ws *Workspaces) serve(name string, w http.ResponseWriter, r *http.Request) {
+	if !workspaceName.MatchString(name) {
+		writeJSON(w, 400, map[string]string{"error": "workspace names are 1-64 chars of a-z, 0-9, '-' and '_'"})
+		return
+	}
+	h, err := ws.handler(name)
+	if err != nil {
+		log.Printf("workspace %s: %v", name, err)
+		writeJSON(w, 500, map[string]string{"error": "workspace unavailable"})
+		return
+	}
+	h.ServeHTTP(w, r)
+}
+
+// ServeHTTP handles the /w/{workspace} mount.
+func (ws *Workspaces) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ws.serve(chi.URLParam(r, "workspace"), w, r)
+}
+
+// selectByQuery routes requests carrying ?workspace=name to that workspace.
+func (ws *Workspaces) selectByQuery(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if name := r.URL.Query().Get("workspace"); name != "" {
+			ws.serve(name, w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// ==== HTTP Handlers ====
+
+type Server struct{ store *Store }
+
+func NewServer(store *Store) *Server { return &Server{store: store} }
+
+// ready holds off every request with 503 until the store has loaded.
+func (s *Server) ready(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !s.store.loaded.Load() {
+			w.Header().Set("Retry-After", "1")
+			writeJSON(w, 503, map[string]string{"error": "server is starting; try again shortly"})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// What this server supports and its configured limits, so clients can adapt
+// (0 means unlimited). Cheap and unauthenticated; extend it with new features.
+func (s *Server) capabilities(w http.ResponseWriter, r *http.Request) {
+	cfg := s.store.cfg
+	writeJSON(w, 200, map[string]any{
+		"version": 1,
+		"limits": map[string]any{
+			"maxTitleLength":       maxTitle,
+			"maxDescriptionLength": cfg.MaxDescription,
+			"descriptionExcerpt":   cfg.ExcerptLength,
+			"maxBatch":             cfg.MaxBatch,
+			"maxBoards":            0,
+			"sseReplayEvents":      cfg.EventLogSize,
+			"sseMaxConnections":    cfg.SSEMax,
+			"sseMaxPerBoard":       cfg.SSEMaxPerBoard,
+			"activityPageSize":     maxActivityPage,
+			"eventHistoryPageSize": maxHistoryPage,
+			"snapshotsPerBoard":    maxSnapshots,
+			"dueMinYear":           cfg.DueMinYear,
+			"dueMaxYears":          cfg.DueMaxYears,
+		},
+		"features": map[string]bool{
+			"archive":          true,
+			"automationRules":  true,
+			"boardPasswords":   true,
+			"adminApi":         cfg.AdminToken != "",
+			"persistence":      cfg.Persist,
+			"encryptionAtRest": cfg.EncryptionKey != "",
+			"tracing":          cfg.OTLPEndpoint != "",
+			"tls":              cfg.TLSCert != "",
+			"workspaces":       true,
+			"cardTemplates":    true,
+			"mentions":         true,
+			"cardCovers":       true,
+			"eventHistory":     true,
+			"icsExport":        true,
+			"moveHook":         len(cfg.MoveHookAllow) > 0,
+			"snapshots":        true,
+			"excerpts":         true,
+			"webUi":            cfg.ServeUI,
+			"uuidIds":          cfg.IDStrategy == "uuid",
+			"wipLimits":        false,
+		},
+	})
+}
+
+// Health
+func (s *Server) health(w http.ResponseWriter, r *http.Request) { w.Write([]byte("ok")) }
+
+// Create board
+func (s *Server) createBoard(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Title          string   `json:"title"`
+		DefaultDueDays int      `json:"defaultDueDays"`
+		Tags           []string `json:"tags"`
+		ClientID       string   `json:"clientId"`
+		Prefix         string   `json:"prefix"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&req)
+	req.Title = cleanTitle(req.Title)
+	if err != nil || req.Title == "" {
+		writeJSON(w, 400, map[string]string{"error": "title required"})
+		return
+	}
+	if msg := titleTooLong(req.Title); msg != "" {
+		writeJSON(w, 400, map[string]string{"error": msg})
+		return
+	}
+	if req.DefaultDueDays < 0 {
+		writeJSON(w, 400, map[string]string{"error": "defaultDueDays must be >= 0"})
+		return
+	}
+	req.ClientID = strings.ToLower(req.ClientID)
+	if req.ClientID != "" && !uuidPattern.MatchString(req.ClientID) {
+		writeJSON(w, 400, map[string]string{"error": "clientId must be a UUID"})
+		return
+	}
+	req.Prefix = strings.ToUpper(strings.TrimSpace(req.Prefix))
+	if req.Prefix != "" && !prefixPattern.MatchString(req.Prefix) {
+		writeJSON(w, 400, map[string]string{"error": "prefix must be 1-10 letters or digits, starting with a letter"})
+		return
+	}
+	now := time.Now()
+	b := &Board{ID: newID(), Title: req.Title, Lists: []List{}, DefaultDueDays: req.DefaultDueDays, LastActivityAt: now.UTC(), ClientID: req.ClientID, Prefix: req.Prefix, NextCardNumber: 1}
+	if len(req.Tags) > 0 {
+		b.Tags = cleanTags(req.Tags)
+	}
+
+	s.store.mu.Lock()
+	if id, ok := s.store.clientIDs[b.ClientID]; ok && b.ClientID != "" {
+		// already synced: hand back the existing board
+		out := *s.store.boards[id]
+		if out.Protected {
+			out = Board{ID: out.ID, Title: out.Title, Slug: out.Slug, Lists: []List{}, ClientID: out.ClientID, Protected: true}
+		}
+		s.store.mu.Unlock()
+		writeJSON(w, 200, out)
+		return
+	}
+	s.store.boards[b.ID] = b
+	s.store.assignSlug(b)
+	if b.ClientID != "" {
+		s.store.clientIDs[b.ClientID] = b.ID
+	}
+	out := *b // b is shared once stored
+	s.store.mu.Unlock()
+	saveErr := s.store.save(r.Context())
+
+	w.Header().Set("Location", strings.TrimSuffix(r.URL.Path, "/")+"/"+string(out.ID))
+	if saveFailed(w, saveErr) {
+		return
+	}
+	writeJSON(w, 201, out)
+}
+
+// boardOrders are the ?order= values for listBoards. Board ids are creation
+// times, so they order by creation; ties fall back to the id so the order
+// is stable across requests.
+var boardOrders = map[string]func(a, b *Board) int{
+	"created":  func(a, b *Board) int { return compareIDs(a.ID, b.ID) },
+	"-created": func(a, b *Board) int { return compareIDs(b.ID, a.ID) },
+	"title": func(a, b *Board) int {
+		return cmp.Or(cmp.Compare(strings.ToLower(a.Title), strings.ToLower(b.Title)), compareIDs(a.ID, b.ID))
+	},
+	"-title": func(a, b *Board) int {
+		return cmp.Or(cmp.Compare(strings.ToLower(b.Title), strings.ToLower(a.Title)), compareIDs(a.ID, b.ID))
+	},
+	// most recently active first
+	"activity": func(a, b *Board) int {
+		return cmp.Or(b.LastActivityAt.Compare(a.LastActivityAt), compareIDs(a.ID, b.ID))
+	},
+}
+
+// List boards, newest first; closed boards only with ?includeClosed=true.
+// ?tag=a&tag=b keeps boards with any of the tags (all of them with
+// ?tagMode=and). ?order= picks another order, see boardOrders.
+func (s *Server) listBoards(w http.ResponseWriter, r *http.Request) {
+	order := boardOrders["-created"]
+	if v := r.URL.Query().Get("order"); v != "" {
+		if order = boardOrders[v]; order == nil {
+			writeJSON(w, 400, map[string]string{"error": "order must be created, -created, title, -title or activity"})
+			return
+		}
+	}
+	includeClosed := r.URL.Query().Get("includeClosed") == "true"
+	tags := r.URL.Query()["tag"]
+	allTags := r.URL.Query().Get("tagMode") == "and"
+	s.store.mu.RLock()
+	out := make([]*Board, 0, len(s.store.boards))
+	for _, b := range s.store.boards {
+		if b.Closed && !includeClosed {
+			continue
+		}
+		if len(tags) > 0 && !hasTags(b, tags, allTags) {
+			continue
+		}
+		if b.Protected {
+			// name only; the content needs the password
+			b = &Board{ID: b.ID, Title: b.Title, Slug: b.Slug, Lists: []List{}, Closed: b.Closed, LastActivityAt: b.LastActivityAt, Tags: b.Tags, Protected: true, Theme: b.Theme}
+		}
+		out = append(out, b)
+	}
+	slices.SortFunc(out, order) // LastActivityAt is written under the lock
+	s.store.mu.RUnlock()
+	writeJSON(w, 200, out)
+}
+
+// Update board settings (title, defaultDueDays); omitted fields are unchanged
+func (s *Server) updateBoard(w http.ResponseWriter, r *http.Request) {
+	boardID := s.store.boardRef(chi.URLParam(r, "boardID"))
+	var req struct {
+		Title              *string   `json:"title"`
+		DefaultDueDays     *int      `json:"defaultDueDays"`
+		AutoColorFromLabel *bool     `json:"autoColorFromLabel"`
+		DefaultListID      *ID       `json:"defaultListId"`
+		Tags               *[]string `json:"tags"`
+		Theme              *Theme    `json:"theme"` // replaces; {} clears
+		WatchMentions      *bool     `json:"watchMentions"`
+		Prefix             *string   `json:"prefix"`   // "" clears
+		MoveHook           *MoveHook `json:"moveHook"` // replaces; {} clears
+	}
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if req.Title != nil {
+		*req.Title = cleanTitle(*req.Title)
+	}
+	if err != nil || (req.Title != nil && *req.Title == "") {
+		writeJSON(w, 400, map[string]string{"error": "bad request"})
+		return
+	}
+	if req.Title != nil && titleTooLong(*req.Title) != "" {
+		writeJSON(w, 400, map[string]string{"error": titleTooLong(*req.Title)})
+		return
+	}
+	if req.DefaultDueDays != nil && *req.DefaultDueDays < 0 {
+		writeJSON(w, 400, map[string]string{"error": "defaultDueDays must be >= 0"})
+		return
+	}
+	if req.Theme != nil {
+		if msg := validateTheme(req.Theme); msg != "" {
+			writeJSON(w, 400, map[string]string{"error": msg})
+			return
+		}
+	}
+	if req.MoveHook != nil && req.MoveHook.URL != "" {
+		if p, err := url.Parse(req.MoveHook.URL); err != nil || (p.Scheme != "http" && p.Scheme != "https") || p.Host == "" {
+			writeJSON(w, 400, map[string]string{"error": "moveHook url must be an absolute http(s) URL"})
+			return
+		}
+		if !s.store.hookAllowed(req.MoveHook.URL) {
+			writeJSON(w, 403, map[string]string{"error": "moveHook url is not allowed on this server (see KANBAN_MOVE_HOOK_ALLOW)"})
+			return
+		}
+	}
+	if req.Prefix != nil {
+		*req.Prefix = strings.ToUpper(strings.TrimSpace(*req.Prefix))
+		if *req.Prefix != "" && !prefixPattern.MatchString(*req.Prefix) {
+			writeJSON(w, 400, map[string]string{"error": "prefix must be 1-10 letters or digits, starting with a letter"})
+			return
+		}
+	}
+
+	s.store.mu.Lock()
+	b := s.store.boards[boardID]
+	if b == nil {
+		s.store.mu.Unlock()
+		writeJSON(w, 404, map[string]string{"error": "board not found"})
+		return
+	}
+	if b.Closed {
+		s.store.mu.Unlock()
+		writeJSON(w, 409, map[string]string{"error": "board is closed"})
+		return
+	}
+	if req.DefaultListID != nil && *req.DefaultListID != "" && findList(b, *req.DefaultListID) == nil {
+		s.store.mu.Unlock()
+		writeJSON(w, 400, map[string]string{"error": "defaultListId is not a list on this board"})
+		return
+	}
+	changed := map[string]any{}
+	if req.Title != nil {
+		b.Title = *req.Title
+		changed["title"] = b.Title
+	}
+	if req.DefaultDueDays != nil {
+		b.DefaultDueDays = *req.DefaultDueDays
+		changed["defaultDueDays"] = b.DefaultDueDays
+	}
+	if req.AutoColorFromLabel != nil {
+		b.AutoColorFromLabel = *req.AutoColorFromLabel
+		changed["autoColorFromLabel"] = b.AutoColorFromLabel
+	}
+	if req.DefaultListID != nil {
+		b.DefaultListID = *req.DefaultListID
+		changed["defaultListId"] = b.DefaultListID
+	}
+	if req.Tags != nil {
+		b.Tags = cleanTags(*req.Tags)
+		changed["tags"] = b.Tags
+	}
+	if req.Theme != nil {
+		b.Theme = req.Theme
+		if *b.Theme == (Theme{}) {
+			b.Theme = nil
+		}
+		changed["theme"] = b.Theme
+	}
+	if req.WatchMentions != nil {
+		b.WatchMentions = *req.WatchMentions
+		changed["watchMentions"] = b.WatchMentions
+	}
+	if req.Prefix != nil {
+		b.Prefix = *req.Prefix
+		changed["prefix"] = b.Prefix
+	}
+	if req.MoveHook != nil {
+		b.MoveHook = req.MoveHook
+		if b.MoveHook.URL == "" {
+			b.MoveHook = nil
+		}
+		changed["moveHook"] = b.MoveHook
+	}
+	b.Events++
+	upd := map[string]any{"id": b.ID, "title": b.Title, "defaultDueDays": b.DefaultDueDays, "autoColorFromLabel": b.AutoColorFromLabel, "defaultListId": b.DefaultListID, "tags": b.Tags, "theme": b.Theme, "watchMentions": b.WatchMentions, "prefix": b.Prefix, "moveHook": b.MoveHook}
+	s.store.mu.Unlock()
+	saveErr := s.store.save(r.Context())
+
+	s.store.broadcast(r.Context(), boardID, Change{Entity: "board", Op: "updated", ID: boardID, Fields: changed, Object: upd})
+	if saveFailed(w, saveErr) {
+		return
+	}
+	writeJSON(w, 200, upd)
+}
+
+// requireUnlock rejects requests for a protected board that carry neither a
+// valid unlock token nor the password.
+func (s *Server) requireUnlock(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !s.store.unlocked(s.store.boardRef(chi.URLParam(r, "boardID")), r) {
+			writeJSON(w, 401, map[string]string{"error": "board is password protected"})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// saveFailed answers a change whose save failed and reports whether it
+// did. The change itself stays in memory and has been broadcast; a write
+// that timed out may still land.
+func saveFailed(w http.ResponseWriter, err error) bool {
+	switch {
+	case err == nil:
+		return false
+	case errors.Is(err, errSaveTimeout):
+		w.Header().Set("Retry-After", "10")
+		writeJSON(w, 503, map[string]string{"error": "storage is not responding; the change may not have been saved"})
+	default:
+		log.Printf("save: %v", err)
+		writeJSON(w, 500, map[string]string{"error": "saving failed"})
+	}
+	return true
+}
+
+// writable answers changes with 503 while a data file write is stuck, so
+// they fail fast instead of piling up behind dead storage. Reads still work.
+func (s *Server) writable(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+		default:
+			if s.store.saveStalled.Load() {
+				w.Header().Set("Retry-After", "10")
+				writeJSON(w, 503, map[string]string{"error": "storage is not responding; try again later"})
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Set or clear (empty password) a board's password
+func (s *Server) protectBoard(w http.ResponseWriter, r *http.Request) {
+	boardID := s.store.boardRef(chi.URLParam(r, "boardID"))
+	var req struct {
+		Password string `json:"password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, 400, map[string]string{"error": "bad request"})
+		return
+	}
+	hash := ""
+	if req.Password != "" {
+		// slow on purpose; keep it outside the lock
+		var err error
+		if hash, err = hashPassword(req.Password); err != nil {
+			writeJSON(w, 400, map[string]string{"error": err.Error()})
+			return
+		}
+	}
+
+	s.store.mu.Lock()
+	b := s.store.boards[boardID]
+	if b == nil {
+		s.store.mu.Unlock()
+		writeJSON(w, 404, map[string]string{"error": "board not found"})
+		return
+	}
+	if hash == "" {
+		delete(s.store.passwords, boardID)
+	} else {
+		s.store.passwords[boardID] = hash
+	}
+	// a new password (or none) invalidates earlier unlocks
+	for t, g := range s.store.tokens {
+		if g.boardID == boardID {
+			delete(s.store.tokens, t)
+		}
+	}
+	b.Protected = hash != ""
+	err := s.store.savePasswords()
+	s.store.mu.Unlock()
+	if err != nil {
+		writeJSON(w, 500, map[string]string{"error": "saving password failed"})
+		return
+	}
+	if saveFailed(w, s.store.save(r.Context())) {
+		return
+	}
+	writeJSON(w, 200, map[string]any{"protected": hash != ""})
+}
+
+// Exchange a board's password for a short-lived access token
+func (s *Server) unlockBoard(w http.ResponseWriter, r *http.Request) {
+	boardID := s.store.boardRef(chi.URLParam(r, "boardID"))
+	var req struct {
+		Password string `json:"password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Password == "" {
+		writeJSON(w, 400, map[string]string{"error": "password required"})
+		return
+	}
+
+	s.store.mu.RLock()
+	b := s.store.boards[boardID]
+	hash := s.store.passwords[boardID]
+	s.store.mu.RUnlock()
+	if b == nil {
+		writeJSON(w, 404, map[string]string{"error": "board not found"})
+		return
+	}
+	if hash == "" {
+		writeJSON(w, 400, map[string]string{"error": "board is not protected"})
+		return
+	}
+	if !checkPassword(hash, req.Password) {
+		writeJSON(w, 401, map[string]string{"error": "wrong password"})
+		return
+	}
+	s.store.mu.Lock()
+	token, exp := s.store.issueToken(boardID)
+	s.store.mu.Unlock()
+	writeJSON(w, 200, map[string]any{"token": token, "expiresAt": exp})
+}
+
+// Define a label on a board
+func (s *Server) createLabel(w http.ResponseWriter, r *http.Request) {
+	boardID := s.store.boardRef(chi.URLParam(r, "boardID"))
+	var req struct {
+		Name  string `json:"name"`
+		Color string `json:"color"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Name == "" {
+		writeJSON(w, 400, map[string]string{"error": "name required"})
+		return
+	}
+	lbl := Label{Name: req.Name, Color: req.Color}
+	if msg := validateLabel(lbl); msg != "" {
+		writeJSON(w, 400, map[string]string{"error": msg})
+		return
+	}
+
+	s.store.mu.Lock()
+	b := s.store.boards[boardID]
+	if b == nil {
+		s.store.mu.Unlock()
+		writeJSON(w, 404, map[string]string{"error": "board not found"})
+		return
+	}
+	if b.Closed {
+		s.store.mu.Unlock()
+		writeJSON(w, 409, map[string]string{"error": "board is closed"})
+		return
+	}
+	lbl.ID = newID()
+	b.Labels = append(b.Labels, lbl)
+	b.Events++
+	s.store.mu.Unlock()
+	saveErr := s.store.save(r.Context())
+
+	s.store.broadcast(r.Context(), boardID, Change{Entity: "label", Op: "created", ID: lbl.ID, Fields: lbl, Object: lbl})
+	if saveFailed(w, saveErr) {
+		return
+	}
+	writeJSON(w, 201, lbl)
+}
+
+// Add an automation rule to a board
+func (s *Server) createRule(w http.ResponseWriter, r *http.Request) {
+	boardID := s.store.boardRef(chi.URLParam(r, "boardID"))
+	var rule Rule
+	if err := json.NewDecoder(r.Body).Decode(&rule); err != nil {
+		writeJSON(w, 400, map[string]string{"error": "bad request"})
+		return
+	}
+
+	s.store.mu.Lock()
+	b := s.store.boards[boardID]
+	if b == nil {
+		s.store.mu.Unlock()
+		writeJSON(w, 404, map[string]string{"error": "board not found"})
+		return
+	}
+	if b.Closed {
+		s.store.mu.Unlock()
+		writeJSON(w, 409, map[string]string{"error": "board is closed"})
+		return
+	}
+	msg := ""
+	switch rule.Type {
+	case "on-complete-move-to":
+		rule.LabelID = ""
+		if findList(b, rule.ListID) == nil {
+			msg = "listId is not a list on this board"
+		}
+	case "on-due-passed-add-label":
+		rule.ListID = ""
+		if findLabel(b, rule.LabelID) == nil {
+			msg = "labelId is not a label on this board"
+		}
+	default:
+		msg = "type must be on-complete-move-to or on-due-passed-add-label"
+	}
+	if msg != "" {
+		s.store.mu.Unlock()
+		writeJSON(w, 400, map[string]string{"error": msg})
+		return
+	}
+	rule.ID = newID()
+	b.Rules = append(b.Rules, rule)
+	b.Events++
+	s.store.mu.Unlock()
+	saveErr := s.store.save(r.Context())
+
+	s.store.broadcast(r.Context(), boardID, Change{Entity: "rule", Op: "created", ID: rule.ID, Fields: rule, Object: rule})
+	if saveFailed(w, saveErr) {
+		return
+	}
+	writeJSON(w, 201, rule)
+}
+
+// Remove an automation rule
+func (s *Server) deleteRule(w http.ResponseWriter, r *http.Request) {
+	boardID := s.store.boardRef(chi.URLParam(r, "boardID"))
+	ruleID := parseID(chi.URLParam(r, "ruleID"))
+
+	s.store.mu.Lock()
+	b := s.store.boards[boardID]
+	if b == nil {
+		s.store.mu.Unlock()
+		writeJSON(w, 404, map[string]string{"error": "board not found"})
+		return
+	}
+	if b.Closed {
+		s.store.mu.Unlock()
+		writeJSON(w, 409, map[string]string{"error": "board is closed"})
+		return
+	}
+	idx := -1
+	for i := range b.Rules {
+		if b.Rules[i].ID == ruleID {
+			idx = i
+			break
+		}
+	}
+	if idx == -1 {
+		s.store.mu.Unlock()
+		writeJSON(w, 404, map[string]string{"error": "rule not found"})
+		return
+	}
+	b.Rules = append(b.Rules[:idx], b.Rules[idx+1:]...)
+	b.Events++
+	s.store.mu.Unlock()
+	saveErr := s.store.save(r.Context())
+
+	s.store.broadcast(r.Context(), boardID, Change{Entity: "rule", Op: "deleted", ID: ruleID, Fields: map[string]any{"id": ruleID}})
+	if saveFailed(w, saveErr) {
+		return
+	}
+	writeJSON(w, 200, map[string]any{"deleted": ruleID})
+}
+
+// Define a custom field on a board
+func (s *Server) createField(w http.ResponseWriter, r *http.Request) {
+	boardID := s.store.boardRef(chi.URLParam(r, "boardID"))
+	var def FieldDef
+	if err := json.NewDecoder(r.Body).Decode(&def); err != nil || def.Name == "" {
+		writeJSON(w, 400, map[string]string{"error": "name required"})
+		return
+	}
+	switch def.Type {
+	case "text", "number", "date":
+		def.Options = nil
+	case "select":
+		if len(def.Options) == 0 {
+			writeJSON(w, 400, map[string]string{"error": "select fields need options"})
+			return
+		}
+	default:
+		writeJSON(w, 400, map[string]string{"error": "type must be text, number, date or select"})
+		return
+	}
+
+	s.store.mu.Lock()
+	b := s.store.boards[boardID]
+	if b == nil {
+		s.store.mu.Unlock()
+		writeJSON(w, 404, map[string]string{"error": "board not found"})
+		return
+	}
+	if b.Closed {
+		s.store.mu.Unlock()
+		writeJSON(w, 409, map[string]string{"error": "board is closed"})
+		return
+	}
+	for _, f := range b.Fields {
+		if f.Name == def.Name {
+			s.store.mu.Unlock()
+			writeJSON(w, 409, map[string]string{"error": "field already exists"})
+			return
+		}
+	}
+	b.Fields = append(b.Fields, def)
+	b.Events++
+	s.store.mu.Unlock()
+	saveErr := s.store.save(r.Context())
+
+	s.store.broadcast(r.Context(), boardID, Change{Entity: "field", Op: "created", ID: boardID, Fields: def, Object: def})
+	if saveFailed(w, saveErr) {
+		return
+	}
+	writeJSON(w, 201, def)
+}
+
+// Close or reopen a board
+func (s *Server) setBoardClosed(closed bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		boardID := s.store.boardRef(chi.URLParam(r, "boardID"))
+		s.store.mu.Lock()
+		b := s.store.boards[boardID]
+		if b == nil {
+			s.store.mu.Unlock()
+			writeJSON(w, 404, map[string]string{"error": "board not found"})
+			return
+		}
+		changed := b.Closed != closed
+		if changed {
+			b.Closed = closed
+			b.Events++
+		}
+		out := *b
+		s.store.mu.Unlock()
+		if !changed {
+			writeJSON(w, 200, out)
+			return
+		}
+		saveErr := s.store.save(r.Context())
+
+		op := "reopened"
+		if closed {
+			op = "closed"
+		}
+		s.store.broadcast(r.Context(), boardID, Change{Entity: "board", Op: op, ID: boardID, Fields: map[string]any{"closed": closed}})
+		if saveFailed(w, saveErr) {
+			return
+		}
+		writeJSON(w, 200, out)
+	}
+}
+
+// Create list in a board
+func (s *Server) createList(w http.ResponseWriter, r *http.Request) {
+	boardID := s.store.boardRef(chi.URLParam(r, "boardID"))
+	var req struct {
+		Title string `json:"title"`
+		Key   string `json:"key"` // alternative to the Idempotency-Key header
+	}
+	err := json.NewDecoder(r.Body).Decode(&req)
+	req.Title = cleanTitle(req.Title)
+	if err != nil || req.Title == "" {
+		writeJSON(w, 400, map[string]string{"error": "title required"})
+		return
+	}
+	if msg := titleTooLong(req.Title); msg != "" {
+		writeJSON(w, 400, map[string]string{"error": msg})
+		return
+	}
+	key := r.Header.Get("Idempotency-Key")
+	if key == "" {
+		key = req.Key
+	}
+	if len(key) > 255 {
+		writeJSON(w, 400, map[string]string{"error": "idempotency key exceeds 255 bytes"})
+		return
+	}
+
+	s.store.mu.Lock()
+	b := s.store.boards[boardID]
+	if b == nil {
+		s.store.mu.Unlock()
+		writeJSON(w, 404, map[string]string{"error": "board not found"})
+		return
+	}
+	if b.Closed {
+		s.store.mu.Unlock()
+		writeJSON(w, 409, map[string]string{"error": "board is closed"})
+		return
+	}
+	if key != "" {
+		if l := s.store.keyedList(boardID, key); l != nil {
+			out, _ := copyList(*l) // l's cards belong to the store
+			s.store.mu.Unlock()
+			writeJSON(w, 200, out)
+			return
+		}
+	}
+	if r.URL.Query().Get("getOrCreate") == "true" {
+		for _, l := range b.Lists {
+			if strings.EqualFold(l.Title, req.Title) {
+				out, _ := copyList(l)
+				s.store.mu.Unlock()
+				writeJSON(w, 200, out)
+				return
+			}
+		}
+	}
+	pos := len(b.Lists)
+	lst := List{ID: newID(), Title: req.Title, Position: pos, Cards: []Card{}}
+	b.Lists = append(b.Lists, lst)
+	normalizeLists(b)
+	if key != "" {
+		s.store.listKeys[listKey{boardID, key}] = keyedList{listID: lst.ID, expires: time.Now().Add(listKeyTTL)}
+	}
+	b.Events++
+	s.store.mu.Unlock()
+	saveErr := s.store.save(r.Context())
+
+	s.store.broadcast(r.Context(), boardID, Change{Entity: "list", Op: "created", ID: lst.ID, Fields: lst, Object: lst})
+	if saveFailed(w, saveErr) {
+		return
+	}
+	writeJSON(w, 201, lst)
+}
+
+// Update list title and/or card template; an empty template clears it
+func (s *Server) updateList(w http.ResponseWriter, r *http.Request) {
+	boardID := s.store.boardRef(chi.URLParam(r, "boardID"))
+	listID := parseID(chi.URLParam(r, "listID"))
+	var req struct {
+		Title        *string       `json:"title"`
+		CardTemplate *CardTemplate `json:"cardTemplate"`
+		MaxVisible   *int          `json:"maxVisible"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if req.Title != nil {
+		*req.Title = cleanTitle(*req.Title)
+	}
+	if err != nil || (req.Title != nil && *req.Title == "") {
+		writeJSON(w, 400, map[string]string{"error": "bad request"})
+		return
+	}
+	if req.Title != nil && titleTooLong(*req.Title) != "" {
+		writeJSON(w, 400, map[string]string{"error": titleTooLong(*req.Title)})
+		return
+	}
+	if req.MaxVisible != nil && *req.MaxVisible < 0 {
+		writeJSON(w, 400, map[string]string{"error": "maxVisible must be >= 0"})
+		return
+	}
+
+	s.store.mu.Lock()
+	b := s.store.boards[boardID]
+	if b == nil {
+		s.store.mu.Unlock()
+		writeJSON(w, 404, map[string]string{"error": "board not found"})
+		return
+	}
+	if b.Closed {
+		s.store.mu.Unlock()
+		writeJSON(w, 409, map[string]string{"error": "board is closed"})
+		return
+	}
+	lst := findList(b, listID)
+	if lst == nil {
+		s.store.mu.Unlock()
+		writeJSON(w, 404, map[string]string{"error": "list not found"})
+		return
+	}
+	changed := map[string]any{}
+	if req.Title != nil {
+		lst.Title = *req.Title
+		changed["title"] = lst.Title
+	}
+	if t := req.CardTemplate; t != nil {
+		if t.Description == "" && len(t.Checklist) == 0 {
+			lst.CardTemplate = nil
+		} else {
+			lst.CardTemplate = t
+		}
+		changed["cardTemplate"] = lst.CardTemplate
+	}
+	if req.MaxVisible != nil {
+		lst.MaxVisible = *req.MaxVisible
+		changed["maxVisible"] = lst.MaxVisible
+	}
+	b.Events++
+	out := *lst
+	out.Cards = nil // the update event carries list metadata only
+	s.store.mu.Unlock()
+	saveErr := s.store.save(r.Context())
+
+	s.store.broadcast(r.Context(), boardID, Change{Entity: "list", Op: "updated", ID: listID, Fields: changed, Object: out})
+	if saveFailed(w, saveErr) {
+		return
+	}
+	writeJSON(w, 200, out)
+}
+
+// Move a list with all its cards to another board: {"toBoardId": ...}
+func (s *Server) moveListToBoard(w http.ResponseWriter, r *http.Request) {
+	boardID := s.store.boardRef(chi.URLParam(r, "boardID"))
+	listID := parseID(chi.URLParam(r, "listID"))
+	var req struct {
+		ToBoardID ID `json:"toBoardId"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.ToBoardID == "" {
+		writeJSON(w, 400, map[string]string{"error": "toBoardId required"})
+		return
+	}
+	if req.ToBoardID == boardID {
+		writeJSON(w, 400, map[string]string{"error": "list is already on that board"})
+		return
+	}
+	if !s.store.unlocked(req.ToBoardID, r) {
+		writeJSON(w, 401, map[string]string{"error": "target board is password protected"})
+		return
+	}
+
+	s.store.mu.Lock()
+	src, dst := s.store.boards[boardID], s.store.boards[req.ToBoardID]
+	if src == nil || dst == nil {
+		s.store.mu.Unlock()
+		writeJSON(w, 404, map[string]string{"error": "board not found"})
+		return
+	}
+	if src.Closed || dst.Closed {
+		s.store.mu.Unlock()
+		writeJSON(w, 409, map[string]string{"error": "board is closed"})
+		return
+	}
+	idx := -1
+	for i := range src.Lists {
+		if src.Lists[i].ID == listID {
+			idx = i
+			break
+		}
+	}
+	if idx == -1 {
+		s.store.mu.Unlock()
+		writeJSON(w, 404, map[string]string{"error": "list not found"})
+		return
+	}
+	lst := src.Lists[idx]
+	src.Lists = append(src.Lists[:idx], src.Lists[idx+1:]...)
+	normalizeLists(src)
+	if src.DefaultListID == listID {
+		src.DefaultListID = ""
+	}
+	// dependencies, labels and custom fields are board-scoped: drop the
+	// references that don't survive the move
+	for i := range lst.Cards {
+		c := &lst.Cards[i]
+		unlinkCard(src, c.ID)
+		for _, id := range append(append([]ID(nil), c.Blocks...), c.BlockedBy...) {
+			if _, j := findCardIn(&lst, id); j == -1 {
+				c.Blocks, c.BlockedBy = removeID(c.Blocks, id), removeID(c.BlockedBy, id)
+			}
+		}
+		kept := c.Labels[:0]
+		for _, id := range c.Labels {
+			if findLabel(dst, id) != nil {
+				kept = append(kept, id)
+			}
+		}
+		c.Labels = kept
+		for name := range c.CustomFields {
+			if validateCustomFields(dst, map[string]any{name: nil}) != "" {
+				delete(c.CustomFields, name)
+			}
+		}
+		c.Number = nextCardNumber(dst) // numbers are per board
+	}
+	lst.Position = len(dst.Lists)
+	dst.Lists = append(dst.Lists, lst)
+	normalizeLists(dst)
+	src.Events++
+	dst.Events++
+	out, _ := copyList(lst) // lst shares its cards with the store
+	s.store.mu.Unlock()
+	saveErr := s.store.save(r.Context())
+
+	s.store.broadcast(r.Context(), boardID, Change{Entity: "list", Op: "deleted", ID: listID, Fields: map[string]any{"movedToBoardId": req.ToBoardID}})
+	s.store.broadcast(r.Context(), req.ToBoardID, Change{Entity: "list", Op: "created", ID: listID, Fields: out, Object: out})
+	if saveFailed(w, saveErr) {
+		return
+	}
+	writeJSON(w, 200, out)
+}
+
+// Get board with lists/cards
+func (s *Server) getBoard(w http.ResponseWriter, r *http.Request) {
+	boardID := s.store.boardRef(chi.URLParam(r, "boardID"))
+	order, ok := cardOrders[r.URL.Query().Get("cardSort")]
+	dir := r.URL.Query().Get("cardSortDir")
+	if !ok || (dir != "" && dir != "asc" && dir != "desc") {
+		writeJSON(w, 400, map[string]string{"error": "cardSort must be position, due, priority, created or title; cardSortDir asc or desc"})
+		return
+	}
+	desc := dir == "desc"
+	excerpts := false
+	switch r.URL.Query().Get("descriptions") {
+	case "", "full":
+	case "excerpt":
+		excerpts = true
+	default:
+		writeJSON(w, 400, map[string]string{"error": "descriptions must be full or excerpt"})
+		return
+	}
+	s.store.touch(boardID)
+	s.store.mu.RLock()
+	b := s.store.boards[boardID]
+	if b == nil {
+		s.store.mu.RUnlock()
+		writeJSON(w, 404, map[string]string{"error": "not found"})
+		return
+	}
+	out := *b
+	out.Lists = make([]List, len(b.Lists))
+	now := time.Now()
+	for i, l := range b.Lists {
+		l.Cards = sortCards(l.Cards, order, desc)
+		l = splitOverflow(l)
+		l.Cards, l.OverflowCards = withAges(l.Cards, now), withAges(l.OverflowCards, now)
+		if excerpts {
+			withExcerpts(l.Cards, s.store.cfg.ExcerptLength)
+			withExcerpts(l.OverflowCards, s.store.cfg.ExcerptLength)
+		}
+		out.Lists[i] = l
+	}
+	if excerpts && out.Archive != nil {
+		out.Archive = append([]Card(nil), out.Archive...)
+		withExcerpts(out.Archive, s.store.cfg.ExcerptLength)
+	}
+	s.store.mu.RUnlock()
+	writeJSON(w, 200, out)
+}
+
+// Get one card, with its full description; archived cards too
+func (s *Server) getCard(w http.ResponseWriter, r *http.Request) {
+	boardID := s.store.boardRef(chi.URLParam(r, "boardID"))
+	cardID := parseID(chi.URLParam(r, "cardID"))
+	s.store.touch(boardID)
+	s.store.mu.RLock()
+	b := s.store.boards[boardID]
+	if b == nil {
+		s.store.mu.RUnlock()
+		writeJSON(w, 404, map[string]string{"error": "board not found"})
+		return
+	}
+	var cards []Card
+	if lst, idx := findCard(b, cardID); lst != nil {
+		cards = []Card{lst.Cards[idx]}
+	} else if i := slices.IndexFunc(b.Archive, func(c Card) bool { return c.ID == cardID }); i != -1 {
+		cards = []Card{b.Archive[i]}
+	}
+	s.store.mu.RUnlock()
+	if cards == nil {
+		writeJSON(w, 404, map[string]string{"error": "card not found"})
+		return
+	}
+	writeJSON(w, 200, withAges(cards, time.Now())[0])
+}
+
+// Create card in a list
+func (s *Server) createCard(w http.ResponseWriter, r *http.Request) {
+	s.addCard(w, r, parseID(chi.URLParam(r, "listID")))
+}
+
+// Quick-add a card to the board's default list
+func (s *Server) quickCard(w http.ResponseWriter, r *http.Request) {
+	s.addCard(w, r, "")
+}
+
+// addCard creates a card from the request body in listID, or in the board's
+// default list when listID is 0.
+func (s *Server) addCard(w http.ResponseWriter, r *http.Request, listID ID) {
+	boardID := s.store.boardRef(chi.URLParam(r, "boardID"))
+	var req struct {
+		Title         string          `json:"title"`
+		Description   string          `json:"description"`
+		Due           *time.Time      `json:"due"`
+		Start         *time.Time      `json:"start"`
+		EstimateHours float64         `json:"estimateHours"`
+		Checklist     []ChecklistItem `json:"checklist"`
+		Rank          *float64        `json:"rank"`
+		ToPos         *int            `json:"toPos"` // appended when absent or out of range
+		CustomFields  map[string]any  `json:"customFields"`
+		Assignees     []string        `json:"assignees"`
+		CoverURL      string          `json:"coverUrl"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&req)
+	req.Title = cleanTitle(req.Title)
+	if err != nil || req.Title == "" {
+		writeJSON(w, 400, map[string]string{"error": "title required"})
+		return
+	}
+	if msg := titleTooLong(req.Title); msg != "" {
+		writeJSON(w, 400, map[string]string{"error": msg})
+		return
+	}
+	if !validRank(req.Rank) {
+		writeJSON(w, 400, map[string]string{"error": "rank must be finite"})
+		return
+	}
+	if msg := validateSchedule(req.Start, req.Due, req.EstimateHours); msg != "" {
+		writeJSON(w, 400, map[string]string{"error": msg})
+		return
+	}
+	if msg := s.store.dueError(req.Due); msg != "" {
+		writeJSON(w, 400, map[string]string{"error": msg})
+		return
+	}
+	if msg := coverError(req.CoverURL); msg != "" {
+		writeJSON(w, 400, map[string]string{"error": msg})
+		return
+	}
+	req.Due, req.Start = inUTC(req.Due), inUTC(req.Start)
+
+	s.store.mu.Lock()
+	b := s.store.boards[boardID]
+	if b == nil {
+		s.store.mu.Unlock()
+		writeJSON(w, 404, map[string]string{"error": "board not found"})
+		return
+	}
+	if b.Closed {
+		s.store.mu.Unlock()
+		writeJSON(w, 409, map[string]string{"error": "board is closed"})
+		return
+	}
+	var target *List
+	if listID == "" {
+		if target = defaultList(b); target == nil {
+			s.store.mu.Unlock()
+			writeJSON(w, 409, map[string]string{"error": "board has no lists; create a list first"})
+			return
+		}
+	} else if target = findList(b, listID); target == nil {
+		s.store.mu.Unlock()
+		writeJSON(w, 404, map[string]string{"error": "list not found"})
+		return
+	}
+	if req.Due == nil && b.DefaultDueDays > 0 {
+		due := time.Now().UTC().AddDate(0, 0, b.DefaultDueDays)
+		req.Due = &due
+		if msg := validateSchedule(req.Start, req.Due, req.EstimateHours); msg != "" {
+			s.store.mu.Unlock()
+			writeJSON(w, 400, map[string]string{"error": msg + " (board default due)"})
+			return
+		}
+	}
+	// the list's template fills in whatever the request left out
+	if t := target.CardTemplate; t != nil {
+		if req.Description == "" {
+			req.Description = t.Description
+		}
+		if req.Checklist == nil {
+			for _, item := range t.Checklist {
+				req.Checklist = append(req.Checklist, ChecklistItem{Text: item})
+			}
+		}
+	}
+	desc, cut, msg := limitDescription(cleanDescription(req.Description), s.store.maxDesc, r.URL.Query().Get("truncate") == "true")
+	if msg != "" {
+		s.store.mu.Unlock()
+		writeJSON(w, 400, map[string]string{"error": msg})
+		return
+	}
+	if msg := validateCustomFields(b, req.CustomFields); msg != "" {
+		s.store.mu.Unlock()
+		writeJSON(w, 400, map[string]string{"error": msg})
+		return
+	}
+	for k, v := range req.CustomFields {
+		if v == nil {
+			delete(req.CustomFields, k)
+		}
+	}
+	card := Card{ID: newID(), Title: req.Title, Description: desc, DescriptionTruncated: cut, Due: req.Due, Start: req.Start, EstimateHours: req.EstimateHours, Checklist: req.Checklist, CustomFields: req.CustomFields, Assignees: cleanAssignees(req.Assignees), CoverURL: req.CoverURL}
+	card.Number = nextCardNumber(b)
+	mentioned := noteMentions(b, &card, "")
+	pos := -1
+	if req.ToPos != nil {
+		pos = *req.ToPos
+	}
+	card = insertCard(target, card, pos, req.Rank)
+	b.Events++
+	s.store.mu.Unlock()
+	saveErr := s.store.save(r.Context())
+
+	s.store.broadcast(r.Context(), boardID, Change{Entity: "card", Op: "created", ID: card.ID, Fields: card, Object: card})
+	s.announceMentions(r.Context(), boardID, card.ID, mentioned)
+	if saveFailed(w, saveErr) {
+		return
+	}
+	writeJSON(w, 201, card)
+}
+
+// Add a card template to the server-wide library
+func (s *Server) createTemplate(w http.ResponseWriter, r *http.Request) {
+	var req SharedTemplate
+	err := json.NewDecoder(r.Body).Decode(&req)
+	req.Title = cleanTitle(req.Title)
+	if err != nil || req.Title == "" {
+		writeJSON(w, 400, map[string]string{"error": "title required"})
+		return
+	}
+	if msg := titleTooLong(req.Title); msg != "" {
+		writeJSON(w, 400, map[string]string{"error": msg})
+		return
+	}
+	desc, _, msg := limitDescription(cleanDescription(req.Description), s.store.maxDesc, false)
+	if msg != "" {
+		writeJSON(w, 400, map[string]string{"error": msg})
+		return
+	}
+	req.ID = newID()
+	req.Description = desc
+
+	s.store.mu.Lock()
+	s.store.templates = append(s.store.templates, req)
+	s.store.unlogged++
+	s.store.mu.Unlock()
+	if saveFailed(w, s.store.save(r.Context())) {
+		return
+	}
+	writeJSON(w, 201, req)
+}
+
+// List the card template library
+func (s *Server) listTemplates(w http.ResponseWriter, r *http.Request) {
+	s.store.mu.RLock()
+	out := append([]SharedTemplate{}, s.store.templates...)
+	s.store.mu.RUnlock()
+	writeJSON(w, 200, out)
+}
+
+// Create a card in a list from a library template
+func (s *Server) cardFromTemplate(w http.ResponseWriter, r *http.Request) {
+	boardID := s.store.boardRef(chi.URLParam(r, "boardID"))
+	listID := parseID(chi.URLParam(r, "listID"))
+	templateID := parseID(chi.URLParam(r, "templateID"))
+
+	s.store.mu.Lock()
+	var tpl *SharedTemplate
+	for i := range s.store.templates {
+		if s.store.templates[i].ID == templateID {
+			tpl = &s.store.templates[i]
+			break
+		}
+	}
+	if tpl == nil {
+		s.store.mu.Unlock()
+		writeJSON(w, 404, map[string]string{"error": "template not found"})
+		return
+	}
+	b := s.store.boards[boardID]
+	if b == nil {
+		s.store.mu.Unlock()
+		writeJSON(w, 404, map[string]string{"error": "board not found"})
+		return
+	}
+	if b.Closed {
+		s.store.mu.Unlock()
+		writeJSON(w, 409, map[string]string{"error": "board is closed"})
+		return
+	}
+	target := findList(b, listID)
+	if target == nil {
+		s.store.mu.Unlock()
+		writeJSON(w, 404, map[string]string{"error": "list not found"})
+		return
+	}
+	card := Card{ID: newID(), Title: tpl.Title, Description: tpl.Description, Number: nextCardNumber(b)}
+	for _, item := range tpl.Checklist {
+		card.Checklist = append(card.Checklist, ChecklistItem{Text: item})
+	}
+	// labels the board doesn't define are skipped
+	for _, name := range tpl.Labels {
+		for _, l := range b.Labels {
+			if strings.EqualFold(l.Name, name) {
+				card.Labels = addID(card.Labels, l.ID)
+				break
+			}
+		}
+	}
+	autoColor(b, &card)
+	if b.DefaultDueDays > 0 {
+		due := time.Now().UTC().AddDate(0, 0, b.DefaultDueDays)
+		card.Due = &due
+	}
+	card = insertCard(target, card, -1, nil)
+	b.Events++
+	s.store.mu.Unlock()
+	saveErr := s.store.save(r.Context())
+
+	s.store.broadcast(r.Context(), boardID, Change{Entity: "card", Op: "created", ID: card.ID, Fields: card, Object: card})
+	if saveFailed(w, saveErr) {
+		return
+	}
+	writeJSON(w, 201, card)
+}
+
+// Update card fields; omitted fields are left unchanged
+func (s *Server) updateCard(w http.ResponseWriter, r *http.Request) {
+	boardID := s.store.boardRef(chi.URLParam(r, "boardID"))
+	cardID := parseID(chi.URLParam(r, "cardID"))
+	var req struct {
+		Title         *string        `json:"title"`
+		Description   *string        `json:"description"`
+		Due           *time.Time     `json:"due"`
+		Start         *time.Time     `json:"start"`
+		EstimateHours *float64       `json:"estimateHours"`
+		Labels        *[]ID          `json:"labels"`
+		Color         *string        `json:"color"`        // "" clears an explicit color
+		CustomFields  map[string]any `json:"customFields"` // merged; null removes a field
+		Assignees     *[]string      `json:"assignees"`
+		CoverURL      *string        `json:"coverUrl"` // "" removes the cover
+	}
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if req.Title != nil {
+		*req.Title = cleanTitle(*req.Title)
+	}
+	if err != nil || (req.Title != nil && *req.Title == "") {
+		writeJSON(w, 400, map[string]string{"error": "bad request"})
+		return
+	}
+	if req.Title != nil && titleTooLong(*req.Title) != "" {
+		writeJSON(w, 400, map[string]string{"error": titleTooLong(*req.Title)})
+		return
+	}
+	if req.CoverURL != nil && coverError(*req.CoverURL) != "" {
+		writeJSON(w, 400, map[string]string{"error": coverError(*req.CoverURL)})
+		return
+	}
+	if msg := s.store.dueError(req.Due); msg != "" {
+		writeJSON(w, 400, map[string]string{"error": msg})
+		return
+	}
+
+	s.store.mu.Lock()
+	b := s.store.boards[boardID]
+	if b == nil {
+		s.store.mu.Unlock()
+		writeJSON(w, 404, map[string]string{"error": "board not found"})
+		return
+	}
+	if b.Closed {
+		s.store.mu.Unlock()
+		writeJSON(w, 409, map[string]string{"error": "board is closed"})
+		return
+	}
+	lst, idx := findCard(b, cardID)
+	if lst == nil {
+		s.store.mu.Unlock()
+		writeJSON(w, 404, map[string]string{"error": "card not found"})
+		return
+	}
+	c := lst.Cards[idx]
+	before := c.Description
+	changed := map[string]any{}
+	if req.Title != nil {
+		c.Title = *req.Title
+		changed["title"] = c.Title
+	}
+	if req.Description != nil {
+		desc, cut, msg := limitDescription(cleanDescription(*req.Description), s.store.maxDesc, r.URL.Query().Get("truncate") == "true")
+		if msg != "" {
+			s.store.mu.Unlock()
+			writeJSON(w, 400, map[string]string{"error": msg})
+			return
+		}
+		c.Description, c.DescriptionTruncated = desc, cut
+		changed["description"] = c.Description
+		changed["descriptionTruncated"] = cut
+	}
+	if req.Due != nil {
+		c.Due = inUTC(req.Due)
+		changed["due"] = c.Due
+	}
+	if req.Start != nil {
+		c.Start = inUTC(req.Start)
+		changed["start"] = c.Start
+	}
+	if req.EstimateHours != nil {
+		c.EstimateHours = *req.EstimateHours
+		changed["estimateHours"] = c.EstimateHours
+	}
+	if req.Color != nil {
+		c.Color = *req.Color
+		c.ColorFromLabel = false
+	}
+	if req.Assignees != nil {
+		c.Assignees = cleanAssignees(*req.Assignees)
+		changed["assignees"] = c.Assignees
+	}
+	if req.CoverURL != nil {
+		c.CoverURL = *req.CoverURL
+		changed["coverUrl"] = c.CoverURL
+	}
+	if req.Labels != nil {
+		for _, id := range *req.Labels {
+			if findLabel(b, id) == nil {
+				s.store.mu.Unlock()
+				writeJSON(w, 400, map[string]string{"error": "unknown label " + string(id)})
+				return
+			}
+		}
+		c.Labels = append([]ID(nil), *req.Labels...)
+	}
+	if req.CustomFields != nil {
+		if msg := validateCustomFields(b, req.CustomFields); msg != "" {
+			s.store.mu.Unlock()
+			writeJSON(w, 400, map[string]string{"error": msg})
+			return
+		}
+		merged := map[string]any{}
+		for k, v := range c.CustomFields {
+			merged[k] = v
+		}
+		for k, v := range req.CustomFields {
+			if v == nil {
+				delete(merged, k)
+			} else {
+				merged[k] = v
+			}
+		}
+		c.CustomFields = merged
+		changed["customFields"] = merged
+	}
+	if req.Labels != nil || req.Color != nil {
+		autoColor(b, &c)
+		changed["labels"], changed["color"] = c.Labels, c.Color
+	}
+	if msg := validateSchedule(c.Start, c.Due, c.EstimateHours); msg != "" {
+		s.store.mu.Unlock()
+		writeJSON(w, 400, map[string]string{"error": msg})
+		return
+	}
+	mentioned := noteMentions(b, &c, before)
+	if len(mentioned) > 0 && b.WatchMentions {
+		changed["watchers"] = c.Watchers
+	}
+	c.UpdatedAt = time.Now().UTC()
+	lst.Cards[idx] = c
+	b.Events++
+	s.store.mu.Unlock()
+	saveErr := s.store.save(r.Context())
+
+	s.store.broadcast(r.Context(), boardID, Change{Entity: "card", Op: "updated", ID: c.ID, Fields: changed, Object: c})
+	s.announceMentions(r.Context(), boardID, c.ID, mentioned)
+	if saveFailed(w, saveErr) {
+		return
+	}
+	writeJSON(w, 200, c)
+}
+
+// replaceCard is the PUT counterpart of updateCard: the body is the card's
+// full set of editable fields, and anything omitted is cleared. ID, list,
+// position, completion, checklist and time logs are kept.
+func (s *Server) replaceCard(w http.ResponseWriter, r *http.Request) {
+	boardID := s.store.boardRef(chi.URLParam(r, "boardID"))
+	listID := parseID(chi.URLParam(r, "listID"))
+	cardID := parseID(chi.URLParam(r, "cardID"))
+	var req struct {
+		Title         string         `json:"title"`
+		Description   string         `json:"description"`
+		Due           *time.Time     `json:"due"`
+		Start         *time.Time     `json:"start"`
+		EstimateHours float64        `json:"estimateHours"`
+		Labels        []ID           `json:"labels"`
+		Color         string         `json:"color"`
+		CustomFields  map[string]any `json:"customFields"`
+		Assignees     []string       `json:"assignees"`
+		CoverURL      string         `json:"coverUrl"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&req)
+	req.Title = cleanTitle(req.Title)
+	if err != nil || req.Title == "" {
+		writeJSON(w, 400, map[string]string{"error": "bad request"})
+		return
+	}
+	if msg := titleTooLong(req.Title); msg != "" {
+		writeJSON(w, 400, map[string]string{"error": msg})
+		return
+	}
+	if msg := validateSchedule(req.Start, req.Due, req.EstimateHours); msg != "" {
+		writeJSON(w, 400, map[string]string{"error": msg})
+		return
+	}
+	if msg := s.store.dueError(req.Due); msg != "" {
+		writeJSON(w, 400, map[string]string{"error": msg})
+		return
+	}
+	if msg := coverError(req.CoverURL); msg != "" {
+		writeJSON(w, 400, map[string]string{"error": msg})
+		return
+	}
+
+	s.store.mu.Lock()
+	b := s.store.boards[boardID]
+	if b == nil {
+		s.store.mu.Unlock()
+		writeJSON(w, 404, map[string]string{"error": "board not found"})
+		return
+	}
+	if b.Closed {
+		s.store.mu.Unlock()
+		writeJSON(w, 409, map[string]string{"error": "board is closed"})
+		return
+	}
+	lst, idx := findCard(b, cardID)
+	if lst == nil || lst.ID != listID {
+		s.store.mu.Unlock()
+		writeJSON(w, 404, map[string]string{"error": "card not found"})
+		return
+	}
+	desc, cut, msg := limitDescription(cleanDescription(req.Description), s.store.maxDesc, r.URL.Query().Get("truncate") == "true")
+	if msg == "" {
+		for _, id := range req.Labels {
+			if findLabel(b, id) == nil {
+				msg = "unknown label " + string(id)
+				break
+			}
+		}
+	}
+	fields := map[string]any{}
+	for k, v := range req.CustomFields {
+		if v != nil {
+			fields[k] = v
+		}
+	}
+	if msg == "" {
+		msg = validateCustomFields(b, fields)
+	}
+	if msg != "" {
+		s.store.mu.Unlock()
+		writeJSON(w, 400, map[string]string{"error": msg})
+		return
+	}
+	c := lst.Cards[idx]
+	before := c.Description
+	c.Title, c.Description, c.DescriptionTruncated = req.Title, desc, cut
+	c.Due, c.Start, c.EstimateHours = inUTC(req.Due), inUTC(req.Start), req.EstimateHours
+	c.Labels = append([]ID(nil), req.Labels...)
+	c.Assignees = cleanAssignees(req.Assignees)
+	c.CoverURL = req.CoverURL
+	c.Color, c.ColorFromLabel = req.Color, false
+	c.CustomFields = nil
+	if len(fields) > 0 {
+		c.CustomFields = fields
+	}
+	autoColor(b, &c)
+	mentioned := noteMentions(b, &c, before)
+	c.UpdatedAt = time.Now().UTC()
+	lst.Cards[idx] = c
+	b.Events++
+	s.store.mu.Unlock()
+	saveErr := s.store.save(r.Context())
+
+	changed := map[string]any{
+		"title": c.Title, "description": c.Description, "descriptionTruncated": c.DescriptionTruncated,
+		"due": c.Due, "start": c.Start, "estimateHours": c.EstimateHours,
+		"labels": c.Labels, "assignees": c.Assignees, "coverUrl": c.CoverURL, "color": c.Color, "customFields": c.CustomFields,
+	}
+	if len(mentioned) > 0 && b.WatchMentions {
+		changed["watchers"] = c.Watchers
+	}
+	s.store.broadcast(r.Context(), boardID, Change{Entity: "card", Op: "updated", ID: c.ID, Fields: changed, Object: c})
+	s.announceMentions(r.Context(), boardID, c.ID, mentioned)
+	if saveFailed(w, saveErr) {
+		return
+	}
+	writeJSON(w, 200, c)
+}
+
+// Move card between lists or reorder
+func (s *Server) moveCard(w http.ResponseWriter, r *http.Request) {
+	boardID := s.store.boardRef(chi.URLParam(r, "boardID"))
+	var req struct {
+		CardID, FromListID, ToListID ID
+		ToPos                        int
+		Rank                         *float64 // when set, wins over ToPos
+		Strict                       bool     // 409 instead of clamping an out-of-range ToPos
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, 400, map[string]string{"error": "bad request"})
+		return
+	}
+	req.Strict = req.Strict || r.URL.Query().Get("strict") == "true"
+	if !validRank(req.Rank) {
+		writeJSON(w, 400, map[string]string{"error": "rank must be finite"})
+		return
+	}
+	if code, msg := s.vetMove(r.Context(), boardID, req.CardID, req.FromListID, req.ToListID); code != 0 {
+		writeJSON(w, code, map[string]string{"error": msg})
+		return
+	}
+
+	s.store.mu.Lock()
+	b := s.store.boards[boardID]
+	if b == nil {
+		s.store.mu.Unlock()
+		writeJSON(w, 404, map[string]string{"error": "board not found"})
+		return
+	}
+	if b.Closed {
+		s.store.mu.Unlock()
+		writeJSON(w, 409, map[string]string{"error": "board is closed"})
+		return
+	}
+	from := findList(b, req.FromListID)
+	if from == nil {
+		s.store.mu.Unlock()
+		writeJSON(w, 404, map[string]string{"error": "from list not found"})
+		return
+	}
+	// resolve the target before touching anything so a bad request can't drop the card
+	to := findList(b, req.ToListID)
+	if to == nil {
+		s.store.mu.Unlock()
+		writeJSON(w, 404, map[string]string{"error": "to list not found"})
+		return
+	}
+	// extract card
+	var c Card
+	idx := -1
+	for i := range from.Cards {
+		if from.Cards[i].ID == req.CardID {
+			c = from.Cards[i]
+			idx = i
+			break
+		}
+	}
+	if idx == -1 {
+		s.store.mu.Unlock()
+		writeJSON(w, 404, map[string]string{"error": "card not found"})
+		return
+	}
+	if n := len(to.Cards); req.Strict && req.Rank == nil {
+		if to == from {
+			n-- // the card leaves before it is inserted
+		}
+		if req.ToPos < 0 || req.ToPos > n {
+			s.store.mu.Unlock()
+			writeJSON(w, 409, map[string]any{"error": fmt.Sprintf("toPos %d is out of range 0..%d for the target list; reload the board", req.ToPos, n), "max": n})
+			return
+		}
+	}
+	from.Cards = append(from.Cards[:idx], from.Cards[idx+1:]...)
+	reindex(from)
+	leaveList(b, from, to, &c)
+	c = insertCard(to, c, req.ToPos, req.Rank)
+	b.Events++
+	toListID := to.ID
+	// copies of the lists involved, so the mover can update without a reload
+	now := time.Now()
+	lists := []List{*from}
+	if to != from {
+		lists = append(lists, *to)
+	}
+	for i := range lists {
+		lists[i].Cards = withAges(lists[i].Cards, now)
+	}
+	s.store.mu.Unlock()
+	saveErr := s.store.save(r.Context())
+
+	s.store.broadcast(r.Context(), boardID, Change{Entity: "card", Op: "moved", ID: c.ID, Fields: map[string]any{"listId": toListID, "position": c.Position, "rank": c.Rank}, Object: c})
+	if saveFailed(w, saveErr) {
+		return
+	}
+	writeJSON(w, 200, map[string]any{"card": c, "lists": lists})
+}
+
+// moveHookRequest is the body POSTed to a board's MoveHook.
+type moveHookRequest struct {
+	BoardID    ID       `json:"boardId"`
+	FromListID ID       `json:"fromListId"`
+	FromList   string   `json:"fromList"` // list titles, for rules by name
+	ToListID   ID       `json:"toListId"`
+	ToList     string   `json:"toList"`
+	Card       Card     `json:"card"`
+	Labels     []string `json:"labels"` // names of the card's labels
+}
+
+// vetMove asks the board's MoveHook, if any, whether the card may move
+// between the two lists. It returns 0 to go ahead, or the status and message
+// to refuse with: 409 when the hook answers non-2xx, 503 when it can't be
+// reached and fails closed. The hook is called without the lock held, so
+// moveCard checks everything again afterwards; requests it would reject
+// anyway (unknown card or list) are not sent.
+func (s *Server) vetMove(ctx context.Context, boardID, cardID, fromID, toID ID) (int, string) {
+	if fromID == toID {
+		return 0, "" // reordering within a list
+	}
+	s.store.mu.RLock()
+	b := s.store.boards[boardID]
+	if b == nil || b.MoveHook == nil {
+		s.store.mu.RUnlock()
+		return 0, ""
+	}
+	hook := *b.MoveHook
+	from, to := findList(b, fromID), findList(b, toID)
+	var idx int
+	if from != nil {
+		_, idx = findCardIn(from, cardID)
+	}
+	if from == nil || to == nil || idx == -1 {
+		s.store.mu.RUnlock()
+		return 0, ""
+	}
+	move := moveHookRequest{BoardID: b.ID, FromListID: from.ID, FromList: from.Title, ToListID: to.ID, ToList: to.Title, Card: from.Cards[idx], Labels: []string{}}
+	for _, id := range move.Card.Labels {
+		if l := findLabel(b, id); l != nil {
+			move.Labels = append(move.Labels, l.Name)
+		}
+	}
+	body, err := json.Marshal(move)
+	s.store.mu.RUnlock()
+	if err != nil {
+		return 500, err.Error()
+	}
+
+	// hooks set before the allowlist existed (or since removed from it) are
+	// treated as unreachable
+	err = errors.New("url is not in KANBAN_MOVE_HOOK_ALLOW")
+	if s.store.hookAllowed(hook.URL) {
+		var req *http.Request
+		req, err = http.NewRequestWithContext(ctx, "POST", hook.URL, bytes.NewReader(body))
+		if err == nil {
+			req.Header.Set("Content-Type", "application/json")
+			var resp *http.Response
+			if resp, err = s.store.hooks.Do(req); err == nil {
+				resp.Body.Close()
+				if resp.StatusCode/100 == 2 {
+					return 0, ""
+				}
+				// the answer isn't passed on: the hook's URL is the board
+				// owner's choice, its response text is nobody's business
+				return 409, "move rejected by validation hook: " + resp.Status
+			}
+		}
+	}
+	if hook.FailOpen {
+		log.Printf("move hook for board %s: %v; allowing the move", boardID, err)
+		return 0, ""
+	}
+	log.Printf("move hook for board %s: %v; refusing the move", boardID, err)
+	return 503, "move validation is unavailable"
+}
+
+// moveLookup resolves a move on b, which may be nil: the list the card is
+// in, its index there and the target list. A non-zero code is the error to
+// answer with instead.
+type moveLookup func(b *Board) (from *List, idx int, to *List, code int, msg string)
+
+// lockVetted resolves a move with find, has vetMove approve it and resolves
+// it again under the write lock, which it returns holding when code is 0.
+// A move that resolves differently the second time (the board changed while
+// the hook was deciding) gets 409, to be retried.
+func (s *Server) lockVetted(ctx context.Context, boardID ID, find moveLookup) (b *Board, from *List, idx int, to *List, code int, msg string) {
+	s.store.mu.RLock()
+	from, idx, to, code, msg = find(s.store.boards[boardID])
+	var cardID, fromID, toID ID
+	if code == 0 {
+		cardID, fromID, toID = from.Cards[idx].ID, from.ID, to.ID
+	}
+	s.store.mu.RUnlock()
+	if code != 0 {
+		return nil, nil, 0, nil, code, msg
+	}
+	if code, msg = s.vetMove(ctx, boardID, cardID, fromID, toID); code != 0 {
+		return nil, nil, 0, nil, code, msg
+	}
+
+	s.store.mu.Lock()
+	b = s.store.boards[boardID]
+	from, idx, to, code, msg = find(b)
+	if code == 0 && (from.Cards[idx].ID != cardID || from.ID != fromID || to.ID != toID) {
+		code, msg = 409, "the board changed while the move was being validated; retry"
+	}
+	if code != 0 {
+		s.store.mu.Unlock()
+		return nil, nil, 0, nil, code, msg
+	}
+	return b, from, idx, to, 0, ""
+}
+
+// hookAllowed reports whether a move hook may call raw: it must have the
+// scheme and host of a KANBAN_MOVE_HOOK_ALLOW prefix and a path at or below
+// the prefix's.
+func (s *Store) hookAllowed(raw string) bool {
+	u, err := url.Parse(raw)
+	if err != nil || u.User != nil || strings.Contains(u.Path, "..") {
+		return false
+	}
+	for _, prefix := range s.cfg.MoveHookAllow {
+		p, err := url.Parse(prefix)
+		if err != nil || p.Scheme != u.Scheme || !strings.EqualFold(p.Host, u.Host) {
+			continue
+		}
+		dir := strings.TrimSuffix(p.Path, "/")
+		if u.Path == dir || strings.HasPrefix(u.Path, dir+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// Convenience move for scripts: {"cardTitle": "...", "toListTitle": "..."}.
+// Titles match case-insensitively and must be unambiguous; the card goes to
+// the end of the target list.
+func (s *Server) moveCardByTitle(w http.ResponseWriter, r *http.Request) {
+	boardID := s.store.boardRef(chi.URLParam(r, "boardID"))
+	var req struct {
+		CardTitle   string `json:"cardTitle"`
+		ToListTitle string `json:"toListTitle"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.CardTitle == "" || req.ToListTitle == "" {
+		writeJSON(w, 400, map[string]string{"error": "cardTitle and toListTitle required"})
+		return
+	}
+
+	b, from, idx, to, code, msg := s.lockVetted(r.Context(), boardID, func(b *Board) (*List, int, *List, int, string) {
+		if b == nil {
+			return nil, 0, nil, 404, "board not found"
+		}
+		if b.Closed {
+			return nil, 0, nil, 409, "board is closed"
+		}
+		var to, from *List
+		idx, lists, cards := -1, 0, 0
+		for i := range b.Lists {
+			l := &b.Lists[i]
+			if strings.EqualFold(l.Title, req.ToListTitle) {
+				to = l
+				lists++
+			}
+			for j := range l.Cards {
+				if strings.EqualFold(l.Cards[j].Title, req.CardTitle) {
+					from, idx = l, j
+					cards++
+				}
+			}
+		}
+		switch {
+		case cards == 0:
+			return nil, 0, nil, 404, "card not found"
+		case lists == 0:
+			return nil, 0, nil, 404, "list not found"
+		case cards > 1 || lists > 1:
+			return nil, 0, nil, 409, fmt.Sprintf("ambiguous titles: %d cards and %d lists match", cards, lists)
+		}
+		return from, idx, to, 0, ""
+	})
+	if code != 0 {
+		writeJSON(w, code, map[string]string{"error": msg})
+		return
+	}
+	c := from.Cards[idx]
+	from.Cards = append(from.Cards[:idx], from.Cards[idx+1:]...)
+	reindex(from)
+	leaveList(b, from, to, &c)
+	c = insertCard(to, c, -1, nil)
+	b.Events++
+	toListID := to.ID
+	s.store.mu.Unlock()
+	saveErr := s.store.save(r.Context())
+
+	s.store.broadcast(r.Context(), boardID, Change{Entity: "card", Op: "moved", ID: c.ID, Fields: map[string]any{"listId": toListID, "position": c.Position, "rank": c.Rank}, Object: c})
+	if saveFailed(w, saveErr) {
+		return
+	}
+	writeJSON(w, 200, map[string]any{"cardId": c.ID, "listId": toListID, "position": c.Position})
+}
+
+// stepCard moves a card to the end of the neighbouring list: the next one by
+// position for step 1 (advance), the previous one for -1 (retreat).
+func (s *Server) stepCard(step int) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		boardID := s.store.boardRef(chi.URLParam(r, "boardID"))
+		cardID := parseID(chi.URLParam(r, "cardID"))
+
+		b, from, idx, to, code, msg := s.lockVetted(r.Context(), boardID, func(b *Board) (*List, int, *List, int, string) {
+			if b == nil {
+				return nil, 0, nil, 404, "board not found"
+			}
+			if b.Closed {
+				return nil, 0, nil, 409, "board is closed"
+			}
+			from, idx := findCard(b, cardID)
+			if from == nil {
+				return nil, 0, nil, 404, "card not found"
+			}
+			// lists are kept sorted with positions 0..n-1
+			next := from.Position + step
+			if next < 0 || next >= len(b.Lists) {
+				edge := "last"
+				if step < 0 {
+					edge = "first"
+				}
+				return nil, 0, nil, 409, "card is already in the " + edge + " list"
+			}
+			return from, idx, &b.Lists[next], 0, ""
+		})
+		if code != 0 {
+			writeJSON(w, code, map[string]string{"error": msg})
+			return
+		}
+		c := from.Cards[idx]
+		from.Cards = append(from.Cards[:idx], from.Cards[idx+1:]...)
+		reindex(from)
+		leaveList(b, from, to, &c)
+		c = insertCard(to, c, -1, nil)
+		b.Events++
+		toListID := to.ID
+		s.store.mu.Unlock()
+		saveErr := s.store.save(r.Context())
+
+		s.store.broadcast(r.Context(), boardID, Change{Entity: "card", Op: "moved", ID: c.ID, Fields: map[string]any{"listId": toListID, "position": c.Position, "rank": c.Rank}, Object: c})
+		if saveFailed(w, saveErr) {
+			return
+		}
+		writeJSON(w, 200, map[string]any{"cardId": c.ID, "listId": toListID, "position": c.Position})
+	}
+}
+
+// Move a card to exactly {"index": N} within its own list. N is the card's
+// final position, counted as if the card were not in the list, and is
+// clamped to the list; other cards keep their relative order.
+func (s *Server) reorderCard(w http.ResponseWriter, r *http.Request) {
+	boardID := s.store.boardRef(chi.URLParam(r, "boardID"))
+	listID := parseID(chi.URLParam(r, "listID"))
+	cardID := parseID(chi.URLParam(r, "cardID"))
+	var req struct {
+		Index *int `json:"index"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Index == nil {
+		writeJSON(w, 400, map[string]string{"error": "index required"})
+		return
+	}
+
+	s.store.mu.Lock()
+	b := s.store.boards[boardID]
+	if b == nil {
+		s.store.mu.Unlock()
+		writeJSON(w, 404, map[string]string{"error": "board not found"})
+		return
+	}
+	if b.Closed {
+		s.store.mu.Unlock()
+		writeJSON(w, 409, map[string]string{"error": "board is closed"})
+		return
+	}
+	lst := findList(b, listID)
+	if lst == nil {
+		s.store.mu.Unlock()
+		writeJSON(w, 404, map[string]string{"error": "list not found"})
+		return
+	}
+	_, idx := findCardIn(lst, cardID)
+	if idx == -1 {
+		s.store.mu.Unlock()
+		writeJSON(w, 404, map[string]string{"error": "card not found in this list"})
+		return
+	}
+	// take the card out first, so index is always a final position and
+	// moving down doesn't land one slot short
+	c := lst.Cards[idx]
+	lst.Cards = append(lst.Cards[:idx], lst.Cards[idx+1:]...)
+	pos := min(max(*req.Index, 0), len(lst.Cards))
+	c = insertCard(lst, c, pos, nil)
+	b.Events++
+	s.store.mu.Unlock()
+	saveErr := s.store.save(r.Context())
+
+	s.store.broadcast(r.Context(), boardID, Change{Entity: "card", Op: "moved", ID: c.ID, Fields: map[string]any{"listId": listID, "position": c.Position, "rank": c.Rank}, Object: c})
+	if saveFailed(w, saveErr) {
+		return
+	}
+	writeJSON(w, 200, c)
+}
+
+// dndLocation is one end of a drag in react-beautiful-dnd's result shape.
+type dndLocation struct {
+	DroppableID string `json:"droppableId"` // list id, as a string
+	Index       int    `json:"index"`
+}
+
+// Move a card with a drag-and-drop result as front-end libraries emit it:
+// {"source": {"droppableId", "index"}, "destination": {...}}. The card is the
+// one at the source index; the destination index is its final position. An
+// optional "draggableId" (the card id) guards against a stale list.
+func (s *Server) moveCardDnD(w http.ResponseWriter, r *http.Request) {
+	boardID := s.store.boardRef(chi.URLParam(r, "boardID"))
+	var req struct {
+		DraggableID string       `json:"draggableId"`
+		Source      *dndLocation `json:"source"`
+		Destination *dndLocation `json:"destination"` // null when dropped outside a list
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Source == nil || req.Destination == nil {
+		writeJSON(w, 400, map[string]string{"error": "source and destination required"})
+		return
+	}
+	fromID, toID := parseID(req.Source.DroppableID), parseID(req.Destination.DroppableID)
+	if fromID == "" || toID == "" {
+		writeJSON(w, 400, map[string]string{"error": "droppableId must be a list id"})
+		return
+	}
+	// the card at the source index (0 if none); the move hook is asked
+	// before taking the lock, so it is looked up again after
+	cardAt := func(b *Board) ID {
+		if from := findList(b, fromID); from != nil && req.Source.Index >= 0 && req.Source.Index < len(from.Cards) {
+			return from.Cards[req.Source.Index].ID
+		}
+		return ""
+	}
+	s.store.mu.RLock()
+	var cardID ID
+	if b := s.store.boards[boardID]; b != nil {
+		cardID = cardAt(b)
+	}
+	s.store.mu.RUnlock()
+	if code, msg := s.vetMove(r.Context(), boardID, cardID, fromID, toID); code != 0 {
+		writeJSON(w, code, map[string]string{"error": msg})
+		return
+	}
+
+	s.store.mu.Lock()
+	b := s.store.boards[boardID]
+	if b == nil {
+		s.store.mu.Unlock()
+		writeJSON(w, 404, map[string]string{"error": "board not found"})
+		return
+	}
+	if b.Closed {
+		s.store.mu.Unlock()
+		writeJSON(w, 409, map[string]string{"error": "board is closed"})
+		return
+	}
+	from, to := findList(b, fromID), findList(b, toID)
+	if from == nil || to == nil {
+		s.store.mu.Unlock()
+		writeJSON(w, 404, map[string]string{"error": "list not found"})
+		return
+	}
+	id := cardAt(b)
+	if id == "" {
+		s.store.mu.Unlock()
+		writeJSON(w, 404, map[string]string{"error": "no card at source index"})
+		return
+	}
+	if id != cardID || (req.DraggableID != "" && parseID(req.DraggableID) != id) {
+		// changed since the client (or the move hook) saw it
+		s.store.mu.Unlock()
+		writeJSON(w, 409, map[string]string{"error": "the card at source index is not the one dragged; reload the board"})
+		return
+	}
+	c := from.Cards[req.Source.Index]
+	from.Cards = append(from.Cards[:req.Source.Index], from.Cards[req.Source.Index+1:]...)
+	reindex(from)
+	leaveList(b, from, to, &c)
+	c = insertCard(to, c, min(max(req.Destination.Index, 0), len(to.Cards)), nil)
+	positions := func(l *List) map[string]any {
+		ids := make([]ID, len(l.Cards))
+		for i, c := range l.Cards {
+			ids[i] = c.ID
+		}
+		return map[string]any{"listId": l.ID, "cardIds": ids}
+	}
+	lists := []map[string]any{positions(from)}
+	if to != from {
+		lists = append(lists, positions(to))
+	}
+	b.Events++
+	s.store.mu.Unlock()
+	saveErr := s.store.save(r.Context())
+
+	s.store.broadcast(r.Context(), boardID, Change{Entity: "card", Op: "moved", ID: c.ID, Fields: map[string]any{"listId": toID, "position": c.Position, "rank": c.Rank}, Object: c})
+	if saveFailed(w, saveErr) {
+		return
+	}
+	writeJSON(w, 200, map[string]any{"card": c, "lists": lists})
+}
+
+// Reorder a board's lists to match an explicit id sequence
+func (s *Server) reorderLists(w http.ResponseWriter, r *http.Request) {
+	boardID := s.store.boardRef(chi.URLParam(r, "boardID"))
+	var req struct {
+		ListIDs []ID
+	}
+	var err error
+	if req.ListIDs, err = decodeBatch(r.Body, "listIds", s.store.maxBatch, nil); err != nil || req.ListIDs == nil {
+		msg := "listIds required"
+		if errors.Is(err, errBatchTooLarge) {
+			msg = err.Error()
+		}
+		writeJSON(w, 400, map[string]string{"error": msg})
+		return
+	}
+
+	s.store.mu.Lock()
+	b := s.store.boards[boardID]
+	if b == nil {
+		s.store.mu.Unlock()
+		writeJSON(w, 404, map[string]string{"error": "board not found"})
+		return
+	}
+	if b.Closed {
+		s.store.mu.Unlock()
+		writeJSON(w, 409, map[string]string{"error": "board is closed"})
+		return
+	}
+	byID := make(map[ID]List, len(b.Lists))
+	for _, l := range b.Lists {
+		byID[l.ID] = l
+	}
+	lists := make([]List, 0, len(req.ListIDs))
+	for _, id := range req.ListIDs {
+		l, ok := byID[id]
+		if !ok {
+			break // unknown or repeated id
+		}
+		delete(byID, id)
+		lists = append(lists, l)
+	}
+	if len(lists) != len(req.ListIDs) || len(byID) > 0 {
+		s.store.mu.Unlock()
+		writeJSON(w, 400, map[string]string{"error": "listIds must name every list of the board exactly once"})
+		return
+	}
+	for i := range lists {
+		lists[i].Position = i
+	}
+	b.Lists = lists
+	b.Events++
+	s.store.mu.Unlock()
+	saveErr := s.store.save(r.Context())
+
+	s.store.broadcast(r.Context(), boardID, Change{Entity: "lists", Op: "reordered", ID: boardID, Fields: map[string]any{"listIds": req.ListIDs}})
+	if saveFailed(w, saveErr) {
+		return
+	}
+	writeJSON(w, 200, map[string]any{"listIds": req.ListIDs})
+}
+
+// Swap two lists' positions: {"listIdA": ..., "listIdB": ...}
+func (s *Server) swapLists(w http.ResponseWriter, r *http.Request) {
+	boardID := s.store.boardRef(chi.URLParam(r, "boardID"))
+	var req struct {
+		ListIDA ID `json:"listIdA"`
+		ListIDB ID `json:"listIdB"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.ListIDA == "" || req.ListIDB == "" {
+		writeJSON(w, 400, map[string]string{"error": "listIdA and listIdB required"})
+		return
+	}
+	if req.ListIDA == req.ListIDB {
+		writeJSON(w, 400, map[string]string{"error": "listIdA and listIdB must differ"})
+		return
+	}
+
+	s.store.mu.Lock()
+	b := s.store.boards[boardID]
+	if b == nil {
+		s.store.mu.Unlock()
+		writeJSON(w, 404, map[string]string{"error": "board not found"})
+		return
+	}
+	if b.Closed {
+		s.store.mu.Unlock()
+		writeJSON(w, 409, map[string]string{"error": "board is closed"})
+		return
+	}
+	i := slices.IndexFunc(b.Lists, func(l List) bool { return l.ID == req.ListIDA })
+	j := slices.IndexFunc(b.Lists, func(l List) bool { return l.ID == req.ListIDB })
+	if i == -1 || j == -1 {
+		s.store.mu.Unlock()
+		writeJSON(w, 404, map[string]string{"error": "list not found"})
+		return
+	}
+	b.Lists[i], b.Lists[j] = b.Lists[j], b.Lists[i]
+	listIDs := make([]ID, len(b.Lists))
+	for k := range b.Lists {
+		b.Lists[k].Position = k
+		listIDs[k] = b.Lists[k].ID
+	}
+	b.Events++
+	s.store.mu.Unlock()
+	saveErr := s.store.save(r.Context())
+
+	s.store.broadcast(r.Context(), boardID, Change{Entity: "lists", Op: "reordered", ID: boardID, Fields: map[string]any{"listIds": listIDs}})
+	if saveFailed(w, saveErr) {
+		return
+	}
+	writeJSON(w, 200, map[string]any{"listIds": listIDs})
+}
+
+// Move every card of a list to the end of another list, keeping their order
+func (s *Server) moveAllCards(w http.ResponseWriter, r *http.Request) {
+	boardID := s.store.boardRef(chi.URLParam(r, "boardID"))
+	listID := parseID(chi.URLParam(r, "listID"))
+	var req struct {
+		ToListID ID `json:"toListId"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.ToListID == "" {
+		writeJSON(w, 400, map[string]string{"error": "toListId required"})
+		return
+	}
+	if req.ToListID == listID {
+		writeJSON(w, 400, map[string]string{"error": "source and target list are the same"})
+		return
+	}
+	// every card has to pass the move hook, or none moves
+	var vetted []ID
+	s.store.mu.RLock()
+	if b := s.store.boards[boardID]; b != nil {
+		if from := findList(b, listID); from != nil {
+			for _, c := range from.Cards {
+				vetted = append(vetted, c.ID)
+			}
+		}
+	}
+	s.store.mu.RUnlock()
+	for _, id := range vetted {
+		if code, msg := s.vetMove(r.Context(), boardID, id, listID, req.ToListID); code != 0 {
+			writeJSON(w, code, map[string]any{"error": msg, "cardId": id})
+			return
+		}
+	}
+
+	s.store.mu.Lock()
+	b := s.store.boards[boardID]
+	if b == nil {
+		s.store.mu.Unlock()
+		writeJSON(w, 404, map[string]string{"error": "board not found"})
+		return
+	}
+	if b.Closed {
+		s.store.mu.Unlock()
+		writeJSON(w, 409, map[string]string{"error": "board is closed"})
+		return
+	}
+	from, to := findList(b, listID), findList(b, req.ToListID)
+	if from == nil || to == nil {
+		s.store.mu.Unlock()
+		writeJSON(w, 404, map[string]string{"error": "list not found"})
+		return
+	}
+	moved := make([]ID, 0, len(from.Cards))
+	for _, c := range from.Cards {
+		moved = append(moved, c.ID)
+	}
+	if !slices.Equal(moved, vetted) {
+		s.store.mu.Unlock()
+		writeJSON(w, 409, map[string]string{"error": "the list changed while the moves were being validated; retry"})
+		return
+	}
+	for _, c := range from.Cards {
+		leaveList(b, from, to, &c)
+		insertCard(to, c, -1, nil)
+	}
+	from.Cards = []Card{}
+	if len(moved) > 0 {
+		b.Events++
+	}
+	s.store.mu.Unlock()
+	if len(moved) == 0 {
+		writeJSON(w, 200, map[string]any{"moved": moved})
+		return
+	}
+	saveErr := s.store.save(r.Context())
+
+	s.store.broadcast(r.Context(), boardID, Change{Entity: "cards", Op: "moved", ID: listID, Fields: map[string]any{"cardIds": moved, "fromListId": listID, "toListId": req.ToListID}})
+	if saveFailed(w, saveErr) {
+		return
+	}
+	writeJSON(w, 200, map[string]any{"moved": moved})
+}
+
+// MergeConflict is a client change that mergeBoard could not apply because
+// the server changed the same card since the client's last-known event.
+type MergeConflict struct {
+	CardID       ID     `json:"cardId"`
+	Kind         string `json:"kind"` // "moved", "edited", "deleted", "invalid" or "refused"
+	ClientListID ID     `json:"clientListId,omitempty"`
+	ServerListID ID     `json:"serverListId,omitempty"`
+	Error        string `json:"error,omitempty"`
+}
+
+// Merge an offline client's copy of a board. The client's "events" value is
+// the common base; server changes since then come from the event log.
+func (s *Server) mergeBoard(w http.ResponseWriter, r *http.Request) {
+	boardID := s.store.boardRef(chi.URLParam(r, "boardID"))
+	var req Board
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, 400, map[string]string{"error": "bad request"})
+		return
+	}
+
+	// Ask the move hook about every move the merge would make, before
+	// locking; verdicts holds "" for approved moves, else the refusal.
+	type move struct{ card, from, to ID }
+	var moves []move
+	s.store.mu.RLock()
+	if b := s.store.boards[boardID]; b != nil {
+		for _, cl := range req.Lists {
+			for _, cc := range cl.Cards {
+				if from, _ := findCard(b, cc.ID); cc.ID != "" && from != nil && from.ID != cl.ID && findList(b, cl.ID) != nil {
+					moves = append(moves, move{cc.ID, from.ID, cl.ID})
+				}
+			}
+		}
+	}
+	s.store.mu.RUnlock()
+	verdicts := map[move]string{}
+	for _, m := range moves {
+		_, verdicts[m] = s.vetMove(r.Context(), boardID, m.card, m.from, m.to)
+	}
+
+	s.store.mu.Lock()
+	b := s.store.boards[boardID]
+	if b == nil {
+		s.store.mu.Unlock()
+		writeJSON(w, 404, map[string]string{"error": "board not found"})
+		return
+	}
+	if b.Closed {
+		s.store.mu.Unlock()
+		writeJSON(w, 409, map[string]string{"error": "board is closed"})
+		return
+	}
+	if req.Events > b.Events {
+		s.store.mu.Unlock()
+		writeJSON(w, 400, map[string]string{"error": "events is ahead of the server"})
+		return
+	}
+	since, oldest, _ := s.store.eventsSince(boardID, req.Events)
+	if oldest > 0 && req.Events < oldest-1 {
+		s.store.mu.Unlock()
+		writeJSON(w, 409, map[string]string{"error": "too far behind to merge; re-fetch the board"})
+		return
+	}
+
+	// what the server did to each card after the base
+	moved, edited := map[ID]bool{}, map[ID]bool{}
+	for _, e := range since {
+		switch {
+		case e.Entity == "card" && e.Op == "moved":
+			moved[e.EntityID] = true
+		case e.Entity == "card" && e.Op == "updated":
+			edited[e.EntityID] = true
+		case e.Entity == "cards" && e.Op == "moved":
+			var f struct {
+				CardIDs []ID `json:"cardIds"`
+			}
+			_ = json.Unmarshal(e.Fields, &f)
+			for _, id := range f.CardIDs {
+				moved[id] = true
+			}
+		}
+	}
+
+	truncate := r.URL.Query().Get("truncate") == "true"
+	var changes []Change
+	conflicts := []MergeConflict{}
+	for _, cl := range req.Lists {
+		to := findList(b, cl.ID)
+		for _, cc := range cl.Cards {
+			if to == nil {
+				conflicts = append(conflicts, MergeConflict{CardID: cc.ID, Kind: "deleted", ClientListID: cl.ID, Error: "list not found"})
+				continue
+			}
+			title := cleanTitle(cc.Title)
+			desc, cut, msg := limitDescription(cleanDescription(cc.Description), s.store.maxDesc, truncate)
+			if title == "" {
+				msg = "title required"
+			} else if m := titleTooLong(title); m != "" {
+				msg = m
+			}
+			if msg != "" {
+				conflicts = append(conflicts, MergeConflict{CardID: cc.ID, Kind: "invalid", ClientListID: cl.ID, Error: msg})
+				continue
+			}
+
+			// a card without an id was created offline
+			if cc.ID == "" {
+				card := Card{ID: newID(), Title: title, Description: desc, DescriptionTruncated: cut, Number: nextCardNumber(b)}
+				card = insertCard(to, card, -1, nil)
+				changes = append(changes, Change{Entity: "card", Op: "created", ID: card.ID, Fields: card, Object: card})
+				continue
+			}
+			from, idx := findCard(b, cc.ID)
+			if from == nil {
+				conflicts = append(conflicts, MergeConflict{CardID: cc.ID, Kind: "deleted", ClientListID: cl.ID})
+				continue
+			}
+			if from.ID != to.ID {
+				if moved[cc.ID] {
+					conflicts = append(conflicts, MergeConflict{CardID: cc.ID, Kind: "moved", ClientListID: to.ID, ServerListID: from.ID})
+					continue
+				}
+				verdict, vetted := verdicts[move{cc.ID, from.ID, to.ID}]
+				if !vetted {
+					verdict = "the board changed while the move was being validated; retry"
+				}
+				if verdict != "" {
+					conflicts = append(conflicts, MergeConflict{CardID: cc.ID, Kind: "refused", ClientListID: to.ID, ServerListID: from.ID, Error: verdict})
+					continue
+				}
+				c := from.Cards[idx]
+				from.Cards = append(from.Cards[:idx], from.Cards[idx+1:]...)
+				reindex(from)
+				leaveList(b, from, to, &c)
+				c = insertCard(to, c, -1, nil)
+				changes = append(changes, Change{Entity: "card", Op: "moved", ID: c.ID, Fields: map[string]any{"listId": to.ID, "position": c.Position, "rank": c.Rank}, Object: c})
+				from, idx = findCard(b, cc.ID)
+			}
+			c := &from.Cards[idx]
+			if c.Title == title && c.Description == desc {
+				continue
+			}
+			if edited[cc.ID] {
+				conflicts = append(conflicts, MergeConflict{CardID: cc.ID, Kind: "edited", ClientListID: to.ID, ServerListID: from.ID})
+				continue
+			}
+			changed := map[string]any{}
+			if c.Title != title {
+				c.Title = title
+				changed["title"] = title
+			}
+			if c.Description != desc {
+				c.Description, c.DescriptionTruncated = desc, cut
+				changed["description"] = desc
+			}
+			changes = append(changes, Change{Entity: "card", Op: "updated", ID: c.ID, Fields: changed, Object: *c})
+		}
+	}
+	// one event per applied change, so later merges can see them in the log;
+	// logged before unlocking so no other change can slip in between
+	for _, c := range changes {
+		b.Events++
+		s.store.broadcastLocked(r.Context(), boardID, c)
+	}
+	events := b.Events
+	s.store.mu.Unlock()
+	var saveErr error
+	if len(changes) > 0 {
+		saveErr = s.store.save(r.Context())
+	}
+	if saveFailed(w, saveErr) {
+		return
+	}
+	writeJSON(w, 200, map[string]any{"applied": len(changes), "conflicts": conflicts, "events": events})
+}
+
+// Log time spent on a card
+func (s *Server) addTimeLog(w http.ResponseWriter, r *http.Request) {
+	boardID := s.store.boardRef(chi.URLParam(r, "boardID"))
+	cardID := parseID(chi.URLParam(r, "cardID"))
+	var req struct {
+		User    string `json:"user"`
+		Minutes int    `json:"minutes"`
+		Note    string `json:"note"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Minutes <= 0 {
+		writeJSON(w, 400, map[string]string{"error": "minutes must be > 0"})
+		return
+	}
+
+	s.store.mu.Lock()
+	b := s.store.boards[boardID]
+	if b == nil {
+		s.store.mu.Unlock()
+		writeJSON(w, 404, map[string]string{"error": "board not found"})
+		return
+	}
+	if b.Closed {
+		s.store.mu.Unlock()
+		writeJSON(w, 409, map[string]string{"error": "board is closed"})
+		return
+	}
+	lst, idx := findCard(b, cardID)
+	if lst == nil {
+		s.store.mu.Unlock()
+		writeJSON(w, 404, map[string]string{"error": "card not found"})
+		return
+	}
+	c := &lst.Cards[idx]
+	tl := TimeLog{User: req.User, Minutes: req.Minutes, Note: req.Note, LoggedAt: time.Now().UTC()}
+	c.TimeLogs = append(c.TimeLogs, tl)
+	c.TotalMinutes += tl.Minutes
+	c.UpdatedAt = tl.LoggedAt
+	card := *c
+	b.Events++
+	s.store.mu.Unlock()
+	saveErr := s.store.save(r.Context())
+
+	s.store.broadcast(r.Context(), boardID, Change{Entity: "card", Op: "updated", ID: card.ID, Fields: map[string]any{"timeLogs": card.TimeLogs, "totalMinutes": card.TotalMinutes}, Object: card})
+	if saveFailed(w, saveErr) {
+		return
+	}
+	writeJSON(w, 201, tl)
+}
+
+// Total time logged on a card
+func (s *Server) cardTime(w http.ResponseWriter, r *http.Request) {
+	boardID := s.store.boardRef(chi.URLParam(r, "boardID"))
+	s.store.touch(boardID)
+	cardID := parseID(chi.URLParam(r, "cardID"))
+	s.store.mu.RLock()
+	defer s.store.mu.RUnlock()
+	b := s.store.boards[boardID]
+	if b == nil {
+		writeJSON(w, 404, map[string]string{"error": "board not found"})
+		return
+	}
+	lst, idx := findCard(b, cardID)
+	if lst == nil {
+		writeJSON(w, 404, map[string]string{"error": "card not found"})
+		return
+	}
+	c := lst.Cards[idx]
+	writeJSON(w, 200, map[string]any{"cardId": c.ID, "totalMinutes": c.TotalMinutes, "logs": c.TimeLogs})
+}
+
+// Cheap change detector for polling clients: just the board's Events counter
+func (s *Server) syncToken(w http.ResponseWriter, r *http.Request) {
+	boardID := s.store.boardRef(chi.URLParam(r, "boardID"))
+	s.store.mu.RLock()
+	b := s.store.boards[boardID]
+	var n int64
+	if b != nil {
+		n = b.Events
+	}
+	s.store.mu.RUnlock()
+	if b == nil {
+		writeJSON(w, 404, map[string]string{"error": "board not found"})
+		return
+	}
+	writeJSON(w, 200, map[string]int64{"events": n})
+}
+
+// Cards bucketed by due date: /boards/{boardID}/agenda?tz=+02:00 (or an
+// X-Timezone header). Weeks run Monday to Sunday in that zone (UTC by
+// default).
+func (s *Server) agenda(w http.ResponseWriter, r *http.Request) {
+	boardID := s.store.boardRef(chi.URLParam(r, "boardID"))
+	s.store.touch(boardID)
+	loc, err := requestTZ(r)
+	if err != nil {
+		writeJSON(w, 400, map[string]string{"error": "bad tz: " + err.Error()})
+		return
+	}
+
+	type entry struct {
+		ListID ID   `json:"listId"`
+		Card   Card `json:"card"`
+	}
+	buckets := map[string][]entry{"overdue": {}, "today": {}, "thisWeek": {}, "later": {}, "noDue": {}}
+
+	now := time.Now().In(loc)
+	dayStart := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, loc)
+	tomorrow := dayStart.AddDate(0, 0, 1)
+	weekEnd := dayStart.AddDate(0, 0, 7-(int(now.Weekday())+6)%7)
+
+	s.store.mu.RLock()
+	b := s.store.boards[boardID]
+	if b == nil {
+		s.store.mu.RUnlock()
+		writeJSON(w, 404, map[string]string{"error": "board not found"})
+		return
+	}
+	for _, l := range b.Lists {
+		for _, c := range l.Cards {
+			e := entry{ListID: l.ID, Card: c}
+			switch {
+			case c.Due == nil:
+				buckets["noDue"] = append(buckets["noDue"], e)
+			case c.Due.Before(now):
+				buckets["overdue"] = append(buckets["overdue"], e)
+			case c.Due.Before(tomorrow):
+				buckets["today"] = append(buckets["today"], e)
+			case c.Due.Before(weekEnd):
+				buckets["thisWeek"] = append(buckets["thisWeek"], e)
+			default:
+				buckets["later"] = append(buckets["later"], e)
+			}
+		}
+	}
+	s.store.mu.RUnlock()
+
+	for k, es := range buckets {
+		if k == "noDue" {
+			continue
+		}
+		sort.SliceStable(es, func(i, j int) bool { return es[i].Card.Due.Before(*es[j].Card.Due) })
+	}
+	writeJSON(w, 200, buckets)
+}
+
+// Mark a card done or not done. Body {"done": bool} is optional; without it
+// the current state is toggled.
+func (s *Server) completeCard(w http.ResponseWriter, r *http.Request) {
+	boardID := s.store.boardRef(chi.URLParam(r, "boardID"))
+	cardID := parseID(chi.URLParam(r, "cardID"))
+	var req struct {
+		Done *bool `json:"done"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		writeJSON(w, 400, map[string]string{"error": "bad request"})
+		return
+	}
+
+	// A completion rule's move needs the move hook's approval like any
+	// other; if refused the card is completed where it is.
+	var vettedFrom, approved ID
+	s.store.mu.RLock()
+	if b := s.store.boards[boardID]; b != nil {
+		if lst, idx := findCard(b, cardID); lst != nil && !lst.Cards[idx].Done && (req.Done == nil || *req.Done) {
+			if to, _ := completionTarget(b, lst); to != nil {
+				vettedFrom, approved = lst.ID, to.ID
+			}
+		}
+	}
+	s.store.mu.RUnlock()
+	if approved != "" {
+		if code, msg := s.vetMove(r.Context(), boardID, cardID, vettedFrom, approved); code != 0 {
+			log.Printf("board %s: completion rule did not move card %s: %s", boardID, cardID, msg)
+			approved = ""
+		}
+	}
+
+	s.store.mu.Lock()
+	b := s.store.boards[boardID]
+	if b == nil {
+		s.store.mu.Unlock()
+		writeJSON(w, 404, map[string]string{"error": "board not found"})
+		return
+	}
+	if b.Closed {
+		s.store.mu.Unlock()
+		writeJSON(w, 409, map[string]string{"error": "board is closed"})
+		return
+	}
+	lst, idx := findCard(b, cardID)
+	if lst == nil {
+		s.store.mu.Unlock()
+		writeJSON(w, 404, map[string]string{"error": "card not found"})
+		return
+	}
+	c := &lst.Cards[idx]
+	done := !c.Done
+	if req.Done != nil {
+		done = *req.Done
+	}
+	changed := c.Done != done
+	if changed {
+		c.Done = done
+		c.CompletedAt = nil
+		now := time.Now().UTC()
+		c.UpdatedAt = now
+		if done {
+			c.CompletedAt = &now
+		}
+		b.Events++
+	}
+	card := *c
+	var ruleMove *Change
+	if changed && done && lst.ID == vettedFrom {
+		if ruleMove = completionRule(b, lst, idx, approved); ruleMove != nil {
+			card = ruleMove.Object.(Card)
+		}
+	}
+	s.store.mu.Unlock()
+	if !changed {
+		writeJSON(w, 200, card)
+		return
+	}
+
+	op := "reopened"
+	if done {
+		op = "completed"
+	}
+	s.store.broadcast(r.Context(), boardID, Change{Entity: "card", Op: op, ID: card.ID, Fields: map[string]any{"done": card.Done, "completedAt": card.CompletedAt}, Object: card})
+	if ruleMove != nil {
+		s.store.mu.Lock()
+		b.Events++
+		s.store.mu.Unlock()
+		s.store.broadcast(r.Context(), boardID, *ruleMove)
+	}
+	if saveFailed(w, s.store.save(r.Context())) {
+		return
+	}
+	writeJSON(w, 200, card)
+}
+
+// Bump a card's updatedAt without changing it ("reviewed")
+func (s *Server) touchCard(w http.ResponseWriter, r *http.Request) {
+	boardID := s.store.boardRef(chi.URLParam(r, "boardID"))
+	cardID := parseID(chi.URLParam(r, "cardID"))
+
+	s.store.mu.Lock()
+	b := s.store.boards[boardID]
+	if b == nil {
+		s.store.mu.Unlock()
+		writeJSON(w, 404, map[string]string{"error": "board not found"})
+		return
+	}
+	if b.Closed {
+		s.store.mu.Unlock()
+		writeJSON(w, 409, map[string]string{"error": "board is closed"})
+		return
+	}
+	lst, idx := findCard(b, cardID)
+	if lst == nil {
+		s.store.mu.Unlock()
+		writeJSON(w, 404, map[string]string{"error": "card not found"})
+		return
+	}
+	c := &lst.Cards[idx]
+	c.UpdatedAt = time.Now().UTC()
+	card := *c
+	b.Events++
+	s.store.mu.Unlock()
+	saveErr := s.store.save(r.Context())
+
+	s.store.broadcast(r.Context(), boardID, Change{Entity: "card", Op: "updated", ID: card.ID, Fields: map[string]any{"updatedAt": card.UpdatedAt}, Object: card})
+	if saveFailed(w, saveErr) {
+		return
+	}
+	writeJSON(w, 200, card)
+}
+
+// Renumber list and card positions 0..n-1 in their current order, for
+// boards whose positions were broken by hand edits or imports
+func (s *Server) reindexBoard(w http.ResponseWriter, r *http.Request) {
+	boardID := s.store.boardRef(chi.URLParam(r, "boardID"))
+
+	s.store.mu.Lock()
+	b := s.store.boards[boardID]
+	if b == nil {
+		s.store.mu.Unlock()
+		writeJSON(w, 404, map[string]string{"error": "board not found"})
+		return
+	}
+	if b.Closed {
+		s.store.mu.Unlock()
+		writeJSON(w, 409, map[string]string{"error": "board is closed"})
+		return
+	}
+	normalizeBoard(b)
+	b.Events++
+	out := *b
+	out.Lists = make([]List, len(b.Lists))
+	for i, l := range b.Lists {
+		l.Cards = append([]Card{}, l.Cards...)
+		out.Lists[i] = l
+	}
+	s.store.mu.Unlock()
+	saveErr := s.store.save(r.Context())
+
+	order := make([]ID, len(out.Lists))
+	for i, l := range out.Lists {
+		order[i] = l.ID
+	}
+	s.store.broadcast(r.Context(), boardID, Change{Entity: "board", Op: "reindexed", ID: boardID, Fields: map[string]any{"listIds": order}})
+	if saveFailed(w, saveErr) {
+		return
+	}
+	writeJSON(w, 200, out)
+}
+
+// Reassign card numbers 1..n, closing gaps left by imports and deletions.
+// Admin only: references to the old numbers elsewhere stop matching.
+// ?order=created (default) numbers by creation time, ?order=position by
+// list and card position with archived cards last.
+func (s *Server) renumberCards(w http.ResponseWriter, r *http.Request) {
+	boardID := s.store.boardRef(chi.URLParam(r, "boardID"))
+	order := r.URL.Query().Get("order")
+	if order == "" {
+		order = "created"
+	}
+	if order != "created" && order != "position" {
+		writeJSON(w, 400, map[string]string{"error": "order must be created or position"})
+		return
+	}
+
+	s.store.mu.Lock()
+	b := s.store.boards[boardID]
+	if b == nil {
+		s.store.mu.Unlock()
+		writeJSON(w, 404, map[string]string{"error": "board not found"})
+		return
+	}
+	if b.Closed {
+		s.store.mu.Unlock()
+		writeJSON(w, 409, map[string]string{"error": "board is closed"})
+		return
+	}
+	var cards []*Card
+	for i := range b.Lists {
+		for j := range b.Lists[i].Cards {
+			cards = append(cards, &b.Lists[i].Cards[j])
+		}
+	}
+	placed := len(cards)
+	for i := range b.Archive {
+		cards = append(cards, &b.Archive[i])
+	}
+	byCreation := func(x, y *Card) int {
+		return cmp.Or(x.CreatedAt.Compare(y.CreatedAt), cmp.Compare(x.Number, y.Number))
+	}
+	if order == "created" {
+		slices.SortStableFunc(cards, byCreation)
+	} else {
+		slices.SortStableFunc(cards[placed:], byCreation)
+	}
+	numbers := map[int]int{} // old -> new, changed cards only
+	changed := []ID{}        // the changed cards still on the board
+	for i, c := range cards {
+		if c.Number != i+1 {
+			numbers[c.Number] = i + 1
+			c.Number = i + 1
+			if c.ArchivedFrom == "" {
+				changed = append(changed, c.ID)
+			}
+		}
+	}
+	b.NextCardNumber = len(cards) + 1
+	b.Events++
+	next := b.NextCardNumber
+	s.store.mu.Unlock()
+	saveErr := s.store.save(r.Context())
+
+	s.store.broadcast(r.Context(), boardID, Change{Entity: "cards", Op: "renumbered", ID: boardID, Fields: map[string]any{"numbers": numbers, "cardIds": changed}})
+	if saveFailed(w, saveErr) {
+		return
+	}
+	writeJSON(w, 200, map[string]any{"renumbered": len(numbers), "numbers": numbers, "nextCardNumber": next})
+}
+
+// copyBoard returns a deep copy of b, sharing nothing with it.
+func copyBoard(b *Board) (*Board, error) {
+	data, err := json.Marshal(b)
+	if err != nil {
+		return nil, err
+	}
+	var c Board
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// copyList returns a deep copy of l, sharing nothing with it.
+func copyList(l List) (List, error) {
+	data, err := json.Marshal(l)
+	if err != nil {
+		return List{}, err
+	}
+	var c List
+	err = json.Unmarshal(data, &c)
+	return c, err
+}
+
+// snapshotInfo describes a snapshot without its copy of the board.
+func snapshotInfo(sn BoardSnapshot) map[string]any {
+	cards := 0
+	for _, l := range sn.Board.Lists {
+		cards += len(l.Cards)
+	}
+	return map[string]any{"id": sn.ID, "name": sn.Name, "createdAt": sn.CreatedAt, "lists": len(sn.Board.Lists), "cards": cards}
+}
+
+// Save the board as a named restore point: {"name": "before planning"}
+func (s *Server) createSnapshot(w http.ResponseWriter, r *http.Request) {
+	boardID := s.store.boardRef(chi.URLParam(r, "boardID"))
+	var req struct {
+		Name string `json:"name"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&req)
+	req.Name = cleanTitle(req.Name)
+	if err != nil || req.Name == "" {
+		writeJSON(w, 400, map[string]string{"error": "name required"})
+		return
+	}
+	if msg := titleTooLong(req.Name); msg != "" {
+		writeJSON(w, 400, map[string]string{"error": msg})
+		return
+	}
+
+	s.store.mu.Lock()
+	b := s.store.boards[boardID]
+	if b == nil {
+		s.store.mu.Unlock()
+		writeJSON(w, 404, map[string]string{"error": "board not found"})
+		return
+	}
+	if b.Closed {
+		s.store.mu.Unlock()
+		writeJSON(w, 409, map[string]string{"error": "board is closed"})
+		return
+	}
+	cp, err := copyBoard(b)
+	if err != nil {
+		s.store.mu.Unlock()
+		writeJSON(w, 500, map[string]string{"error": err.Error()})
+		return
+	}
+	sn := BoardSnapshot{ID: newID(), Name: req.Name, CreatedAt: time.Now().UTC(), Board: cp}
+	snaps := append(s.store.snapshots[boardID], sn)
+	if len(snaps) > maxSnapshots {
+		snaps = slices.Delete(snaps, 0, len(snaps)-maxSnapshots)
+	}
+	s.store.snapshots[boardID] = snaps
+	s.store.unlogged++
+	s.store.mu.Unlock()
+	if saveFailed(w, s.store.save(r.Context())) {
+		return
+	}
+	writeJSON(w, 201, snapshotInfo(sn))
+}
+
+// List a board's restore points, newest first
+func (s *Server) listSnapshots(w http.ResponseWriter, r *http.Request) {
+	boardID := s.store.boardRef(chi.URLParam(r, "boardID"))
+	s.store.mu.RLock()
+	if s.store.boards[boardID] == nil {
+		s.store.mu.RUnlock()
+		writeJSON(w, 404, map[string]string{"error": "board not found"})
+		return
+	}
+	snaps := s.store.snapshots[boardID]
+	out := make([]map[string]any, len(snaps))
+	for i, sn := range snaps {
+		out[len(snaps)-1-i] = snapshotInfo(sn)
+	}
+	s.store.mu.RUnlock()
+	writeJSON(w, 200, out)
+}
+
+// Revert the board to a snapshot. The board keeps its identity (id, slug,
+// password, closed state) and its event sequence, and card numbers handed
+// out since the snapshot are not reused. Subscribers get board.resync.
+func (s *Server) restoreSnapshot(w http.ResponseWriter, r *http.Request) {
+	boardID := s.store.boardRef(chi.URLParam(r, "boardID"))
+	snapID := parseID(chi.URLParam(r, "snapshotID"))
+
+	s.store.mu.Lock()
+	b := s.store.boards[boardID]
+	if b == nil {
+		s.store.mu.Unlock()
+		writeJSON(w, 404, map[string]string{"error": "board not found"})
+		return
+	}
+	if b.Closed {
+		s.store.mu.Unlock()
+		writeJSON(w, 409, map[string]string{"error": "board is closed"})
+		return
+	}
+	i := slices.IndexFunc(s.store.snapshots[boardID], func(sn BoardSnapshot) bool { return sn.ID == snapID })
+	if i == -1 {
+		s.store.mu.Unlock()
+		writeJSON(w, 404, map[string]string{"error": "snapshot not found"})
+		return
+	}
+	sn := s.store.snapshots[boardID][i]
+	nb, err := copyBoard(sn.Board) // the snapshot stays reusable
+	if err != nil {
+		s.store.mu.Unlock()
+		writeJSON(w, 500, map[string]string{"error": err.Error()})
+		return
+	}
+	nb.ID, nb.Slug, nb.ClientID, nb.Protected, nb.Closed = b.ID, b.Slug, b.ClientID, b.Protected, b.Closed
+	nb.NextCardNumber = max(nb.NextCardNumber, b.NextCardNumber)
+	nb.Events = b.Events + 1
+	nb.LastActivityAt = time.Now().UTC()
+	normalizeBoard(nb)
+	*b = *nb
+	out, _ := copyBoard(b)
+	s.store.mu.Unlock()
+	saveErr := s.store.save(r.Context())
+
+	s.store.broadcast(r.Context(), boardID, Change{Entity: "board", Op: "resync", ID: boardID, Fields: map[string]any{"reason": "restored", "snapshotId": sn.ID, "name": sn.Name}})
+	if saveFailed(w, saveErr) {
+		return
+	}
+	writeJSON(w, 200, out)
+}
+
+// Set (POST {"url": ...}) or remove (DELETE) a card's cover image
+func (s *Server) setCover(set bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		boardID := s.store.boardRef(chi.URLParam(r, "boardID"))
+		cardID := parseID(chi.URLParam(r, "cardID"))
+		var cover string
+		if set {
+			var req struct {
+				URL string `json:"url"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.URL == "" {
+				writeJSON(w, 400, map[string]string{"error": "url required"})
+				return
+			}
+			if msg := coverError(req.URL); msg != "" {
+				writeJSON(w, 400, map[string]string{"error": msg})
+				return
+			}
+			cover = req.URL
+		}
+
+		s.store.mu.Lock()
+		b := s.store.boards[boardID]
+		if b == nil {
+			s.store.mu.Unlock()
+			writeJSON(w, 404, map[string]string{"error": "board not found"})
+			return
+		}
+		if b.Closed {
+			s.store.mu.Unlock()
+			writeJSON(w, 409, map[string]string{"error": "board is closed"})
+			return
+		}
+		lst, idx := findCard(b, cardID)
+		if lst == nil {
+			s.store.mu.Unlock()
+			writeJSON(w, 404, map[string]string{"error": "card not found"})
+			return
+		}
+		c := &lst.Cards[idx]
+		c.CoverURL = cover
+		c.UpdatedAt = time.Now().UTC()
+		card := *c
+		b.Events++
+		s.store.mu.Unlock()
+		saveErr := s.store.save(r.Context())
+
+		s.store.broadcast(r.Context(), boardID, Change{Entity: "card", Op: "updated", ID: card.ID, Fields: map[string]any{"coverUrl": card.CoverURL}, Object: card})
+		if saveFailed(w, saveErr) {
+			return
+		}
+		writeJSON(w, 200, card)
+	}
+}
+
+// Completed vs open card counts for a board
+func (s *Server) boardStats(w http.ResponseWriter, r *http.Request) {
+	boardID := s.store.boardRef(chi.URLParam(r, "boardID"))
+	s.store.touch(boardID)
+	s.store.mu.RLock()
+	b := s.store.boards[boardID]
+	if b == nil {
+		s.store.mu.RUnlock()
+		writeJSON(w, 404, map[string]string{"error": "board not found"})
+		return
+	}
+	var total, done int
+	for _, l := range b.Lists {
+		for _, c := range l.Cards {
+			total++
+			if c.Done {
+				done++
+			}
+		}
+	}
+	s.store.mu.RUnlock()
+
+	rate := 0.0
+	if total > 0 {
+		rate = float64(done) / float64(total)
+	}
+	writeJSON(w, 200, map[string]any{"total": total, "completed": done, "open": total - done, "completionRate": rate})
+}
+
+// Flow metrics: per-list WIP and average stay, and cycle time (creation to
+// done) over completed cards, archived ones included
+func (s *Server) flowMetrics(w http.ResponseWriter, r *http.Request) {
+	boardID := s.store.boardRef(chi.URLParam(r, "boardID"))
+	s.store.touch(boardID)
+	type listFlow struct {
+		ListID         ID     `json:"listId"`
+		Title          string `json:"title"`
+		WIP            int    `json:"wip"`            // open cards in the list now
+		Exits          int    `json:"exits"`          // cards that moved on
+		AvgStaySeconds int64  `json:"avgStaySeconds"` // over exits; 0 without any
+	}
+	lists := []listFlow{}
+	var completed int
+	var cycle int64
+	s.store.mu.RLock()
+	b := s.store.boards[boardID]
+	if b == nil {
+		s.store.mu.RUnlock()
+		writeJSON(w, 404, map[string]string{"error": "board not found"})
+		return
+	}
+	countDone := func(c Card) {
+		if c.Done && c.CompletedAt != nil {
+			completed++
+			cycle += int64(c.CompletedAt.Sub(c.CreatedAt).Seconds())
+		}
+	}
+	for _, l := range b.Lists {
+		lf := listFlow{ListID: l.ID, Title: l.Title}
+		for _, c := range l.Cards {
+			if !c.Done {
+				lf.WIP++
+			}
+			countDone(c)
+		}
+		if st := b.Flow[l.ID]; st != nil && st.Cards > 0 {
+			lf.Exits, lf.AvgStaySeconds = st.Cards, st.Seconds/int64(st.Cards)
+		}
+		lists = append(lists, lf)
+	}
+	for _, c := range b.Archive {
+		countDone(c)
+	}
+	s.store.mu.RUnlock()
+
+	var avgCycle int64
+	if completed > 0 {
+		avgCycle = cycle / int64(completed)
+	}
+	writeJSON(w, 200, map[string]any{"lists": lists, "cycleTime": map[string]any{"completed": completed, "avgSeconds": avgCycle}})
+}
+
+type agingBucket struct {
+	label string
+	under time.Duration
+}
+
+// agingBuckets are listAging's buckets: a card falls in the first one whose
+// upper bound its time in the list is under.
+var agingBuckets = []agingBucket{
+	{"<1d", 24 * time.Hour},
+	{"1-3d", 3 * 24 * time.Hour},
+	{"3-7d", 7 * 24 * time.Hour},
+	{">7d", math.MaxInt64},
+}
+
+// Histogram of how long the list's cards have been in it, from ListEnteredAt
+func (s *Server) listAging(w http.ResponseWriter, r *http.Request) {
+	boardID := s.store.boardRef(chi.URLParam(r, "boardID"))
+	listID := parseID(chi.URLParam(r, "listID"))
+	s.store.touch(boardID)
+	type bucket struct {
+		Label string `json:"label"`
+		Count int    `json:"count"`
+	}
+	buckets := make([]bucket, len(agingBuckets))
+	for i, ab := range agingBuckets {
+		buckets[i].Label = ab.label
+	}
+	s.store.mu.RLock()
+	b := s.store.boards[boardID]
+	if b == nil {
+		s.store.mu.RUnlock()
+		writeJSON(w, 404, map[string]string{"error": "board not found"})
+		return
+	}
+	l := findList(b, listID)
+	if l == nil {
+		s.store.mu.RUnlock()
+		writeJSON(w, 404, map[string]string{"error": "list not found"})
+		return
+	}
+	now := time.Now()
+	for _, c := range l.Cards {
+		age := now.Sub(c.ListEnteredAt)
+		buckets[slices.IndexFunc(agingBuckets, func(ab agingBucket) bool { return age < ab.under })].Count++
+	}
+	total := len(l.Cards)
+	s.store.mu.RUnlock()
+	writeJSON(w, 200, map[string]any{"listId": listID, "cards": total, "buckets": buckets})
+}
+
+// Remove (or with ?archive=true, archive) every done card on the board
+func (s *Server) clearDone(w http.ResponseWriter, r *http.Request) {
+	boardID := s.store.boardRef(chi.URLParam(r, "boardID"))
+	archive := r.URL.Query().Get("archive") == "true"
+
+	s.store.mu.Lock()
+	b := s.store.boards[boardID]
+	if b == nil {
+		s.store.mu.Unlock()
+		writeJSON(w, 404, map[string]string{"error": "board not found"})
+		return
+	}
+	if b.Closed {
+		s.store.mu.Unlock()
+		writeJSON(w, 409, map[string]string{"error": "board is closed"})
+		return
+	}
+	cleared := []ID{}
+	now := time.Now().UTC()
+	for i := range b.Lists {
+		l := &b.Lists[i]
+		kept := l.Cards[:0]
+		for _, c := range l.Cards {
+			if !c.Done {
+				kept = append(kept, c)
+				continue
+			}
+			cleared = append(cleared, c.ID)
+			if archive {
+				c.ArchivedAt, c.ArchivedFrom = &now, l.ID
+				b.Archive = append(b.Archive, c)
+			}
+		}
+		l.Cards = kept
+		reindex(l)
+	}
+	if !archive {
+		for _, id := range cleared {
+			unlinkCard(b, id)
+		}
+	}
+	if len(cleared) > 0 {
+		b.Events++
+	}
+	s.store.mu.Unlock()
+	out := map[string]any{"cleared": len(cleared), "cardIds": cleared, "archived": archive}
+	if len(cleared) == 0 {
+		writeJSON(w, 200, out)
+		return
+	}
+	saveErr := s.store.save(r.Context())
+
+	s.store.broadcast(r.Context(), boardID, Change{Entity: "cards", Op: "cleared", ID: boardID, Fields: out})
+	if saveFailed(w, saveErr) {
+		return
+	}
+	writeJSON(w, 200, out)
+}
+
+// Archive every card in a list; ?olderThan=7d only those idle that long
+// (by updatedAt, as for /stale)
+func (s *Server) archiveList(w http.ResponseWriter, r *http.Request) {
+	boardID := s.store.boardRef(chi.URLParam(r, "boardID"))
+	listID := parseID(chi.URLParam(r, "listID"))
+	var olderThan time.Duration
+	if v := r.URL.Query().Get("olderThan"); v != "" {
+		d, err := parseAge(v)
+		if err != nil || d < 0 {
+			writeJSON(w, 400, map[string]string{"error": "olderThan must be a duration such as 36h or 7d"})
+			return
+		}
+		olderThan = d
+	}
+
+	s.store.mu.Lock()
+	b := s.store.boards[boardID]
+	if b == nil {
+		s.store.mu.Unlock()
+		writeJSON(w, 404, map[string]string{"error": "board not found"})
+		return
+	}
+	if b.Closed {
+		s.store.mu.Unlock()
+		writeJSON(w, 409, map[string]string{"error": "board is closed"})
+		return
+	}
+	l := findList(b, listID)
+	if l == nil {
+		s.store.mu.Unlock()
+		writeJSON(w, 404, map[string]string{"error": "list not found"})
+		return
+	}
+	archived := []ID{}
+	now := time.Now().UTC()
+	kept := l.Cards[:0]
+	for _, c := range l.Cards {
+		if now.Sub(c.UpdatedAt) < olderThan {
+			kept = append(kept, c)
+			continue
+		}
+		archived = append(archived, c.ID)
+		c.ArchivedAt, c.ArchivedFrom = &now, l.ID
+		b.Archive = append(b.Archive, c)
+	}
+	l.Cards = kept
+	reindex(l)
+	if len(archived) > 0 {
+		b.Events++
+	}
+	s.store.mu.Unlock()
+	out := map[string]any{"archived": len(archived), "cardIds": archived}
+	if len(archived) == 0 {
+		writeJSON(w, 200, out)
+		return
+	}
+	saveErr := s.store.save(r.Context())
+
+	s.store.broadcast(r.Context(), boardID, Change{Entity: "cards", Op: "archived", ID: boardID, Fields: map[string]any{"listId": listID, "cardIds": archived}})
+	if saveFailed(w, saveErr) {
+		return
+	}
+	writeJSON(w, 200, out)
+}
+
+// deleteCards removes the cards in {"cardIds": [...]} from wherever they are
+// on the board (lists or archive) as one change. Unknown ids are reported
+// in "missing" rather than failing the request.
+func (s *Server) deleteCards(w http.ResponseWriter, r *http.Request) {
+	boardID := s.store.boardRef(chi.URLParam(r, "boardID"))
+	var req struct {
+		CardIDs []ID
+	}
+	var err error
+	if req.CardIDs, err = decodeBatch(r.Body, "cardIds", s.store.maxBatch, nil); err != nil || len(req.CardIDs) == 0 {
+		msg := "cardIds required"
+		if errors.Is(err, errBatchTooLarge) {
+			msg = err.Error()
+		}
+		writeJSON(w, 400, map[string]string{"error": msg})
+		return
+	}
+	want := map[ID]bool{}
+	for _, id := range req.CardIDs {
+		want[id] = true
+	}
+
+	s.store.mu.Lock()
+	b := s.store.boards[boardID]
+	if b == nil {
+		s.store.mu.Unlock()
+		writeJSON(w, 404, map[string]string{"error": "board not found"})
+		return
+	}
+	if b.Closed {
+		s.store.mu.Unlock()
+		writeJSON(w, 409, map[string]string{"error": "board is closed"})
+		return
+	}
+	deleted := []ID{}
+	drop := func(cards []Card) []Card {
+		kept := cards[:0]
+		for _, c := range cards {
+			if want[c.ID] {
+				deleted = append(deleted, c.ID)
+				delete(want, c.ID)
+				continue
+			}
+			kept = append(kept, c)
+		}
+		return kept
+	}
+	for i := range b.Lists {
+		l := &b.Lists[i]
+		l.Cards = drop(l.Cards)
+		reindex(l)
+	}
+	b.Archive = drop(b.Archive)
+	for _, id := range deleted {
+		unlinkCard(b, id)
+	}
+	missing := []ID{}
+	for _, id := range req.CardIDs {
+		if want[id] {
+			missing = append(missing, id)
+			delete(want, id) // report duplicates once
+		}
+	}
+	if len(deleted) > 0 {
+		b.Events++
+	}
+	s.store.mu.Unlock()
+	out := map[string]any{"deleted": len(deleted), "cardIds": deleted, "missing": missing}
+	if len(deleted) == 0 {
+		writeJSON(w, 200, out)
+		return
+	}
+	saveErr := s.store.save(r.Context())
+
+	s.store.broadcast(r.Context(), boardID, Change{Entity: "cards", Op: "deleted", ID: boardID, Fields: map[string]any{"cardIds": deleted}})
+	if saveFailed(w, saveErr) {
+		return
+	}
+	writeJSON(w, 200, out)
+}
+
+// Apply one label to many cards: {"cardIds": [...], "label": {"id": ...}},
+// or {"name", "color"} to use the board label of that name (created if
+// missing). Cards that already have it are skipped.
+func (s *Server) labelCards(w http.ResponseWriter, r *http.Request) {
+	boardID := s.store.boardRef(chi.URLParam(r, "boardID"))
+	var req struct {
+		CardIDs []ID
+		Label   *Label
+	}
+	var err error
+	if req.CardIDs, err = decodeBatch(r.Body, "cardIds", s.store.maxBatch, map[string]any{"label": &req.Label}); err != nil || len(req.CardIDs) == 0 {
+		msg := "cardIds required"
+		if errors.Is(err, errBatchTooLarge) {
+			msg = err.Error()
+		}
+		writeJSON(w, 400, map[string]string{"error": msg})
+		return
+	}
+	if req.Label == nil || (req.Label.ID == "" && strings.TrimSpace(req.Label.Name) == "") {
+		writeJSON(w, 400, map[string]string{"error": "label id or name required"})
+		return
+	}
+	if msg := validateLabel(*req.Label); req.Label.ID == "" && msg != "" {
+		writeJSON(w, 400, map[string]string{"error": msg})
+		return
+	}
+
+	s.store.mu.Lock()
+	b := s.store.boards[boardID]
+	if b == nil {
+		s.store.mu.Unlock()
+		writeJSON(w, 404, map[string]string{"error": "board not found"})
+		return
+	}
+	if b.Closed {
+		s.store.mu.Unlock()
+		writeJSON(w, 409, map[string]string{"error": "board is closed"})
+		return
+	}
+	var lbl *Label
+	created := false
+	if req.Label.ID != "" {
+		lbl = findLabel(b, req.Label.ID)
+	} else {
+		name := strings.TrimSpace(req.Label.Name)
+		for i := range b.Labels {
+			if strings.EqualFold(b.Labels[i].Name, name) {
+				lbl = &b.Labels[i]
+				break
+			}
+		}
+		if lbl == nil {
+			b.Labels = append(b.Labels, Label{ID: newID(), Name: name, Color: req.Label.Color})
+			lbl, created = &b.Labels[len(b.Labels)-1], true
+		}
+	}
+	if lbl == nil {
+		s.store.mu.Unlock()
+		writeJSON(w, 404, map[string]string{"error": "label not found"})
+		return
+	}
+	label := *lbl
+	want := map[ID]bool{}
+	for _, id := range req.CardIDs {
+		want[id] = true
+	}
+	updated := []ID{}
+	now := time.Now().UTC()
+	for i := range b.Lists {
+		for j := range b.Lists[i].Cards {
+			c := &b.Lists[i].Cards[j]
+			if !want[c.ID] {
+				continue
+			}
+			delete(want, c.ID)
+			if slices.Contains(c.Labels, label.ID) {
+				continue
+			}
+			c.Labels = append(c.Labels, label.ID)
+			autoColor(b, c)
+			c.UpdatedAt = now
+			updated = append(updated, c.ID)
+		}
+	}
+	missing := []ID{}
+	for _, id := range req.CardIDs {
+		if want[id] {
+			missing = append(missing, id)
+			delete(want, id) // report duplicates once
+		}
+	}
+	if created || len(updated) > 0 {
+		b.Events++
+	}
+	s.store.mu.Unlock()
+	out := map[string]any{"updated": len(updated), "cardIds": updated, "missing": missing, "label": label}
+	if !created && len(updated) == 0 {
+		writeJSON(w, 200, out)
+		return
+	}
+	saveErr := s.store.save(r.Context())
+
+	if created {
+		s.store.broadcast(r.Context(), boardID, Change{Entity: "label", Op: "created", ID: label.ID, Fields: label, Object: label})
+		if len(updated) == 0 {
+			if saveFailed(w, saveErr) {
+				return
+			}
+			writeJSON(w, 200, out)
+			return
+		}
+		s.store.mu.Lock()
+		if b := s.store.boards[boardID]; b != nil {
+			b.Events++
+		}
+		s.store.mu.Unlock()
+	}
+	s.store.broadcast(r.Context(), boardID, Change{Entity: "cards", Op: "updated", ID: boardID, Fields: map[string]any{"cardIds": updated, "labelId": label.ID}})
+	if saveFailed(w, saveErr) {
+		return
+	}
+	writeJSON(w, 200, out)
+}
+
+// Link or unlink a dependency: the URL card blocks the card in the body
+// (POST {"cardId": ...}) or named in the path (DELETE .../blocks/{otherID}).
+func (s *Server) linkCards(link bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		boardID := s.store.boardRef(chi.URLParam(r, "boardID"))
+		blockerID := parseID(chi.URLParam(r, "cardID"))
+		blockedID := parseID(chi.URLParam(r, "otherID"))
+		if link {
+			var req struct {
+				CardID ID `json:"cardId"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.CardID == "" {
+				writeJSON(w, 400, map[string]string{"error": "cardId required"})
+				return
+			}
+			blockedID = req.CardID
+		}
+		if blockerID == blockedID {
+			writeJSON(w, 400, map[string]string{"error": "a card cannot block itself"})
+			return
+		}
+
+		s.store.mu.Lock()
+		b := s.store.boards[boardID]
+		if b == nil {
+			s.store.mu.Unlock()
+			writeJSON(w, 404, map[string]string{"error": "board not found"})
+			return
+		}
+		if b.Closed {
+			s.store.mu.Unlock()
+			writeJSON(w, 409, map[string]string{"error": "board is closed"})
+			return
+		}
+		bl, bi := findCard(b, blockerID)
+		if bl == nil {
+			s.store.mu.Unlock()
+			writeJSON(w, 404, map[string]string{"error": "card not found"})
+			return
+		}
+		dl, di := findCard(b, blockedID)
+		if dl == nil {
+			s.store.mu.Unlock()
+			writeJSON(w, 400, map[string]string{"error": "linked card must be on the same board"})
+			return
+		}
+		blocker, blocked := &bl.Cards[bi], &dl.Cards[di]
+		if link {
+			blocker.Blocks = addID(blocker.Blocks, blockedID)
+			blocked.BlockedBy = addID(blocked.BlockedBy, blockerID)
+		} else {
+			blocker.Blocks = removeID(blocker.Blocks, blockedID)
+			blocked.BlockedBy = removeID(blocked.BlockedBy, blockerID)
+		}
+		b.Events++
+		s.store.mu.Unlock()
+		saveErr := s.store.save(r.Context())
+
+		op := "unlinked"
+		if link {
+			op = "linked"
+		}
+		ev := map[string]any{"blockerId": blockerID, "blockedId": blockedID}
+		s.store.broadcast(r.Context(), boardID, Change{Entity: "card", Op: op, ID: blockerID, Fields: ev})
+		if saveFailed(w, saveErr) {
+			return
+		}
+		writeJSON(w, 200, ev)
+	}
+}
+
+// Cards currently waiting on at least one unfinished blocker
+func (s *Server) blockedCards(w http.ResponseWriter, r *http.Request) {
+	boardID := s.store.boardRef(chi.URLParam(r, "boardID"))
+	s.store.touch(boardID)
+	type entry struct {
+		ListID    ID   `json:"listId"`
+		Card      Card `json:"card"`
+		WaitingOn []ID `json:"waitingOn"`
+	}
+	out := []entry{}
+	s.store.mu.RLock()
+	defer s.store.mu.RUnlock()
+	b := s.store.boards[boardID]
+	if b == nil {
+		writeJSON(w, 404, map[string]string{"error": "board not found"})
+		return
+	}
+	for _, l := range b.Lists {
+		for _, c := range l.Cards {
+			var waiting []ID
+			for _, id := range c.BlockedBy {
+				if bl, bi := findCard(b, id); bl != nil && !bl.Cards[bi].Done {
+					waiting = append(waiting, id)
+				}
+			}
+			if len(waiting) > 0 {
+				out = append(out, entry{ListID: l.ID, Card: c, WaitingOn: waiting})
+			}
+		}
+	}
+	writeJSON(w, 200, out)
+}
+
+// Cards not updated or moved for longer than ?olderThan (default 7d), most
+// idle first
+func (s *Server) staleCards(w http.ResponseWriter, r *http.Request) {
+	boardID := s.store.boardRef(chi.URLParam(r, "boardID"))
+	olderThan := 7 * 24 * time.Hour
+	if v := r.URL.Query().Get("olderThan"); v != "" {
+		d, err := parseAge(v)
+		if err != nil || d < 0 {
+			writeJSON(w, 400, map[string]string{"error": "olderThan must be a duration such as 36h or 7d"})
+			return
+		}
+		olderThan = d
+	}
+	s.store.touch(boardID)
+	type entry struct {
+		ListID ID   `json:"listId"`
+		Card   Card `json:"card"`
+	}
+	out := []entry{}
+	s.store.mu.RLock()
+	b := s.store.boards[boardID]
+	if b == nil {
+		s.store.mu.RUnlock()
+		writeJSON(w, 404, map[string]string{"error": "board not found"})
+		return
+	}
+	now := time.Now()
+	for _, l := range b.Lists {
+		for _, c := range withAges(l.Cards, now) {
+			if now.Sub(c.UpdatedAt) > olderThan {
+				out = append(out, entry{ListID: l.ID, Card: c})
+			}
+		}
+	}
+	s.store.mu.RUnlock()
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Card.UpdatedAt.Before(out[j].Card.UpdatedAt) })
+	writeJSON(w, 200, out)
+}
+
+// cardMissing tells, per ?missing= value, whether a card lacks that field.
+var cardMissing = map[string]func(c Card) bool{
+	"due":         func(c Card) bool { return c.Due == nil },
+	"assignee":    func(c Card) bool { return len(c.Assignees) == 0 },
+	"description": func(c Card) bool { return strings.TrimSpace(c.Description) == "" },
+}
+
+// Open cards on the board in list order; ?missing=due (or assignee,
+// description) keeps the cards lacking that field, repeat it to require all
+func (s *Server) listCards(w http.ResponseWriter, r *http.Request) {
+	boardID := s.store.boardRef(chi.URLParam(r, "boardID"))
+	var checks []func(Card) bool
+	for _, m := range r.URL.Query()["missing"] {
+		f := cardMissing[m]
+		if f == nil {
+			writeJSON(w, 400, map[string]string{"error": "missing must be due, assignee or description"})
+			return
+		}
+		checks = append(checks, f)
+	}
+	s.store.touch(boardID)
+	type entry struct {
+		ListID ID   `json:"listId"`
+		Card   Card `json:"card"`
+	}
+	out := []entry{}
+	s.store.mu.RLock()
+	b := s.store.boards[boardID]
+	if b == nil {
+		s.store.mu.RUnlock()
+		writeJSON(w, 404, map[string]string{"error": "board not found"})
+		return
+	}
+	for _, l := range b.Lists {
+		for _, c := range l.Cards {
+			if !slices.ContainsFunc(checks, func(missing func(Card) bool) bool { return !missing(c) }) {
+				out = append(out, entry{ListID: l.ID, Card: c})
+			}
+		}
+	}
+	s.store.mu.RUnlock()
+	writeJSON(w, 200, out)
+}
+
+// Delta since an Events id, from the event log: which cards and lists were
+// added, moved, updated or removed, with their current state
+func (s *Server) boardDiff(w http.ResponseWriter, r *http.Request) {
+	boardID := s.store.boardRef(chi.URLParam(r, "boardID"))
+	since, err := strconv.ParseInt(r.URL.Query().Get("since"), 10, 64)
+	if err != nil || since < 0 {
+		writeJSON(w, 400, map[string]string{"error": "since must be an events id"})
+		return
+	}
+	s.store.touch(boardID)
+	type placed struct {
+		ListID ID   `json:"listId"`
+		Card   Card `json:"card"`
+	}
+	type cardDiff struct {
+		Added   []placed `json:"added"`
+		Moved   []placed `json:"moved"`
+		Updated []placed `json:"updated"`
+		Removed []ID     `json:"removed"`
+	}
+	type listDiff struct {
+		Added   []List `json:"added"`   // with their cards
+		Updated []List `json:"updated"` // without cards
+		Removed []ID   `json:"removed"`
+		Order   []ID   `json:"order,omitempty"` // set when lists were reordered
+	}
+
+	// Gets the write lock: eventsSince may read the log from disk.
+	s.store.mu.Lock()
+	defer s.store.mu.Unlock()
+	b := s.store.boards[boardID]
+	if b == nil {
+		writeJSON(w, 404, map[string]string{"error": "board not found"})
+		return
+	}
+	if since > b.Events {
+		writeJSON(w, 400, map[string]string{"error": "since is ahead of the board"})
+		return
+	}
+	evs, oldest, _ := s.store.eventsSince(boardID, since)
+	if (oldest == 0 && since < b.Events) || (oldest > 0 && since < oldest-1) {
+		writeJSON(w, 410, map[string]string{"error": "since is older than the event log; re-fetch the board"})
+		return
+	}
+
+	// what happened to each entity, in order of first mention
+	var cardIDs, listIDs []ID
+	cardKind, listKind := map[ID]string{}, map[ID]string{}
+	noteCard := func(id ID, kind string) {
+		prev, seen := cardKind[id]
+		if !seen {
+			cardIDs = append(cardIDs, id)
+		}
+		if prev != "added" && (prev != "moved" || kind == "added") {
+			cardKind[id] = kind
+		}
+	}
+	noteList := func(id ID, kind string) {
+		prev, seen := listKind[id]
+		if !seen {
+			listIDs = append(listIDs, id)
+		}
+		if prev != "added" {
+			listKind[id] = kind
+		}
+	}
+	reordered, boardUpdated := false, false
+	for _, e := range evs {
+		var f struct {
+			CardIDs []ID `json:"cardIds"`
+		}
+		switch e.Entity {
+		case "card":
+			switch e.Op {
+			case "created":
+				noteCard(e.EntityID, "added")
+			case "moved":
+				noteCard(e.EntityID, "moved")
+			case "linked", "unlinked":
+				// both ends of the dependency changed
+				var ends struct {
+					BlockerID ID `json:"blockerId"`
+					BlockedID ID `json:"blockedId"`
+				}
+				_ = json.Unmarshal(e.Fields, &ends)
+				noteCard(ends.BlockerID, "updated")
+				noteCard(ends.BlockedID, "updated")
+			default:
+				noteCard(e.EntityID, "updated")
+			}
+		case "cards":
+			_ = json.Unmarshal(e.Fields, &f)
+			// updated, renumbered; cleared, archived and deleted cards
+			// resolve to removed below
+			kind := "updated"
+			if e.Op == "moved" {
+				kind = "moved"
+			}
+			for _, id := range f.CardIDs {
+				noteCard(id, kind)
+			}
+		case "list":
+			switch e.Op {
+			case "created":
+				noteList(e.EntityID, "added")
+			default:
+				noteList(e.EntityID, "updated")
+			}
+		case "lists":
+			reordered = true
+		default:
+			boardUpdated = true // board settings, labels, fields, rules
+		}
+	}
+
+	cards := cardDiff{Added: []placed{}, Moved: []placed{}, Updated: []placed{}, Removed: []ID{}}
+	for _, id := range cardIDs {
+		l, idx := findCard(b, id)
+		if l == nil {
+			cards.Removed = append(cards.Removed, id)
+			continue
+		}
+		p := placed{ListID: l.ID, Card: l.Cards[idx]}
+		switch cardKind[id] {
+		case "added":
+			cards.Added = append(cards.Added, p)
+		case "moved":
+			cards.Moved = append(cards.Moved, p)
+		default:
+			cards.Updated = append(cards.Updated, p)
+		}
+	}
+	lists := listDiff{Added: []List{}, Updated: []List{}, Removed: []ID{}}
+	for _, id := range listIDs {
+		l := findList(b, id)
+		switch {
+		case l == nil:
+			lists.Removed = append(lists.Removed, id)
+		case listKind[id] == "added":
+			lists.Added = append(lists.Added, *l)
+		default:
+			lc := *l
+			lc.Cards = nil
+			lists.Updated = append(lists.Updated, lc)
+		}
+	}
+	if reordered {
+		for _, l := range b.Lists {
+			lists.Order = append(lists.Order, l.ID)
+		}
+	}
+	writeJSON(w, 200, map[string]any{"since": since, "events": b.Events, "boardUpdated": boardUpdated, "cards": cards, "lists": lists})
+}
+
+// Export every board: one JSON array, or with ?format=ndjson one board per
+// line, streamed. Password-protected boards are left out.
+func (s *Server) export(w http.ResponseWriter, r *http.Request) {
+	format := r.URL.Query().Get("format")
+	if format != "" && format != "json" && format != "ndjson" {
+		writeJSON(w, 400, map[string]string{"error": "format must be json or ndjson"})
+		return
+	}
+	s.store.mu.RLock()
+	ids := make([]ID, 0, len(s.store.boards))
+	for id, b := range s.store.boards {
+		if !b.Protected {
+			ids = append(ids, id)
+		}
+	}
+	s.store.mu.RUnlock()
+	slices.SortFunc(ids, compareIDs)
+
+	// encode one board at a time so the lock is never held for the whole
+	// store; boards deleted meanwhile are skipped
+	next := func(id ID) ([]byte, bool) {
+		s.store.mu.RLock()
+		defer s.store.mu.RUnlock()
+		b := s.store.boards[id]
+		if b == nil {
+			return nil, false
+		}
+		data, err := json.Marshal(b)
+		return data, err == nil
+	}
+	if format != "ndjson" {
+		out := make([]json.RawMessage, 0, len(ids))
+		for _, id := range ids {
+			if data, ok := next(id); ok {
+				out = append(out, data)
+			}
+		}
+		writeJSON(w, 200, out)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(200)
+	flusher, _ := w.(http.Flusher)
+	for _, id := range ids {
+		data, ok := next(id)
+		if !ok {
+			continue
+		}
+		if _, err := w.Write(append(data, '\n')); err != nil {
+			return // client went away
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+}
+
+// Export one board: JSON (default), or ?format=ics for an iCalendar feed of
+// card due dates that calendar apps can subscribe to
+func (s *Server) exportBoard(w http.ResponseWriter, r *http.Request) {
+	boardID := s.store.boardRef(chi.URLParam(r, "boardID"))
+	format := r.URL.Query().Get("format")
+	if format != "" && format != "json" && format != "ics" {
+		writeJSON(w, 400, map[string]string{"error": "format must be json or ics"})
+		return
+	}
+	s.store.touch(boardID)
+	s.store.mu.RLock()
+	b := s.store.boards[boardID]
+	if b == nil {
+		s.store.mu.RUnlock()
+		writeJSON(w, 404, map[string]string{"error": "board not found"})
+		return
 	}
-}
-
-// ==== Helpers ====
+	if format != "ics" {
+		data, err := json.Marshal(b)
+		s.store.mu.RUnlock()
+		if err != nil {
+			writeJSON(w, 500, map[string]string{"error": err.Error()})
+			return
+		}
+		writeJSON(w, 200, json.RawMessage(data))
+		return
+	}
+	cal := boardCalendar(b)
+	slug := b.Slug
+	s.store.mu.RUnlock()
 
-func writeJSON(w http.ResponseWriter, code int, v any) {
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(code)
-	_ = json.NewEncoder(w).Encode(v)
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	if slug != "" {
+		w.Header().Set("Content-Disposition", `inline; filename="`+slug+`.ics"`)
+	}
+	w.WriteHeader(200)
+	w.Write([]byte(cal))
 }
 
-func parseID(s string) int64 {
-	id, _ := strconv.ParseInt(s, 10, 64)
-	return id
+// boardCalendar renders b's dated cards as an iCalendar (RFC 5545) feed, one
+// VEVENT per card at its due time. UIDs derive from card ids so calendar
+// apps update events in place when the feed is re-fetched.
+func boardCalendar(b *Board) string {
+	const stamp = "20060102T150405Z"
+	var sb strings.Builder
+	line := func(name, value string) {
+		// fold at 75 octets without splitting a UTF-8 sequence
+		l := name + ":" + value
+		for len(l) > 75 {
+			cut := 75
+			for !utf8.RuneStart(l[cut]) {
+				cut--
+			}
+			sb.WriteString(l[:cut] + "\r\n")
+			l = " " + l[cut:]
+		}
+		sb.WriteString(l + "\r\n")
+	}
+	line("BEGIN", "VCALENDAR")
+	line("VERSION", "2.0")
+	line("PRODID", "-//kanban-lite//board export//EN")
+	line("CALSCALE", "GREGORIAN")
+	line("X-WR-CALNAME", icsText(b.Title))
+	for _, l := range b.Lists {
+		for _, c := range l.Cards {
+			if c.Due == nil {
+				continue
+			}
+			line("BEGIN", "VEVENT")
+			line("UID", fmt.Sprintf("card-%s@kanban-lite", c.ID))
+			line("DTSTAMP", c.UpdatedAt.UTC().Format(stamp))
+			line("DTSTART", c.Due.UTC().Format(stamp))
+			line("SUMMARY", icsText(c.Title))
+			if c.Description != "" {
+				line("DESCRIPTION", icsText(c.Description))
+			}
+			line("CATEGORIES", icsText(l.Title))
+			line("END", "VEVENT")
+		}
+	}
+	line("END", "VCALENDAR")
+	return sb.String()
 }
 
-// ==== HTTP Handlers ====
-
-type Server struct{ store *Store }
-
-func NewServer(store *Store) *Server { return &Server{store: store} }
-
-// Health
-func (s *Server) health(w http.ResponseWriter, r *http.Request) { w.Write([]byte("ok")) }
+// icsText escapes an iCalendar TEXT value.
+var icsText = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`).Replace
 
-// Create board
-func (s *Server) createBoard(w http.ResponseWriter, r *http.Request) {
-	var req struct {
-		Title string `json:"title"`
-	}
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Title == "" {
-		writeJSON(w, 400, map[string]string{"error": "title required"})
+// Search card titles/descriptions across all boards: /search?q=term&limit=20
+func (s *Server) search(w http.ResponseWriter, r *http.Request) {
+	q := strings.ToLower(strings.TrimSpace(r.URL.Query().Get("q")))
+	if q == "" {
+		writeJSON(w, 400, map[string]string{"error": "q required"})
 		return
 	}
-	b := &Board{ID: time.Now().UnixNano(), Title: req.Title, Lists: []List{}}
-
-	s.store.mu.Lock()
-	s.store.boards[b.ID] = b
-	s.store.mu.Unlock()
-	_ = s.store.save()
-	writeJSON(w, 201, b)
-}
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	if limit <= 0 {
+		limit = 50
+	}
 
-// List boards
-func (s *Server) listBoards(w http.ResponseWriter, r *http.Request) {
+	type hit struct {
+		BoardID    ID     `json:"boardId"`
+		BoardTitle string `json:"boardTitle"`
+		ListID     ID     `json:"listId"`
+		Card       Card   `json:"card"`
+	}
+	out := []hit{}
 	s.store.mu.RLock()
-	out := make([]*Board, 0, len(s.store.boards))
+scan:
 	for _, b := range s.store.boards {
-		out = append(out, b)
+		if b.Closed || b.Protected {
+			continue
+		}
+		for _, l := range b.Lists {
+			for _, c := range l.Cards {
+				if !strings.Contains(strings.ToLower(c.Title), q) && !strings.Contains(strings.ToLower(c.Description), q) {
+					continue
+				}
+				out = append(out, hit{BoardID: b.ID, BoardTitle: b.Title, ListID: l.ID, Card: c})
+				if len(out) >= limit {
+					break scan
+				}
+			}
+		}
 	}
 	s.store.mu.RUnlock()
 	writeJSON(w, 200, out)
 }
 
-// Create list in a board
-func (s *Server) createList(w http.ResponseWriter, r *http.Request) {
-	boardID := parseID(chi.URLParam(r, "boardID"))
-	var req struct {
-		Title string `json:"title"`
-	}
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Title == "" {
-		writeJSON(w, 400, map[string]string{"error": "title required"})
-		return
+// Cards assigned to a user across all boards, soonest due first (cards
+// without a due date last). ?includeArchived=true adds archived cards and
+// ?dueBefore=RFC3339 keeps only cards due before then.
+func (s *Server) userCards(w http.ResponseWriter, r *http.Request) {
+	user := strings.TrimSpace(chi.URLParam(r, "user"))
+	includeArchived := r.URL.Query().Get("includeArchived") == "true"
+	var dueBefore *time.Time
+	if v := r.URL.Query().Get("dueBefore"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			writeJSON(w, 400, map[string]string{"error": "dueBefore must be an RFC3339 time"})
+			return
+		}
+		dueBefore = &t
 	}
 
-	s.store.mu.Lock()
-	b := s.store.boards[boardID]
-	if b == nil {
-		s.store.mu.Unlock()
-		writeJSON(w, 404, map[string]string{"error": "board not found"})
-		return
+	type hit struct {
+		BoardID    ID     `json:"boardId"`
+		BoardTitle string `json:"boardTitle"`
+		ListID     ID     `json:"listId"`
+		ListTitle  string `json:"listTitle"`
+		Archived   bool   `json:"archived,omitempty"`
+		Card       Card   `json:"card"`
+	}
+	out := []hit{}
+	match := func(c *Card) bool {
+		if dueBefore != nil && (c.Due == nil || !c.Due.Before(*dueBefore)) {
+			return false
+		}
+		for _, a := range c.Assignees {
+			if strings.EqualFold(a, user) {
+				return true
+			}
+		}
+		return false
 	}
-	pos := len(b.Lists)
-	lst := List{ID: time.Now().UnixNano(), Title: req.Title, Position: pos, Cards: []Card{}}
-	b.Lists = append(b.Lists, lst)
-	b.Events++
-	s.store.mu.Unlock()
-	_ = s.store.save()
-
-	s.store.broadcast(boardID, "list.created", lst)
-	writeJSON(w, 201, lst)
-}
-
-// Get board with lists/cards
-func (s *Server) getBoard(w http.ResponseWriter, r *http.Request) {
-	boardID := parseID(chi.URLParam(r, "boardID"))
 	s.store.mu.RLock()
-	b := s.store.boards[boardID]
-	s.store.mu.RUnlock()
-	if b == nil {
-		writeJSON(w, 404, map[string]string{"error": "not found"})
-		return
+	for _, b := range s.store.boards {
+		if b.Closed || b.Protected {
+			continue
+		}
+		for _, l := range b.Lists {
+			for _, c := range l.Cards {
+				if match(&c) {
+					out = append(out, hit{BoardID: b.ID, BoardTitle: b.Title, ListID: l.ID, ListTitle: l.Title, Card: c})
+				}
+			}
+		}
+		if !includeArchived {
+			continue
+		}
+		for _, c := range b.Archive {
+			if match(&c) {
+				h := hit{BoardID: b.ID, BoardTitle: b.Title, ListID: c.ArchivedFrom, Archived: true, Card: c}
+				if l := findList(b, c.ArchivedFrom); l != nil {
+					h.ListTitle = l.Title
+				}
+				out = append(out, h)
+			}
+		}
 	}
-	writeJSON(w, 200, b)
+	s.store.mu.RUnlock()
+	sort.SliceStable(out, func(i, j int) bool {
+		a, b := out[i].Card, out[j].Card
+		if (a.Due == nil) != (b.Due == nil) {
+			return a.Due != nil
+		}
+		if a.Due != nil && !a.Due.Equal(*b.Due) {
+			return a.Due.Before(*b.Due)
+		}
+		return compareIDs(a.ID, b.ID) < 0
+	})
+	writeJSON(w, 200, out)
 }
 
-// Create card in a list
-func (s *Server) createCard(w http.ResponseWriter, r *http.Request) {
-	boardID := parseID(chi.URLParam(r, "boardID"))
-	listID := parseID(chi.URLParam(r, "listID"))
-	var req struct {
-		Title, Description string `json:"title"`
-		Due                *time.Time
+// Page size caps for the activity feed and event history.
+const (
+	maxActivityPage = 500
+	maxHistoryPage  = 1000
+)
+
+// Activity feed from the event log, newest first:
+// ?since=RFC3339 (exclusive), ?type=card.moved (repeatable), ?limit=50 and
+// ?before=<event id> to page back; hasMore says whether older entries match.
+func (s *Server) activity(w http.ResponseWriter, r *http.Request) {
+	boardID := s.store.boardRef(chi.URLParam(r, "boardID"))
+	q := r.URL.Query()
+	var since time.Time
+	if v := q.Get("since"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			writeJSON(w, 400, map[string]string{"error": "since must be an RFC3339 time"})
+			return
+		}
+		since = t
 	}
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Title == "" {
-		writeJSON(w, 400, map[string]string{"error": "title required"})
-		return
+	limit := 50
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxActivityPage {
+			writeJSON(w, 400, map[string]string{"error": fmt.Sprintf("limit must be 1-%d", maxActivityPage)})
+			return
+		}
+		limit = n
 	}
+	before := int64(math.MaxInt64)
+	if v := q.Get("cursor"); v != "" {
+		id, err := decodeCursor("a", v)
+		if err != nil {
+			writeJSON(w, 400, map[string]string{"error": err.Error()})
+			return
+		}
+		before = id
+	} else if v := q.Get("before"); v != "" {
+		w.Header().Set("Deprecation", "true") // use cursor
+		before, _ = strconv.ParseInt(v, 10, 64)
+	}
+	types := map[string]bool{}
+	for _, t := range q["type"] {
+		types[t] = true
+	}
+	verbose := q.Get("verbose") == "true"
 
+	s.store.touch(boardID)
 	s.store.mu.Lock()
-	b := s.store.boards[boardID]
-	if b == nil {
+	if s.store.boards[boardID] == nil {
 		s.store.mu.Unlock()
 		writeJSON(w, 404, map[string]string{"error": "board not found"})
 		return
 	}
-	var target *List
-	for i := range b.Lists {
-		if b.Lists[i].ID == listID {
-			target = &b.Lists[i]
+	hist, _, _ := s.store.eventsSince(boardID, -1)
+	s.store.mu.Unlock()
+
+	out := []Event{}
+	hasMore := false
+	for i := len(hist) - 1; i >= 0; i-- {
+		e := hist[i]
+		if e.ID >= before || (len(types) > 0 && !types[e.Type]) {
+			continue
+		}
+		if !since.IsZero() && (e.At == nil || !e.At.After(since)) {
+			break // the log is in time order; older entries can't match either
+		}
+		if len(out) == limit {
+			hasMore = true
 			break
 		}
+		if !verbose {
+			e.Object = nil
+		}
+		out = append(out, e)
 	}
-	if target == nil {
-		s.store.mu.Unlock()
-		writeJSON(w, 404, map[string]string{"error": "list not found"})
-		return
+	resp := map[string]any{"entries": out, "hasMore": hasMore}
+	if hasMore {
+		resp["nextCursor"] = encodeCursor("a", out[len(out)-1].ID)
 	}
-	card := Card{ID: time.Now().UnixNano() + int64(rand.Intn(1000)), Title: req.Title, Description: req.Description, Position: len(target.Cards), Due: req.Due}
-	target.Cards = append(target.Cards, card)
-	b.Events++
-	s.store.mu.Unlock()
-	_ = s.store.save()
-
-	s.store.broadcast(boardID, "card.created", card)
-	writeJSON(w, 201, card)
+	writeJSON(w, 200, resp)
 }
 
-// Move card between lists or reorder
-func (s *Server) moveCard(w http.ResponseWriter, r *http.Request) {
-	boardID := parseID(chi.URLParam(r, "boardID"))
-	var req struct {
-		CardID, FromListID, ToListID int64
-		ToPos                        int
+// Polling fallback for the SSE stream: logged events with an id greater than
+// ?cursor (or the older raw ?since id; default: from the start), oldest
+// first, at most ?limit (default 100, max 1000). nextCursor continues after
+// the last event returned. 410 when the events wanted have left the log.
+func (s *Server) eventHistory(w http.ResponseWriter, r *http.Request) {
+	boardID := s.store.boardRef(chi.URLParam(r, "boardID"))
+	var since int64
+	if v := r.URL.Query().Get("cursor"); v != "" {
+		id, err := decodeCursor("h", v)
+		if err != nil {
+			writeJSON(w, 400, map[string]string{"error": err.Error()})
+			return
+		}
+		since = id
+	} else if v := r.URL.Query().Get("since"); v != "" {
+		w.Header().Set("Deprecation", "true") // use cursor
+		since, _ = strconv.ParseInt(v, 10, 64)
 	}
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		writeJSON(w, 400, map[string]string{"error": "bad request"})
-		return
+	limit := 100
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxHistoryPage {
+			writeJSON(w, 400, map[string]string{"error": fmt.Sprintf("limit must be 1-%d", maxHistoryPage)})
+			return
+		}
+		limit = n
 	}
+	verbose := r.URL.Query().Get("verbose") == "true"
 
+	s.store.touch(boardID)
 	s.store.mu.Lock()
-	defer s.store.mu.Unlock()
-	b := s.store.boards[boardID]
-	if b == nil {
+	if s.store.boards[boardID] == nil {
+		s.store.mu.Unlock()
 		writeJSON(w, 404, map[string]string{"error": "board not found"})
 		return
 	}
-	// find from list
-	var from *List
-	for i := range b.Lists {
-		if b.Lists[i].ID == req.FromListID {
-			from = &b.Lists[i]
-			break
-		}
-	}
-	if from == nil {
-		writeJSON(w, 404, map[string]string{"error": "from list not found"})
+	missed, oldest, _ := s.store.eventsSince(boardID, since)
+	s.store.mu.Unlock()
+	if oldest > 0 && since < oldest-1 {
+		writeJSON(w, 410, map[string]any{"error": "events since that id are no longer retained; re-fetch the board", "oldestEventId": oldest})
 		return
 	}
-	// extract card
-	var c Card
-	idx := -1
-	for i := range from.Cards {
-		if from.Cards[i].ID == req.CardID {
-			c = from.Cards[i]
-			idx = i
-			break
-		}
+	if len(missed) > limit {
+		missed = missed[:limit]
 	}
-	if idx == -1 {
-		writeJSON(w, 404, map[string]string{"error": "card not found"})
-		return
+	if !verbose {
+		for i := range missed {
+			missed[i].Object = nil
+		}
 	}
-	from.Cards = append(from.Cards[:idx], from.Cards[idx+1:]...)
-	for i := range from.Cards {
-		from.Cards[i].Position = i
+	if len(missed) > 0 {
+		since = missed[len(missed)-1].ID
 	}
-	// target list
-	var to *List
-	for i := range b.Lists {
-		if b.Lists[i].ID == req.ToListID {
-			to = &b.Lists[i]
-			break
+	writeJSON(w, 200, map[string]any{"events": missed, "nextCursor": encodeCursor("h", since)})
+}
+
+// Pagination cursors are opaque to clients: base64 of "<kind>:<event id>".
+// kind ties a cursor to the endpoint that issued it ("h" history, "a"
+// activity), leaving room to change the format later.
+
+func encodeCursor(kind string, id int64) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(kind + ":" + strconv.FormatInt(id, 10)))
+}
+
+func decodeCursor(kind, cursor string) (int64, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err == nil {
+		if v, ok := strings.CutPrefix(string(raw), kind+":"); ok {
+			if id, perr := strconv.ParseInt(v, 10, 64); perr == nil && id >= 0 {
+				return id, nil
+			}
 		}
 	}
-	if to == nil {
-		writeJSON(w, 404, map[string]string{"error": "to list not found"})
-		return
+	return 0, errors.New("malformed cursor")
+}
+
+// SSE stream: /boards/{boardID}/events?lastEvent=123&verbose=true
+// The Last-Event-ID header takes precedence over the lastEvent query param.
+func (s *Server) events(w http.ResponseWriter, r *http.Request) {
+	boardID := s.store.boardRef(chi.URLParam(r, "boardID"))
+	s.store.touch(boardID)
+	lastRaw := r.Header.Get("Last-Event-ID")
+	if lastRaw == "" {
+		lastRaw = r.URL.Query().Get("lastEvent")
 	}
-	if req.ToPos < 0 || req.ToPos > len(to.Cards) {
-		req.ToPos = len(to.Cards)
+	// Subscribe before reading the log so nothing falls between the two;
+	// duplicates are filtered by id below.
+	sub, cancel, err := s.store.subscribe(boardID)
+	if err != nil {
+		w.Header().Set("Retry-After", "10")
+		writeJSON(w, 503, map[string]string{"error": err.Error()})
+		return
 	}
-	to.Cards = append(to.Cards, Card{})
-	copy(to.Cards[req.ToPos+1:], to.Cards[req.ToPos:])
-	to.Cards[req.ToPos] = c
-	for i := range to.Cards {
-		to.Cards[i].Position = i
+	defer cancel()
+	last := int64(-1)
+	if lastRaw != "" {
+		last, _ = strconv.ParseInt(lastRaw, 10, 64)
 	}
-	b.Events++
-	_ = s.store.save()
-
-	s.store.broadcast(boardID, "card.moved", map[string]any{"cardId": c.ID, "toListId": to.ID, "toPos": req.ToPos})
-	writeJSON(w, 200, map[string]string{"status": "ok"})
-}
+	s.store.mu.Lock()
+	missed, oldest, newest := s.store.eventsSince(boardID, last)
+	s.store.mu.Unlock()
 
-// SSE stream: /boards/{boardID}/events?lastEvent=123
-func (s *Server) events(w http.ResponseWriter, r *http.Request) {
-	boardID := parseID(chi.URLParam(r, "boardID"))
 	w.Header().Set("Content-Type", "text/event-stream")
 	w.Header().Set("Cache-Control", "no-cache")
 	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Oldest-Event-ID", strconv.FormatInt(oldest, 10))
 	w.WriteHeader(200)
 	flusher, ok := w.(http.Flusher)
 	if !ok {
@@ -352,22 +7411,70 @@ func (s *Server) events(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	ch, cancel := s.store.subscribe(boardID)
-	defer cancel()
+	// The stream is long-lived: lift the server's WriteTimeout for this
+	// response only (read/idle timeouts still apply).
+	if err := http.NewResponseController(w).SetWriteDeadline(time.Time{}); err != nil {
+		log.Printf("sse: cannot clear write deadline: %v", err)
+	}
+
+	verbose := r.URL.Query().Get("verbose") == "true"
+	writer := bufio.NewWriter(w)
+	writeEvent := func(e Event) {
+		if !verbose {
+			e.Object = nil
+		}
+		msg, _ := json.Marshal(e)
+		fmt.Fprintf(writer, "id: %d\n", e.ID)
+		fmt.Fprintf(writer, "event: message\n")
+		fmt.Fprintf(writer, "data: %s\n\n", msg)
+	}
+
+	// writeHint sends an id-less control message (it must not move the
+	// client's Last-Event-ID).
+	writeHint := func(op string, fields map[string]any) {
+		msg, _ := json.Marshal(map[string]any{"type": "board." + op, "entity": "board", "op": op, "entityId": boardID, "fields": fields})
+		fmt.Fprintf(writer, "event: message\n")
+		fmt.Fprintf(writer, "data: %s\n\n", msg)
+	}
+
+	// Tell the client what can be replayed (EventSource can't read headers).
+	writeHint("sync", map[string]any{"oldestEventId": oldest, "latestEventId": newest})
+
+	// Catch-up phase: replay what the client missed, unless it is so far
+	// behind that the log no longer covers the gap; then it must re-fetch.
+	sent := last
+	switch {
+	case lastRaw == "":
+	case oldest > 0 && last < oldest-1:
+		writeHint("resync", map[string]any{"reason": "expired", "oldestEventId": oldest})
+		sent = newest
+	default:
+		for _, e := range missed {
+			writeEvent(e)
+			sent = e.ID
+		}
+	}
+	writer.Flush()
+	flusher.Flush()
 
 	// Send a ping every 25s to keep connections alive
 	ticker := time.NewTicker(25 * time.Second)
 	defer ticker.Stop()
 
-	writer := bufio.NewWriter(w)
 	for {
 		select {
-		case msg, ok := <-ch:
+		case e, ok := <-sub.ch:
 			if !ok {
 				return
 			}
-			fmt.Fprintf(writer, "event: message\n")
-			fmt.Fprintf(writer, "data: %s\n\n", msg)
+			if e.ID <= sent {
+				continue
+			}
+			writeEvent(e)
+			writer.Flush()
+			flusher.Flush()
+		case <-sub.resync:
+			writeHint("resync", map[string]any{"reason": "dropped", "dropped": sub.dropped.Load()})
 			writer.Flush()
 			flusher.Flush()
 		case <-ticker.C:
@@ -380,49 +7487,242 @@ func (s *Server) events(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func main() {
-	path := os.Getenv("KANBAN_DATA")
-	if path == "" {
-		path = "./data/kanban.json"
+// adminToken gates /admin endpoints (KANBAN_ADMIN_TOKEN); they are disabled
+// when it is empty.
+var adminToken string
+
+// requireAdmin accepts requests carrying "Authorization: Bearer <token>".
+func requireAdmin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if adminToken == "" {
+			writeJSON(w, 403, map[string]string{"error": "admin endpoints are disabled (set KANBAN_ADMIN_TOKEN)"})
+			return
+		}
+		got, _ := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !hmac.Equal([]byte(got), []byte(adminToken)) {
+			writeJSON(w, 401, map[string]string{"error": "admin token required"})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Rewrite the data file from memory, healing positions and dangling
+// references; ?purgeArchived=90d also drops cards archived longer ago
+func (s *Server) compact(w http.ResponseWriter, r *http.Request) {
+	var purgeBefore time.Time
+	if v := r.URL.Query().Get("purgeArchived"); v != "" {
+		d, err := parseAge(v)
+		if err != nil || d < 0 {
+			writeJSON(w, 400, map[string]string{"error": "purgeArchived must be a duration such as 720h or 30d"})
+			return
+		}
+		purgeBefore = time.Now().Add(-d)
 	}
-	store := NewStore(path)
-	if err := store.load(); err != nil {
-		log.Fatal(err)
+	rep, err := s.store.compact(purgeBefore)
+	if err != nil {
+		writeJSON(w, 500, map[string]string{"error": err.Error()})
+		return
 	}
+	writeJSON(w, 200, rep)
+}
+
+// apiRoutes registers the board API for one store. It is used for the default
+// store and again for every workspace.
+func apiRoutes(r chi.Router, store *Store) {
+	r.Get("/capabilities", NewServer(store).capabilities)
+	r.Get("/search", NewServer(store).search)
+	r.Get("/export", NewServer(store).export)
+	r.Get("/users/{user}/cards", NewServer(store).userCards)
+	r.Post("/templates/cards", NewServer(store).createTemplate)
+	r.Get("/templates/cards", NewServer(store).listTemplates)
+	r.With(requireAdmin).Post("/admin/compact", NewServer(store).compact)
+
+	r.Route("/boards", func(r chi.Router) {
+		r.Get("/", NewServer(store).listBoards)
+		r.Post("/", NewServer(store).createBoard)
+		r.Post("/{boardID}/unlock", NewServer(store).unlockBoard)
+		r.Group(func(r chi.Router) {
+			r.Use(NewServer(store).requireUnlock)
+			r.Get("/{boardID}", NewServer(store).getBoard)
+			r.Patch("/{boardID}", NewServer(store).updateBoard)
+			r.Post("/{boardID}/labels", NewServer(store).createLabel)
+			r.Post("/{boardID}/fields", NewServer(store).createField)
+			r.Post("/{boardID}/rules", NewServer(store).createRule)
+			r.Delete("/{boardID}/rules/{ruleID}", NewServer(store).deleteRule)
+			r.Post("/{boardID}/protect", NewServer(store).protectBoard)
+			r.Post("/{boardID}/merge", NewServer(store).mergeBoard)
+			r.Post("/{boardID}/close", NewServer(store).setBoardClosed(true))
+			r.Post("/{boardID}/reopen", NewServer(store).setBoardClosed(false))
+			r.Post("/{boardID}/lists", NewServer(store).createList)
+			r.Put("/{boardID}/lists/order", NewServer(store).reorderLists)
+			r.Post("/{boardID}/lists/swap", NewServer(store).swapLists)
+			r.Post("/{boardID}/reindex", NewServer(store).reindexBoard)
+			r.With(requireAdmin).Post("/{boardID}/renumber", NewServer(store).renumberCards)
+			r.Post("/{boardID}/snapshots", NewServer(store).createSnapshot)
+			r.Get("/{boardID}/snapshots", NewServer(store).listSnapshots)
+			r.Post("/{boardID}/snapshots/{snapshotID}/restore", NewServer(store).restoreSnapshot)
+			r.Patch("/{boardID}/lists/{listID}", NewServer(store).updateList)
+			r.Post("/{boardID}/lists/{listID}/moveToBoard", NewServer(store).moveListToBoard)
+			r.Post("/{boardID}/cards", func(w http.ResponseWriter, r *http.Request) {
+				http.Error(w, "use /boards/{boardID}/lists/{listID}/cards", 404)
+			})
+			r.Post("/{boardID}/lists/{listID}/cards", NewServer(store).createCard)
+			r.Post("/{boardID}/lists/{listID}/cards/fromTemplate/{templateID}", NewServer(store).cardFromTemplate)
+			r.Post("/{boardID}/cards/quick", NewServer(store).quickCard)
+			r.Post("/{boardID}/lists/{listID}/cards/moveAll", NewServer(store).moveAllCards)
+			r.Post("/{boardID}/move", NewServer(store).moveCard)
+			r.Post("/{boardID}/move/byTitle", NewServer(store).moveCardByTitle)
+			r.Post("/{boardID}/move/dnd", NewServer(store).moveCardDnD)
+			r.Patch("/{boardID}/cards/{cardID}", NewServer(store).updateCard)
+			r.Put("/{boardID}/lists/{listID}/cards/{cardID}", NewServer(store).replaceCard)
+			r.Post("/{boardID}/lists/{listID}/cards/{cardID}/reorderTo", NewServer(store).reorderCard)
+			r.Post("/{boardID}/cards/{cardID}/blocks", NewServer(store).linkCards(true))
+			r.Delete("/{boardID}/cards/{cardID}/blocks/{otherID}", NewServer(store).linkCards(false))
+			r.Get("/{boardID}/blocked", NewServer(store).blockedCards)
+			r.Get("/{boardID}/stale", NewServer(store).staleCards)
+			r.Get("/{boardID}/cards", NewServer(store).listCards)
+			r.Post("/{boardID}/cards/{cardID}/complete", NewServer(store).completeCard)
+			r.Post("/{boardID}/cards/{cardID}/touch", NewServer(store).touchCard)
+			r.Post("/{boardID}/cards/{cardID}/cover", NewServer(store).setCover(true))
+			r.Delete("/{boardID}/cards/{cardID}/cover", NewServer(store).setCover(false))
+			r.Post("/{boardID}/cards/{cardID}/advance", NewServer(store).stepCard(1))
+			r.Post("/{boardID}/cards/{cardID}/retreat", NewServer(store).stepCard(-1))
+			r.Get("/{boardID}/stats", NewServer(store).boardStats)
+			r.Get("/{boardID}/metrics/flow", NewServer(store).flowMetrics)
+			r.Get("/{boardID}/lists/{listID}/aging", NewServer(store).listAging)
+			r.Post("/{boardID}/clearDone", NewServer(store).clearDone)
+			r.Post("/{boardID}/lists/{listID}/archiveAll", NewServer(store).archiveList)
+			r.Post("/{boardID}/cards/delete", NewServer(store).deleteCards)
+			r.Post("/{boardID}/cards/label", NewServer(store).labelCards)
+			r.Post("/{boardID}/cards/{cardID}/time", NewServer(store).addTimeLog)
+			r.Get("/{boardID}/cards/{cardID}/time", NewServer(store).cardTime)
+			r.Get("/{boardID}/cards/{cardID}", NewServer(store).getCard)
+			r.Get("/{boardID}/agenda", NewServer(store).agenda)
+			r.Get("/{boardID}/sync", NewServer(store).syncToken)
+			r.Get("/{boardID}/diff", NewServer(store).boardDiff)
+			r.Get("/{boardID}/export", NewServer(store).exportBoard)
+			r.Get("/{boardID}/activity", NewServer(store).activity)
+			r.Get("/{boardID}/events", NewServer(store).events)
+			r.Get("/{boardID}/events/history", NewServer(store).eventHistory)
+		})
+	})
+}
 
+// newRouter puts the middleware in front of the API, the workspaces and,
+// with cfg.ServeUI, the web UI.
+func newRouter(cfg Config, store *Store) chi.Router {
 	r := chi.NewRouter()
+	r.Use(middleware.RequestID)
+	if cfg.OTLPEndpoint != "" {
+		r.Use(traceRequests)
+	}
+	r.Use(recoverJSON)
+	r.Use(middleware.StripSlashes) // "/boards/1/" routes the same as "/boards/1"
 	r.Use(cors.Handler(cors.Options{
 		AllowedOrigins: []string{"*"},
-		AllowedMethods: []string{"GET", "POST", "PUT", "OPTIONS"},
+		AllowedMethods: []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
 		AllowedHeaders: []string{"*"},
 	}))
+	r.Use(prettyResponses)
+	ws := NewWorkspaces(store)
+	r.Use(ws.selectByQuery)
+
+	r.NotFound(notFound)
+	r.MethodNotAllowed(methodNotAllowed)
 
 	r.Get("/health", func(w http.ResponseWriter, r *http.Request) { w.Write([]byte("ok")) })
 
-	r.Route("/boards", func(r chi.Router) {
-		r.Get("/", func(w http.ResponseWriter, r *http.Request) {
-			store.mu.RLock()
-			out := make([]*Board, 0, len(store.boards))
-			for _, b := range store.boards {
-				out = append(out, b)
-			}
-			store.mu.RUnlock()
-			writeJSON(w, 200, out)
-		})
-		r.Post("/", NewServer(store).createBoard)
-		r.Get("/{boardID}", NewServer(store).getBoard)
-		r.Post("/{boardID}/lists", NewServer(store).createList)
-		r.Post("/{boardID}/cards", func(w http.ResponseWriter, r *http.Request) {
-			http.Error(w, "use /boards/{boardID}/lists/{listID}/cards", 404)
-		})
-		r.Post("/{boardID}/lists/{listID}/cards", NewServer(store).createCard)
-		r.Post("/{boardID}/move", NewServer(store).moveCard)
-		r.Get("/{boardID}/events", NewServer(store).events)
+	r.Mount("/w/{workspace}", ws)
+	if cfg.ServeUI {
+		uiRoutes(r)
+	}
+
+	r.Group(func(r chi.Router) {
+		r.Use(NewServer(store).ready, NewServer(store).writable)
+		apiRoutes(r, store)
 	})
+	return r
+}
+
+func main() {
+	cfg, err := LoadConfig(os.Args[1:], os.Getenv)
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		log.Fatalf("config: %v", err)
+	}
+	log.Printf("config: %v", cfg)
+
+	store := NewStore(cfg)
+	sseLimit, sseBoardLimit = cfg.SSEMax, cfg.SSEMaxPerBoard
+	adminToken = cfg.AdminToken
+	idStrategy = cfg.IDStrategy
+	streamThreshold = cfg.StreamThreshold
+	flushTraces := func(context.Context) error { return nil }
+	if cfg.OTLPEndpoint != "" {
+		if flushTraces, err = setupTracing(context.Background(), cfg); err != nil {
+			log.Fatalf("tracing: %v", err)
+		}
+		log.Printf("tracing: exporting spans to %s", cfg.OTLPEndpoint)
+	}
+	if err := store.load(context.Background()); err != nil {
+		log.Fatal(err)
+	}
+	if cfg.JanitorDays > 0 {
+		log.Printf("janitor: closing boards idle for %d days (dry run: %v)", cfg.JanitorDays, cfg.JanitorDryRun)
+		go store.janitor(time.Duration(cfg.JanitorDays)*24*time.Hour, time.Hour, cfg.JanitorDryRun)
+	}
+	go store.dueRules(time.Minute)
+
+	r := newRouter(cfg, store)
 
-	addr := ":8080"
-	log.Printf("Kanban Lite listening on %s", addr)
-	if err := http.ListenAndServe(addr, r); err != nil && !errors.Is(err, http.ErrServerClosed) {
+	addr := cfg.Addr
+	srv := &http.Server{
+		Addr:         addr,
+		Handler:      r,
+		ReadTimeout:  cfg.ReadTimeout,
+		WriteTimeout: cfg.WriteTimeout, // lifted for SSE in events()
+		IdleTimeout:  cfg.IdleTimeout,
+	}
+
+	// On SIGINT/SIGTERM, let requests finish (event streams get cut after
+	// the grace period), then flush the spans still waiting in the batcher.
+	sig, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		<-sig.Done()
+		log.Printf("shutting down")
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := srv.Shutdown(ctx); err != nil {
+			srv.Close()
+		}
+	}()
+
+	if cfg.TLSCert != "" {
+		// load up front so a bad pair fails at startup, not on first handshake
+		cert, lerr := tls.LoadX509KeyPair(cfg.TLSCert, cfg.TLSKey)
+		if lerr != nil {
+			log.Fatalf("tls: %v", lerr)
+		}
+		srv.TLSConfig = &tls.Config{Certificates: []tls.Certificate{cert}}
+		log.Printf("Kanban Lite listening on %s (TLS, HTTP/2)", addr)
+		err = srv.ListenAndServeTLS("", "")
+	} else {
+		log.Printf("Kanban Lite listening on %s", addr)
+		err = srv.ListenAndServe()
+	}
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
 		log.Fatalf("server failed: %v", err)
 	}
+	<-stopped
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := flushTraces(ctx); err != nil {
+		log.Printf("tracing: %v", err)
+	}
 }
@@ -0,0 +1,2288 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+// ==== Test helpers ====
+
+// newTestStore returns a loaded store. With persist, its data lives in a
+// fresh temporary directory; otherwise it is in memory. configure, if not
+// nil, adjusts the settings first.
+func newTestStore(t testing.TB, persist bool, configure func(*Config)) *Store {
+	t.Helper()
+	cfg := DefaultConfig()
+	cfg.Persist = persist
+	cfg.DataPath = filepath.Join(t.TempDir(), "kanban.json")
+	if configure != nil {
+		configure(&cfg)
+	}
+	return loadTestStore(t, cfg)
+}
+
+// loadTestStore opens the store for cfg, as a restarted server would.
+func loadTestStore(t testing.TB, cfg Config) *Store {
+	t.Helper()
+	s := NewStore(cfg)
+	if err := s.load(context.Background()); err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	t.Cleanup(func() { waitEventLogs(s) }) // before TempDir's cleanup
+	return s
+}
+
+// waitEventLogs waits until queued event log writes have reached the disk.
+func waitEventLogs(s *Store) {
+	for {
+		s.logMu.Lock()
+		busy := s.logWriting
+		s.logMu.Unlock()
+		if !busy {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// newTestAPI serves the board API for store, as apiRoutes mounts it.
+func newTestAPI(t testing.TB, store *Store) http.Handler {
+	t.Helper()
+	r := chi.NewRouter()
+	apiRoutes(r, store)
+	return r
+}
+
+// call sends a JSON request to h and decodes the answer into out (unless
+// out is nil), returning the status code. body is marshalled unless it is
+// a string, which is sent as-is.
+func call(t testing.TB, h http.Handler, method, path string, body, out any) int {
+	t.Helper()
+	var rd io.Reader
+	switch b := body.(type) {
+	case nil:
+	case string:
+		rd = strings.NewReader(b)
+	default:
+		data, err := json.Marshal(b)
+		if err != nil {
+			t.Fatalf("marshal %s %s: %v", method, path, err)
+		}
+		rd = bytes.NewReader(data)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(method, path, rd))
+	if out != nil {
+		if err := json.Unmarshal(rec.Body.Bytes(), out); err != nil {
+			t.Fatalf("%s %s: decoding %q: %v", method, path, rec.Body.String(), err)
+		}
+	}
+	return rec.Code
+}
+
+// mustCall is call for requests that have to succeed with want.
+func mustCall(t testing.TB, h http.Handler, want int, method, path string, body, out any) {
+	t.Helper()
+	var raw json.RawMessage
+	if code := call(t, h, method, path, body, &raw); code != want {
+		t.Fatalf("%s %s: status %d, want %d: %s", method, path, code, want, raw)
+	}
+	if out != nil {
+		if err := json.Unmarshal(raw, out); err != nil {
+			t.Fatalf("%s %s: decoding %s: %v", method, path, raw, err)
+		}
+	}
+}
+
+// fixture is a board with lists created through the API.
+type fixture struct {
+	board Board
+	lists []List
+}
+
+// newFixture creates a board titled title with one list per name.
+func newFixture(t testing.TB, h http.Handler, title string, lists ...string) fixture {
+	t.Helper()
+	var f fixture
+	mustCall(t, h, 201, "POST", "/boards", map[string]any{"title": title}, &f.board)
+	for _, name := range lists {
+		var l List
+		mustCall(t, h, 201, "POST", "/boards/"+string(f.board.ID)+"/lists", map[string]any{"title": name}, &l)
+		f.lists = append(f.lists, l)
+	}
+	return f
+}
+
+// path joins the board's URL with parts.
+func (f fixture) path(parts ...string) string {
+	return "/boards/" + string(f.board.ID) + strings.Join(append([]string{""}, parts...), "/")
+}
+
+// addCard creates a card in list i and returns it.
+func (f fixture) addCard(t testing.TB, h http.Handler, i int, card map[string]any) Card {
+	t.Helper()
+	var c Card
+	mustCall(t, h, 201, "POST", f.path("lists", string(f.lists[i].ID), "cards"), card, &c)
+	return c
+}
+
+// getBoard fetches the board as clients see it.
+func (f fixture) get(t testing.TB, h http.Handler) Board {
+	t.Helper()
+	var b Board
+	mustCall(t, h, 200, "GET", f.path(), nil, &b)
+	return b
+}
+
+// titles lists the card titles of list i of b in order.
+func titles(b Board, i int) []string {
+	out := []string{}
+	for _, c := range b.Lists[i].Cards {
+		out = append(out, c.Title)
+	}
+	return out
+}
+
+// withIDStrategy sets the global ID strategy for the rest of the test.
+func withIDStrategy(t testing.TB, strategy string) {
+	t.Helper()
+	old := idStrategy
+	idStrategy = strategy
+	t.Cleanup(func() { idStrategy = old })
+}
+
+// ==== IDs ====
+
+var uuidV7 = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-7[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+
+func TestNewIDStrategies(t *testing.T) {
+	withIDStrategy(t, "numeric")
+	before := time.Now()
+	id := newID()
+	if !id.numeric() {
+		t.Fatalf("numeric strategy made %q", id)
+	}
+	if ts := id.timestamp(); ts.Before(before.Add(-time.Second)) || ts.After(time.Now().Add(time.Second)) {
+		t.Errorf("numeric id %s encodes %v, not about now", id, ts)
+	}
+
+	withIDStrategy(t, "uuid")
+	id = newID()
+	if !uuidV7.MatchString(string(id)) {
+		t.Fatalf("uuid strategy made %q, want a version 7 UUID", id)
+	}
+	if ts := id.timestamp(); ts.Before(before.Add(-time.Second)) || ts.After(time.Now().Add(time.Second)) {
+		t.Errorf("uuid %s encodes %v, not about now", id, ts)
+	}
+	if other := newID(); other == id {
+		t.Errorf("two uuids in a row are both %s", id)
+	}
+}
+
+func TestIDJSON(t *testing.T) {
+	for _, tc := range []struct {
+		id   ID
+		want string
+	}{
+		{"", "0"},
+		{"42", "42"},
+		{"1792115303751684569", "1792115303751684569"},
+		{"01a1426a-411d-709f-bea5-8ea1c1baf581", `"01a1426a-411d-709f-bea5-8ea1c1baf581"`},
+		{"042", `"042"`}, // not canonical, so not a number
+	} {
+		data, err := json.Marshal(tc.id)
+		if err != nil || string(data) != tc.want {
+			t.Errorf("Marshal(%q) = %s, %v; want %s", tc.id, data, err, tc.want)
+		}
+	}
+
+	for _, tc := range []struct {
+		in   string
+		want ID
+	}{
+		{"0", ""},
+		{"null", ""},
+		{"42", "42"},
+		{`"42"`, "42"},
+		{`"042"`, "42"},
+		{`"01a1426a-411d-709f-bea5-8ea1c1baf581"`, "01a1426a-411d-709f-bea5-8ea1c1baf581"},
+	} {
+		var id ID
+		if err := json.Unmarshal([]byte(tc.in), &id); err != nil || id != tc.want {
+			t.Errorf("Unmarshal(%s) = %q, %v; want %q", tc.in, id, err, tc.want)
+		}
+	}
+	for _, in := range []string{"1.5", "true", "[1]", "99999999999999999999"} {
+		var id ID
+		if err := json.Unmarshal([]byte(in), &id); err == nil {
+			t.Errorf("Unmarshal(%s) = %q, want an error", in, id)
+		}
+	}
+}
+
+func TestCompareIDs(t *testing.T) {
+	early := ID("01a1426a-0000-7000-8000-000000000000") // 2026-10-16T01:53:19.360Z
+	late := ID("01a1426b-0000-7000-8000-000000000000")
+	numericEarly := ID("1000000000000000000") // 2001
+	numericLate := ID("1892115303751684569")  // 2029
+	for _, tc := range []struct {
+		a, b ID
+		want int
+	}{
+		{"9", "10", -1}, // by value, not text
+		{"10", "9", 1},
+		{"42", "42", 0},
+		{early, late, -1},
+		{numericEarly, early, -1}, // mixed kinds order by creation time
+		{early, numericLate, -1},
+		{numericLate, late, 1},
+	} {
+		if got := compareIDs(tc.a, tc.b); got != tc.want {
+			t.Errorf("compareIDs(%s, %s) = %d, want %d", tc.a, tc.b, got, tc.want)
+		}
+	}
+}
+
+func TestBoardRef(t *testing.T) {
+	store := newTestStore(t, false, nil)
+	api := newTestAPI(t, store)
+	f := newFixture(t, api, "Project Alpha")
+
+	for _, tc := range []struct {
+		ref  string
+		want ID
+	}{
+		{string(f.board.ID), f.board.ID},
+		{"project-alpha", f.board.ID},
+		{"nope", ""},
+		{"12345", ""},     // well-formed but unknown
+		{"../../etc", ""}, // never reaches a file name
+	} {
+		if got := store.boardRef(tc.ref); got != tc.want {
+			t.Errorf("boardRef(%q) = %q, want %q", tc.ref, got, tc.want)
+		}
+	}
+}
+
+// TestIDStrategyRoundTrip saves a store under each strategy and reloads it,
+// as a restart would; the uuid case also opens data saved with numeric ids.
+func TestIDStrategyRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	cfg := DefaultConfig()
+	cfg.DataPath = filepath.Join(dir, "kanban.json")
+	var saved []fixture
+	for _, strategy := range []string{"numeric", "uuid"} {
+		t.Run(strategy, func(t *testing.T) {
+			withIDStrategy(t, strategy)
+			store := loadTestStore(t, cfg)
+			api := newTestAPI(t, store)
+			f := newFixture(t, api, "Board "+strategy, "todo", "done")
+			c := f.addCard(t, api, 0, map[string]any{"title": "first"})
+			mustCall(t, api, 200, "POST", f.path("move"), map[string]any{"cardId": c.ID, "fromListId": f.lists[0].ID, "toListId": f.lists[1].ID}, nil)
+			if strategy == "uuid" && !uuidV7.MatchString(string(c.ID)) {
+				t.Fatalf("card id %q is not a UUID", c.ID)
+			}
+			saved = append(saved, f)
+
+			reloaded := newTestAPI(t, loadTestStore(t, cfg))
+			for _, f := range saved {
+				want, got := f.get(t, api), f.get(t, reloaded)
+				want.LastActivityAt, got.LastActivityAt = time.Time{}, time.Time{} // bumped by the reads
+				wantJSON, _ := json.Marshal(want)
+				gotJSON, _ := json.Marshal(got)
+				if !bytes.Equal(wantJSON, gotJSON) {
+					t.Errorf("board %s after reload:\n got %s\nwant %s", f.board.ID, gotJSON, wantJSON)
+				}
+				if got := titles(got, 1); len(got) != 1 || got[0] != "first" {
+					t.Errorf("board %s done list = %v", f.board.ID, got)
+				}
+			}
+		})
+	}
+}
+
+// ==== Event broadcasting ====
+
+// TestBroadcastOutsideStoreLock stalls fanout and checks that mutations and
+// reads carry on, and that the stalled events still arrive in order.
+func TestBroadcastOutsideStoreLock(t *testing.T) {
+	store := newTestStore(t, false, nil)
+	api := newTestAPI(t, store)
+	f := newFixture(t, api, "Busy", "todo")
+	sub, cancel, err := store.subscribe(f.board.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cancel()
+
+	store.subMu.Lock() // what a fanout to a huge audience looks like to others
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		f.addCard(t, api, 0, map[string]any{"title": "a"})
+		f.addCard(t, api, 0, map[string]any{"title": "b"})
+		f.get(t, api)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		store.subMu.Unlock()
+		t.Fatal("mutations waited for fanout")
+	}
+	store.subMu.Unlock()
+
+	var got []string
+	for len(got) < 2 {
+		select {
+		case e := <-sub.ch:
+			if e.Type != "card.created" {
+				continue // the fixture's own events may still be queued
+			}
+			var c Card
+			json.Unmarshal(e.Fields, &c)
+			got = append(got, c.Title)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("got events %v, want [a b]", got)
+		}
+	}
+	if got[0] != "a" || got[1] != "b" {
+		t.Errorf("got events %v, want [a b]", got)
+	}
+}
+
+// BenchmarkBroadcast measures what a mutation pays to broadcast to a board
+// with 1000 live subscribers.
+func BenchmarkBroadcast(b *testing.B) {
+	store := newTestStore(b, false, nil)
+	f := newFixture(b, newTestAPI(b, store), "Popular")
+	for i := 0; i < 1000; i++ {
+		sub, cancel, err := store.subscribe(f.board.ID)
+		if err != nil {
+			b.Fatal(err)
+		}
+		b.Cleanup(cancel)
+		go func() {
+			for range sub.ch {
+			}
+		}()
+	}
+	ctx := context.Background()
+	c := Change{Entity: "card", Op: "updated", ID: "1", Fields: map[string]string{"title": "x"}}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		store.broadcast(ctx, f.board.ID, c)
+	}
+}
+
+// ==== Saving ====
+
+// TestSaveFailureAnswersTheRequest checks that the request whose save fails
+// hears about it, rather than a later one.
+func TestSaveFailureAnswersTheRequest(t *testing.T) {
+	t.Run("failing writer", func(t *testing.T) {
+		store := newTestStore(t, true, nil)
+		api := newTestAPI(t, store)
+		f := newFixture(t, api, "Doomed", "todo")
+		// the data file's directory is a file: every write fails
+		notDir := filepath.Join(t.TempDir(), "file")
+		if err := os.WriteFile(notDir, nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		store.path = filepath.Join(notDir, "kanban.json")
+		var out map[string]string
+		if code := call(t, api, "POST", f.path("lists", string(f.lists[0].ID), "cards"), map[string]any{"title": "lost"}, &out); code != 500 {
+			t.Fatalf("status %d (%v), want 500", code, out)
+		}
+	})
+
+	t.Run("slow writer", func(t *testing.T) {
+		store := newTestStore(t, true, func(cfg *Config) { cfg.SaveTimeout = 20 * time.Millisecond })
+		api := NewServer(store).writable(newTestAPI(t, store))
+		f := newFixture(t, api, "Stuck", "todo")
+		store.writing <- struct{}{} // a write that never finishes
+		unstick := sync.OnceFunc(func() { <-store.writing })
+		t.Cleanup(unstick)
+
+		rec := httptest.NewRecorder()
+		api.ServeHTTP(rec, httptest.NewRequest("POST", f.path("lists", string(f.lists[0].ID), "cards"), strings.NewReader(`{"title":"late"}`)))
+		if rec.Code != 503 || rec.Header().Get("Retry-After") == "" {
+			t.Fatalf("timed-out save: status %d, Retry-After %q; want 503 with Retry-After", rec.Code, rec.Header().Get("Retry-After"))
+		}
+		if code := call(t, api, "POST", f.path("lists"), map[string]any{"title": "next"}, nil); code != 503 {
+			t.Errorf("change while stalled: status %d, want 503", code)
+		}
+		if code := call(t, api, "GET", f.path(), nil, nil); code != 200 {
+			t.Errorf("read while stalled: status %d, want 200", code)
+		}
+
+		unstick() // the disk comes back
+		deadline := time.Now().Add(5 * time.Second)
+		for store.saveStalled.Load() && time.Now().Before(deadline) {
+			time.Sleep(5 * time.Millisecond)
+		}
+		mustCall(t, api, 201, "POST", f.path("lists"), map[string]any{"title": "next"}, nil)
+		if got := titles(f.get(t, newTestAPI(t, loadTestStore(t, store.cfg))), 0); len(got) != 1 || got[0] != "late" {
+			t.Errorf("after recovery the data file has %v, want [late]", got)
+		}
+	})
+}
+
+// TestEventLogOffTheLock hangs the disk and checks that changes and reads
+// don't wait for the event log, which catches up once the disk is back.
+func TestEventLogOffTheLock(t *testing.T) {
+	store := newTestStore(t, true, func(cfg *Config) { cfg.SaveTimeout = 20 * time.Millisecond })
+	api := newTestAPI(t, store)
+	f := newFixture(t, api, "Logged", "todo")
+	waitEventLogs(store)
+
+	store.writing <- struct{}{}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		call(t, api, "POST", f.path("lists", string(f.lists[0].ID), "cards"), map[string]any{"title": "a"}, nil)
+		f.get(t, api)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Error("a change waited for the event log")
+	}
+	<-store.writing
+	<-done
+
+	waitEventLogs(store)
+	data, err := os.ReadFile(store.eventLogPath(f.board.ID))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"type":"card.created"`) {
+		t.Errorf("event log on disk lacks the card:\n%s", data)
+	}
+}
+
+// ==== Write-ahead log ====
+
+func TestWALCrashRecovery(t *testing.T) {
+	var cfg Config
+	s := newTestStore(t, true, func(c *Config) { c.WAL = true; cfg = *c })
+	h := newTestAPI(t, s)
+	f := newFixture(t, h, "Ops", "Todo", "Doing", "Done")
+	other := newFixture(t, h, "Other")
+	a := f.addCard(t, h, 0, map[string]any{"title": "a"})
+	b := f.addCard(t, h, 0, map[string]any{"title": "b"})
+	f.addCard(t, h, 2, map[string]any{"title": "old"})
+	if err := s.checkpoint(); err != nil {
+		t.Fatal(err)
+	}
+	snapshot, err := os.ReadFile(cfg.DataPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// one edit, one line, holding the card alone
+	before := s.walSize
+	mustCall(t, h, 200, "PATCH", f.path("cards", string(b.ID)), map[string]any{"title": "b2"}, nil)
+	wal, _ := os.ReadFile(s.walPath())
+	var ops []string
+	for _, line := range strings.Split(strings.TrimSpace(string(wal[before:])), "\n") {
+		var e walEntry
+		if err := json.Unmarshal([]byte(line), &e); err != nil {
+			t.Fatalf("line %q: %v", line, err)
+		}
+		ops = append(ops, e.Op)
+		if e.Op == "card.set" && (e.ID != b.ID || strings.Contains(line, `"title":"a"`)) {
+			t.Errorf("card edit logged more than the card: %s", line)
+		}
+	}
+	if !slices.Contains(ops, "card.set") || slices.Contains(ops, "list.set") {
+		t.Errorf("card edit logged %v, want card.set and at most board.set", ops)
+	}
+
+	c := f.addCard(t, h, 1, map[string]any{"title": "c"})
+	mustCall(t, h, 200, "POST", f.path("move"), map[string]any{"cardId": a.ID, "fromListId": f.lists[0].ID, "toListId": f.lists[1].ID, "toPos": 0}, nil)
+	mustCall(t, h, 200, "POST", f.path("lists", string(f.lists[2].ID), "archiveAll"), nil, nil)
+	mustCall(t, h, 200, "POST", f.path("cards", "delete"), map[string]any{"cardIds": []ID{c.ID}}, nil)
+	mustCall(t, h, 200, "PATCH", f.path("lists", string(f.lists[1].ID)), map[string]any{"title": "In progress"}, nil)
+	mustCall(t, h, 200, "POST", f.path("lists", string(f.lists[0].ID), "moveToBoard"), map[string]any{"toBoardId": other.board.ID}, nil)
+	mustCall(t, h, 200, "PATCH", f.path(), map[string]any{"title": "Ops 2"}, nil)
+	newFixture(t, h, "Late", "Only")
+
+	// the process dies before the next checkpoint: the data file is still
+	// the old snapshot and everything since is in the log alone
+	if got, _ := os.ReadFile(cfg.DataPath); !bytes.Equal(got, snapshot) {
+		t.Fatal("data file was rewritten; the changes were not left to the log")
+	}
+	want := boardStates(t, s)
+	waitEventLogs(s)
+	recovered := loadTestStore(t, cfg)
+	if got := boardStates(t, recovered); !equalJSON(got, want) {
+		t.Errorf("recovered boards differ:\n got %s\nwant %s", got, want)
+	}
+
+	// and the recovered store logs further changes against what it replayed
+	h2 := newTestAPI(t, recovered)
+	mustCall(t, h2, 200, "PATCH", f.path("cards", string(a.ID)), map[string]any{"title": "a2"}, nil)
+	want = boardStates(t, recovered)
+	waitEventLogs(recovered)
+	if got := boardStates(t, loadTestStore(t, cfg)); !equalJSON(got, want) {
+		t.Errorf("second replay differs:\n got %s\nwant %s", got, want)
+	}
+}
+
+// boardStates encodes every board of s, without the activity timestamps
+// that reads move.
+func boardStates(t testing.TB, s *Store) []byte {
+	t.Helper()
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	boards := map[ID]Board{}
+	for id, b := range s.boards {
+		c := *b
+		c.LastActivityAt = time.Time{}
+		boards[id] = c
+	}
+	data, err := json.Marshal(boards)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// equalJSON reports whether a and b encode the same value.
+func equalJSON(a, b []byte) bool {
+	var x, y any
+	return json.Unmarshal(a, &x) == nil && json.Unmarshal(b, &y) == nil && reflect.DeepEqual(x, y)
+}
+
+// ==== Move hooks ====
+
+// newGatekeeper starts a move hook that refuses every move into a list
+// titled "done" with a secret in its answer, and returns its base URL.
+func newGatekeeper(t testing.TB) string {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var move moveHookRequest
+		json.NewDecoder(r.Body).Decode(&move)
+		if move.ToList == "done" {
+			http.Error(w, `{"error":"internal-secret"}`, 422)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv.URL
+}
+
+// hookedFixture is a board with lists todo, doing and done whose move hook
+// is a gatekeeper.
+func hookedFixture(t testing.TB) (*Store, http.Handler, fixture) {
+	t.Helper()
+	base := newGatekeeper(t)
+	store := newTestStore(t, false, func(cfg *Config) { cfg.MoveHookAllow = []string{base + "/hooks/"} })
+	api := newTestAPI(t, store)
+	f := newFixture(t, api, "Gated", "todo", "doing", "done")
+	mustCall(t, api, 200, "PATCH", f.path(), map[string]any{"moveHook": map[string]any{"url": base + "/hooks/check"}}, nil)
+	return store, api, f
+}
+
+func TestMoveHookVetsEveryMove(t *testing.T) {
+	_, api, f := hookedFixture(t)
+	refused := func(what string, code int, out map[string]any) {
+		t.Helper()
+		if code != 409 {
+			t.Errorf("%s: status %d (%v), want 409", what, code, out)
+		}
+		if strings.Contains(fmt.Sprint(out), "internal-secret") {
+			t.Errorf("%s: hook answer leaked to the client: %v", what, out)
+		}
+	}
+
+	a := f.addCard(t, api, 1, map[string]any{"title": "a"})
+	var out map[string]any
+	refused("move", call(t, api, "POST", f.path("move"), map[string]any{"cardId": a.ID, "fromListId": f.lists[1].ID, "toListId": f.lists[2].ID}, &out), out)
+	refused("advance", call(t, api, "POST", f.path("cards", string(a.ID), "advance"), nil, &out), out)
+	refused("move/byTitle", call(t, api, "POST", f.path("move", "byTitle"), map[string]any{"cardTitle": "a", "toListTitle": "done"}, &out), out)
+	f.addCard(t, api, 1, map[string]any{"title": "b"})
+	refused("moveAll", call(t, api, "POST", f.path("lists", string(f.lists[1].ID), "cards", "moveAll"), map[string]any{"toListId": f.lists[2].ID}, &out), out)
+
+	var merge struct {
+		Applied   int
+		Conflicts []MergeConflict
+	}
+	b := f.get(t, api)
+	b.Lists[2].Cards = append(b.Lists[2].Cards, b.Lists[1].Cards[0])
+	b.Lists[1].Cards = b.Lists[1].Cards[1:]
+	mustCall(t, api, 200, "POST", f.path("merge"), b, &merge)
+	if merge.Applied != 0 || len(merge.Conflicts) != 1 || merge.Conflicts[0].Kind != "refused" {
+		t.Errorf("merge: applied %d, conflicts %+v; want one refused", merge.Applied, merge.Conflicts)
+	}
+
+	mustCall(t, api, 201, "POST", f.path("rules"), map[string]any{"type": "on-complete-move-to", "listId": f.lists[2].ID}, nil)
+	var done Card
+	mustCall(t, api, 200, "POST", f.path("cards", string(a.ID), "complete"), nil, &done)
+	if !done.Done {
+		t.Error("completing the card failed along with its rule move")
+	}
+
+	if got := f.get(t, api); len(got.Lists[2].Cards) != 0 || len(got.Lists[1].Cards) != 2 {
+		t.Errorf("cards got past the hook: doing %v, done %v", titles(got, 1), titles(got, 2))
+	}
+	// moves the hook allows still happen
+	mustCall(t, api, 200, "POST", f.path("cards", string(a.ID), "retreat"), nil, nil)
+	mustCall(t, api, 200, "POST", f.path("lists", string(f.lists[1].ID), "cards", "moveAll"), map[string]any{"toListId": f.lists[0].ID}, nil)
+	if got := titles(f.get(t, api), 0); len(got) != 2 {
+		t.Errorf("todo = %v after allowed moves, want both cards", got)
+	}
+}
+
+func TestMoveHookAllowlist(t *testing.T) {
+	redirect := httptest.NewServer(http.RedirectHandler("http://169.254.169.254/", http.StatusFound))
+	defer redirect.Close()
+	store := newTestStore(t, false, func(cfg *Config) {
+		cfg.MoveHookAllow = []string{"https://rules.example/kanban", redirect.URL + "/"}
+	})
+	api := newTestAPI(t, store)
+	f := newFixture(t, api, "Gated", "todo", "done")
+
+	for _, tc := range []struct {
+		url  string
+		want int
+	}{
+		{"https://rules.example/kanban", 200},
+		{"https://rules.example/kanban/check", 200},
+		{"https://rules.example/kanbanx", 403},
+		{"https://rules.example/kanban/../admin", 403},
+		{"http://rules.example/kanban", 403},
+		{"https://rules.example.evil/kanban", 403},
+		{"https://user@rules.example/kanban", 403},
+		{"http://169.254.169.254/latest/meta-data", 403},
+	} {
+		var out map[string]any
+		if code := call(t, api, "PATCH", f.path(), map[string]any{"moveHook": map[string]any{"url": tc.url}}, &out); code != tc.want {
+			t.Errorf("hook %s: status %d (%v), want %d", tc.url, code, out, tc.want)
+		}
+	}
+
+	// a redirecting hook isn't followed: the move is refused
+	mustCall(t, api, 200, "PATCH", f.path(), map[string]any{"moveHook": map[string]any{"url": redirect.URL + "/hook"}}, nil)
+	c := f.addCard(t, api, 0, map[string]any{"title": "a"})
+	if code := call(t, api, "POST", f.path("cards", string(c.ID), "advance"), nil, nil); code != 409 {
+		t.Errorf("move through a redirecting hook: status %d, want 409", code)
+	}
+
+	// without an allowlist, hooks can't be set, and stored ones don't run
+	store.cfg.MoveHookAllow = nil
+	if code := call(t, api, "PATCH", f.path(), map[string]any{"moveHook": map[string]any{"url": "https://rules.example/kanban"}}, nil); code != 403 {
+		t.Errorf("hook without an allowlist: status %d, want 403", code)
+	}
+	if code := call(t, api, "POST", f.path("cards", string(c.ID), "advance"), nil, nil); code != 503 {
+		t.Errorf("move with a hook no longer allowed: status %d, want 503", code)
+	}
+}
+
+// ==== Lists ====
+
+// TestMoveListToBoardDetachesBroadcast edits the moved cards while the move
+// is still being broadcast; run with -race.
+func TestMoveListToBoardDetachesBroadcast(t *testing.T) {
+	store := newTestStore(t, false, nil)
+	api := newTestAPI(t, store)
+	src := newFixture(t, api, "Source", "moving")
+	dst := newFixture(t, api, "Target")
+	var ids []ID
+	for i := 0; i < 20; i++ {
+		ids = append(ids, src.addCard(t, api, 0, map[string]any{"title": fmt.Sprint("card ", i)}).ID)
+	}
+
+	listID := src.lists[0].ID
+	var wg sync.WaitGroup
+	for round := 0; round < 10; round++ {
+		var moved List
+		mustCall(t, api, 200, "POST", src.path("lists", string(listID), "moveToBoard"), map[string]any{"toBoardId": dst.board.ID}, &moved)
+		if len(moved.Cards) != len(ids) {
+			t.Fatalf("moved list has %d cards, want %d", len(moved.Cards), len(ids))
+		}
+		wg.Add(1)
+		go func(f fixture) {
+			defer wg.Done()
+			for _, id := range ids {
+				call(t, api, "PATCH", f.path("cards", string(id)), map[string]any{"title": "edited"}, nil)
+			}
+		}(dst)
+		src, dst = dst, src
+	}
+	wg.Wait()
+}
+
+// ==== Merging ====
+
+// TestMergeEventsAreContiguous merges while other changes stream in: the
+// merge's events must take consecutive ids ending at the "events" it
+// reports, or a later merge would misread the log.
+func TestMergeEventsAreContiguous(t *testing.T) {
+	store := newTestStore(t, false, nil)
+	api := newTestAPI(t, store)
+	f := newFixture(t, api, "Offline", "todo", "busy")
+	for i := 0; i < 30; i++ {
+		f.addCard(t, api, 0, map[string]any{"title": fmt.Sprint("card ", i)})
+	}
+	offline := f.get(t, api)
+	for i := range offline.Lists[0].Cards {
+		offline.Lists[0].Cards[i].Title = fmt.Sprint("merged ", i)
+	}
+
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+					f.addCard(t, api, 1, map[string]any{"title": "noise"})
+				}
+			}
+		}()
+	}
+	var merge struct {
+		Applied int
+		Events  int64
+	}
+	mustCall(t, api, 200, "POST", f.path("merge"), offline, &merge)
+	close(stop)
+	wg.Wait()
+
+	store.mu.Lock()
+	events, _, _ := store.eventsSince(f.board.ID, offline.Events)
+	store.mu.Unlock()
+	var ids []int64
+	for _, e := range events {
+		if e.Type == "card.updated" {
+			ids = append(ids, e.ID)
+		}
+	}
+	if merge.Applied != 30 || len(ids) != 30 {
+		t.Fatalf("applied %d, logged %d updates; want 30", merge.Applied, len(ids))
+	}
+	for i, id := range ids {
+		if want := merge.Events - int64(len(ids)-1-i); id != want {
+			t.Fatalf("merge event ids %v, want %d..%d", ids, merge.Events-29, merge.Events)
+		}
+	}
+}
+
+// ==== Board diff ====
+
+// withAdminToken enables the admin endpoints for the rest of the test.
+func withAdminToken(t testing.TB, token string) {
+	t.Helper()
+	old := adminToken
+	adminToken = token
+	t.Cleanup(func() { adminToken = old })
+}
+
+// cardDiffIDs is the card part of a /diff answer, reduced to ids.
+type cardDiffIDs struct {
+	Added, Moved, Updated []struct {
+		Card struct{ ID ID }
+	}
+	Removed []ID
+}
+
+func (d cardDiffIDs) ids() map[string][]ID {
+	out := map[string][]ID{}
+	for kind, ps := range map[string][]struct{ Card struct{ ID ID } }{"added": d.Added, "moved": d.Moved, "updated": d.Updated} {
+		for _, p := range ps {
+			out[kind] = append(out[kind], p.Card.ID)
+		}
+	}
+	out["removed"] = d.Removed
+	return out
+}
+
+func TestBoardDiffBulkOps(t *testing.T) {
+	withAdminToken(t, "secret")
+	store := newTestStore(t, false, nil)
+	api := newTestAPI(t, store)
+	f := newFixture(t, api, "Diffed", "todo", "done")
+	a := f.addCard(t, api, 0, map[string]any{"title": "a"})
+	b := f.addCard(t, api, 0, map[string]any{"title": "b"})
+	c := f.addCard(t, api, 1, map[string]any{"title": "c"})
+	diff := func(since int64) map[string][]ID {
+		t.Helper()
+		var out struct{ Cards cardDiffIDs }
+		mustCall(t, api, 200, "GET", f.path(fmt.Sprintf("diff?since=%d", since)), nil, &out)
+		return out.Cards.ids()
+	}
+	want := func(what string, got map[string][]ID, kind string, ids ...ID) {
+		t.Helper()
+		for _, k := range []string{"added", "moved", "updated", "removed"} {
+			w := []ID(nil)
+			if k == kind {
+				w = ids
+			}
+			if !slices.Equal(got[k], w) {
+				t.Errorf("%s: %s = %v, want %v", what, k, got[k], w)
+			}
+		}
+	}
+
+	base := f.get(t, api).Events
+	mustCall(t, api, 200, "POST", f.path("cards", "label"), map[string]any{"cardIds": []ID{a.ID, b.ID}, "label": map[string]any{"name": "urgent"}}, nil)
+	want("bulk label", diff(base), "updated", a.ID, b.ID)
+
+	base = f.get(t, api).Events
+	mustCall(t, api, 200, "POST", f.path("cards", "delete"), map[string]any{"cardIds": []ID{a.ID}}, nil)
+	base2 := f.get(t, api).Events
+	req := httptest.NewRequest("POST", f.path("renumber"), nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	rec := httptest.NewRecorder()
+	api.ServeHTTP(rec, req)
+	if rec.Code != 200 {
+		t.Fatalf("renumber: status %d: %s", rec.Code, rec.Body)
+	}
+	want("renumber", diff(base2), "updated", b.ID, c.ID)
+	if got := diff(base)["removed"]; !slices.Equal(got, []ID{a.ID}) {
+		t.Errorf("delete then renumber: removed = %v, want [%s]", got, a.ID)
+	}
+
+	base = f.get(t, api).Events
+	mustCall(t, api, 200, "POST", f.path("lists", string(f.lists[0].ID), "cards", "moveAll"), map[string]any{"toListId": f.lists[1].ID}, nil)
+	want("moveAll", diff(base), "moved", b.ID)
+}
+
+// ==== Board passwords ====
+
+func TestPasswordHashing(t *testing.T) {
+	hash, err := hashPassword("correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(hash, "$2a$") || strings.Contains(hash, "correct horse") {
+		t.Fatalf("hash %q is not bcrypt", hash)
+	}
+	if other, _ := hashPassword("correct horse"); other == hash {
+		t.Error("two hashes of one password are equal: no salt")
+	}
+	if !checkPassword(hash, "correct horse") {
+		t.Error("the right password is rejected")
+	}
+	for _, wrong := range []string{"", "correct horse ", "Correct horse", "wrong"} {
+		if checkPassword(hash, wrong) {
+			t.Errorf("wrong password %q is accepted", wrong)
+		}
+	}
+	if _, err := hashPassword(strings.Repeat("x", 73)); err == nil {
+		t.Error("a password bcrypt would truncate is accepted")
+	}
+	if checkPassword("", "") || checkPassword("garbage", "garbage") {
+		t.Error("a malformed hash verifies")
+	}
+}
+
+func TestProtectBoard(t *testing.T) {
+	store := newTestStore(t, false, nil)
+	api := newTestAPI(t, store)
+	f := newFixture(t, api, "Private")
+	if code := call(t, api, "POST", f.path("protect"), map[string]any{"password": strings.Repeat("x", 100)}, nil); code != 400 {
+		t.Errorf("100-byte password: status %d, want 400", code)
+	}
+	mustCall(t, api, 200, "POST", f.path("protect"), map[string]any{"password": "s3cret"}, nil)
+	if code := call(t, api, "POST", f.path("unlock"), map[string]any{"password": "nope"}, nil); code != 401 {
+		t.Errorf("wrong password: status %d, want 401", code)
+	}
+	var grant struct{ Token string }
+	mustCall(t, api, 200, "POST", f.path("unlock"), map[string]any{"password": "s3cret"}, &grant)
+	req := httptest.NewRequest("GET", f.path(), nil)
+	req.Header.Set("X-Board-Token", grant.Token)
+	rec := httptest.NewRecorder()
+	api.ServeHTTP(rec, req)
+	if rec.Code != 200 {
+		t.Errorf("with the token: status %d, want 200", rec.Code)
+	}
+}
+
+// ==== Panic recovery ====
+
+func TestRecoverJSON(t *testing.T) {
+	log.SetOutput(io.Discard) // the stack traces are expected
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+	r := chi.NewRouter()
+	r.Use(middleware.RequestID)
+	r.Use(recoverJSON)
+	r.Get("/boom", func(w http.ResponseWriter, r *http.Request) { panic("boom") })
+	r.Get("/late", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("partial"))
+		panic("late")
+	})
+	r.Get("/ok", func(w http.ResponseWriter, r *http.Request) { writeJSON(w, 200, map[string]bool{"ok": true}) })
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	get := func(path string) (int, string, string) {
+		t.Helper()
+		resp, err := http.Get(srv.URL + path)
+		if err != nil {
+			t.Fatalf("GET %s: %v", path, err)
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatalf("GET %s: reading the body: %v", path, err)
+		}
+		return resp.StatusCode, resp.Header.Get("Content-Type"), string(body)
+	}
+
+	code, ctype, body := get("/boom")
+	var e map[string]string
+	if code != 500 || !strings.HasPrefix(ctype, "application/json") || json.Unmarshal([]byte(body), &e) != nil || e["error"] == "" {
+		t.Errorf("panic: %d %q %q, want a JSON 500", code, ctype, body)
+	}
+	if code, _, body = get("/late"); code != 200 || body != "partial" {
+		t.Errorf("panic after writing: %d %q, want the 200 and body already sent, untouched", code, body)
+	}
+	if code, _, _ = get("/ok"); code != 200 {
+		t.Errorf("after the panics: status %d, want 200", code)
+	}
+}
+
+// ==== List card templates ====
+
+func TestListCardTemplate(t *testing.T) {
+	api := newTestAPI(t, newTestStore(t, false, nil))
+	f := newFixture(t, api, "Triage", "Bug", "Other")
+	tmpl := map[string]any{"description": "Steps to reproduce / Expected / Actual", "checklist": []string{"repro", "fix"}}
+	var lst List
+	mustCall(t, api, 200, "PATCH", f.path("lists", string(f.lists[0].ID)), map[string]any{"cardTemplate": tmpl}, &lst)
+	if lst.CardTemplate == nil || lst.CardTemplate.Description != tmpl["description"] {
+		t.Fatalf("list after update: %+v, want the template set", lst.CardTemplate)
+	}
+
+	inherited := f.addCard(t, api, 0, map[string]any{"title": "crash"})
+	if inherited.Description != tmpl["description"] || len(inherited.Checklist) != 2 || inherited.Checklist[0].Text != "repro" {
+		t.Errorf("card in the templated list: %q %+v, want the template's description and checklist", inherited.Description, inherited.Checklist)
+	}
+	own := f.addCard(t, api, 0, map[string]any{"title": "typo", "description": "mine", "checklist": []map[string]any{{"text": "just this"}}})
+	if own.Description != "mine" || len(own.Checklist) != 1 || own.Checklist[0].Text != "just this" {
+		t.Errorf("card with its own fields: %q %+v, want them kept", own.Description, own.Checklist)
+	}
+	none := f.addCard(t, api, 0, map[string]any{"title": "no list", "checklist": []any{}})
+	if none.Description != tmpl["description"] || len(none.Checklist) != 0 {
+		t.Errorf("explicit empty checklist: %q %+v, want the description but no checklist", none.Description, none.Checklist)
+	}
+	if other := f.addCard(t, api, 1, map[string]any{"title": "plain"}); other.Description != "" || len(other.Checklist) != 0 {
+		t.Errorf("card in another list: %q %+v, want no template", other.Description, other.Checklist)
+	}
+
+	var cleared List
+	mustCall(t, api, 200, "PATCH", f.path("lists", string(f.lists[0].ID)), map[string]any{"cardTemplate": map[string]any{}}, &cleared)
+	if cleared.CardTemplate != nil {
+		t.Errorf("empty template: %+v, want it cleared", cleared.CardTemplate)
+	}
+	if c := f.addCard(t, api, 0, map[string]any{"title": "after"}); c.Description != "" || len(c.Checklist) != 0 {
+		t.Errorf("card after clearing: %q %+v, want no template", c.Description, c.Checklist)
+	}
+}
+
+// ==== Routing ====
+
+func TestTrailingSlashes(t *testing.T) {
+	store := newTestStore(t, false, nil)
+	h := newRouter(store.cfg, store)
+	f := newFixture(t, h, "Slashes/", "Todo")
+	activity := regexp.MustCompile(`"lastActivityAt":"[^"]*"`)
+	stable := func(b []byte) []byte { return activity.ReplaceAll(b, []byte(`"lastActivityAt":""`)) } // reads move it
+	for _, p := range []string{"/boards", f.path(), f.path("lists", string(f.lists[0].ID), "aging")} {
+		var plain, slashed json.RawMessage
+		mustCall(t, h, 200, "GET", p, nil, &plain)
+		mustCall(t, h, 200, "GET", p+"/", nil, &slashed)
+		if !equalJSON(stable(plain), stable(slashed)) {
+			t.Errorf("GET %s/ answered %s, want the same as GET %s: %s", p, slashed, p, plain)
+		}
+	}
+	var l List
+	mustCall(t, h, 201, "POST", f.path("lists")+"/", map[string]any{"title": "Done"}, &l)
+	if got := f.get(t, h); len(got.Lists) != 2 || got.Lists[1].ID != l.ID {
+		t.Errorf("POST with a trailing slash: lists %+v, want the new list added", got.Lists)
+	}
+}
+
+// ==== List overflow ====
+
+func TestListOverflow(t *testing.T) {
+	api := newTestAPI(t, newTestStore(t, false, nil))
+	f := newFixture(t, api, "Flow", "Doing")
+	if code := call(t, api, "PATCH", f.path("lists", string(f.lists[0].ID)), map[string]any{"maxVisible": -1}, nil); code != 400 {
+		t.Errorf("maxVisible -1: status %d, want 400", code)
+	}
+	mustCall(t, api, 200, "PATCH", f.path("lists", string(f.lists[0].ID)), map[string]any{"maxVisible": 2}, nil)
+	check := func(visible, overflow []string) {
+		t.Helper()
+		got := f.get(t, api).Lists[0]
+		var over []string
+		for _, c := range got.OverflowCards {
+			over = append(over, c.Title)
+		}
+		if vis := titles(Board{Lists: []List{got}}, 0); !slices.Equal(vis, visible) || !slices.Equal(over, overflow) {
+			t.Errorf("cards %v, overflow %v; want %v and %v", vis, over, visible, overflow)
+		}
+	}
+	f.addCard(t, api, 0, map[string]any{"title": "a"})
+	f.addCard(t, api, 0, map[string]any{"title": "b"})
+	check([]string{"a", "b"}, nil) // at the limit: nothing spills
+	f.addCard(t, api, 0, map[string]any{"title": "c"})
+	f.addCard(t, api, 0, map[string]any{"title": "d"})
+	check([]string{"a", "b"}, []string{"c", "d"}) // creation is never blocked
+
+	mustCall(t, api, 200, "PATCH", f.path("lists", string(f.lists[0].ID)), map[string]any{"maxVisible": 0}, nil)
+	check([]string{"a", "b", "c", "d"}, nil)
+}
+
+// ==== Label colors ====
+
+func TestAutoColorFromLabel(t *testing.T) {
+	api := newTestAPI(t, newTestStore(t, false, nil))
+	f := newFixture(t, api, "Colors", "Todo")
+	var red, blue Label
+	mustCall(t, api, 201, "POST", f.path("labels"), map[string]any{"name": "bug", "color": "#f00"}, &red)
+	mustCall(t, api, 201, "POST", f.path("labels"), map[string]any{"name": "idea", "color": "#00f"}, &blue)
+	patch := func(c Card, body map[string]any) Card {
+		t.Helper()
+		var out Card
+		mustCall(t, api, 200, "PATCH", f.path("cards", string(c.ID)), body, &out)
+		return out
+	}
+
+	if c := patch(f.addCard(t, api, 0, map[string]any{"title": "off"}), map[string]any{"labels": []ID{red.ID}}); c.Color != "" {
+		t.Errorf("with the option off: color %q, want none", c.Color)
+	}
+	mustCall(t, api, 200, "PATCH", f.path(), map[string]any{"autoColorFromLabel": true}, nil)
+
+	c := patch(f.addCard(t, api, 0, map[string]any{"title": "auto"}), map[string]any{"labels": []ID{red.ID}})
+	if c.Color != "#f00" {
+		t.Errorf("first label: color %q, want the label's #f00", c.Color)
+	}
+	if c = patch(c, map[string]any{"labels": []ID{blue.ID, red.ID}}); c.Color != "#00f" {
+		t.Errorf("new primary label: color %q, want #00f", c.Color)
+	}
+	if c = patch(c, map[string]any{"labels": []ID{}}); c.Color != "" {
+		t.Errorf("labels removed: color %q, want none", c.Color)
+	}
+
+	explicit := patch(f.addCard(t, api, 0, map[string]any{"title": "mine"}), map[string]any{"color": "#123", "labels": []ID{red.ID}})
+	if explicit.Color != "#123" {
+		t.Errorf("explicit color with a label: %q, want #123 kept", explicit.Color)
+	}
+	if explicit = patch(explicit, map[string]any{"labels": []ID{blue.ID}}); explicit.Color != "#123" {
+		t.Errorf("explicit color after a label change: %q, want #123 kept", explicit.Color)
+	}
+	if explicit = patch(explicit, map[string]any{"color": ""}); explicit.Color != "#00f" {
+		t.Errorf("explicit color cleared: %q, want the primary label's #00f", explicit.Color)
+	}
+}
+
+// ==== Position normalization ====
+
+func TestLoadNormalizesPositions(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Persist = true
+	cfg.DataPath = filepath.Join(t.TempDir(), "kanban.json")
+	// a hand-edited file: duplicate and gapped positions everywhere
+	data := `{"boards": {"1": {"id": 1, "title": "Imported", "lists": [
+		{"id": 10, "title": "C", "position": 5, "cards": []},
+		{"id": 11, "title": "A", "position": 1, "cards": [
+			{"id": 100, "title": "y", "position": 7},
+			{"id": 101, "title": "x", "position": 2},
+			{"id": 102, "title": "z", "position": 7}
+		]},
+		{"id": 12, "title": "B", "position": 1, "cards": []}
+	]}}}`
+	if err := os.WriteFile(cfg.DataPath, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	api := newTestAPI(t, loadTestStore(t, cfg))
+	var b Board
+	mustCall(t, api, 200, "GET", "/boards/1", nil, &b)
+	var lists []string
+	for i, l := range b.Lists {
+		lists = append(lists, l.Title)
+		if l.Position != i {
+			t.Errorf("list %s at position %d, want %d", l.Title, l.Position, i)
+		}
+	}
+	if want := []string{"A", "B", "C"}; !slices.Equal(lists, want) {
+		t.Errorf("lists %v, want %v (ties keep file order)", lists, want)
+	}
+	if got, want := titles(b, 0), []string{"x", "y", "z"}; !slices.Equal(got, want) {
+		t.Errorf("cards %v, want %v", got, want)
+	}
+	for i, c := range b.Lists[0].Cards {
+		if c.Position != i {
+			t.Errorf("card %s at position %d, want %d", c.Title, c.Position, i)
+		}
+	}
+
+	var l List
+	mustCall(t, api, 201, "POST", "/boards/1/lists", map[string]any{"title": "D"}, &l)
+	if l.Position != 3 {
+		t.Errorf("new list at position %d, want 3", l.Position)
+	}
+}
+
+// ==== Description limit ====
+
+func TestDescriptionLimit(t *testing.T) {
+	api := newTestAPI(t, newTestStore(t, false, func(c *Config) { c.MaxDescription = 10 }))
+	f := newFixture(t, api, "Notes", "Todo")
+	atLimit, over := strings.Repeat("é", 10), strings.Repeat("é", 11) // characters, not bytes
+	create := f.path("lists", string(f.lists[0].ID), "cards")
+
+	c := f.addCard(t, api, 0, map[string]any{"title": "at", "description": atLimit})
+	if c.Description != atLimit || c.DescriptionTruncated {
+		t.Errorf("at the limit: %q truncated=%v, want it kept whole", c.Description, c.DescriptionTruncated)
+	}
+	if code := call(t, api, "POST", create, map[string]any{"title": "over", "description": over}, nil); code != 400 {
+		t.Errorf("create over the limit: status %d, want 400", code)
+	}
+	var cut Card
+	mustCall(t, api, 201, "POST", create+"?truncate=true", map[string]any{"title": "over", "description": over}, &cut)
+	if cut.Description != atLimit || !cut.DescriptionTruncated {
+		t.Errorf("create with truncate: %q truncated=%v, want the first 10 characters, flagged", cut.Description, cut.DescriptionTruncated)
+	}
+
+	update := f.path("cards", string(c.ID))
+	if code := call(t, api, "PATCH", update, map[string]any{"description": over}, nil); code != 400 {
+		t.Errorf("update over the limit: status %d, want 400", code)
+	}
+	if got := f.get(t, api).Lists[0].Cards[0]; got.Description != atLimit {
+		t.Errorf("after the rejected update: %q, want it unchanged", got.Description)
+	}
+	var upd Card
+	mustCall(t, api, 200, "PATCH", update+"?truncate=true", map[string]any{"description": over}, &upd)
+	if upd.Description != atLimit || !upd.DescriptionTruncated {
+		t.Errorf("update with truncate: %q truncated=%v, want the first 10 characters, flagged", upd.Description, upd.DescriptionTruncated)
+	}
+	var short Card
+	mustCall(t, api, 200, "PATCH", update, map[string]any{"description": "short"}, &short)
+	if short.DescriptionTruncated {
+		t.Error("a description within the limit is still flagged as truncated")
+	}
+}
+
+// ==== Event streams ====
+
+// openEvents opens an SSE stream at path on srv, resuming after lastID
+// unless it is empty. The stream is closed when the test ends.
+func openEvents(t testing.TB, srv *httptest.Server, path, lastID string) (*http.Response, *bufio.Reader) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	req, err := http.NewRequestWithContext(ctx, "GET", srv.URL+path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lastID != "" {
+		req.Header.Set("Last-Event-ID", lastID)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		cancel()
+		t.Fatalf("GET %s: %v", path, err)
+	}
+	t.Cleanup(func() {
+		cancel()
+		resp.Body.Close()
+	})
+	return resp, bufio.NewReader(resp.Body)
+}
+
+// sseFrame is one message of an event stream.
+type sseFrame struct {
+	ID   string
+	Data map[string]any
+}
+
+// readFrame reads the next message from an event stream, skipping pings.
+func readFrame(t testing.TB, rd *bufio.Reader) sseFrame {
+	t.Helper()
+	var f sseFrame
+	for {
+		line, err := rd.ReadString('\n')
+		if err != nil {
+			t.Fatalf("reading the stream: %v", err)
+		}
+		line = strings.TrimSuffix(line, "\n")
+		switch {
+		case line == "":
+			if f.Data != nil {
+				return f
+			}
+		case strings.HasPrefix(line, "id: "):
+			f.ID = line[len("id: "):]
+		case strings.HasPrefix(line, "data: "):
+			if err := json.Unmarshal([]byte(line[len("data: "):]), &f.Data); err != nil {
+				t.Fatalf("data line %q: %v", line, err)
+			}
+		}
+	}
+}
+
+func TestSSEReplayWindow(t *testing.T) {
+	cfg, err := LoadConfig(nil, envOf(map[string]string{"KANBAN_SSE_REPLAY": "3"}))
+	if err != nil || cfg.EventLogSize != 3 {
+		t.Fatalf("KANBAN_SSE_REPLAY=3: EventLogSize %d (%v), want 3", cfg.EventLogSize, err)
+	}
+	store := newTestStore(t, false, func(c *Config) { c.EventLogSize = 3 })
+	api := newTestAPI(t, store)
+	srv := httptest.NewServer(api)
+	t.Cleanup(srv.Close) // after the streams' cleanups have closed them
+	f := newFixture(t, api, "Replay", "Todo")
+	for i := range 5 {
+		f.addCard(t, api, 0, map[string]any{"title": fmt.Sprint("card ", i)})
+	}
+	latest := f.get(t, api).Events // the last 3 of these are retained
+	oldest := latest - 2
+
+	resp, rd := openEvents(t, srv, f.path("events"), "1")
+	if got := resp.Header.Get("X-Oldest-Event-ID"); got != fmt.Sprint(oldest) {
+		t.Errorf("X-Oldest-Event-ID %q, want %d", got, oldest)
+	}
+	hint := readFrame(t, rd)
+	if hint.Data["op"] != "sync" || hint.Data["fields"].(map[string]any)["oldestEventId"] != float64(oldest) {
+		t.Errorf("first message %v, want a sync hint with oldestEventId %d", hint.Data, oldest)
+	}
+	resync := readFrame(t, rd)
+	if resync.Data["op"] != "resync" || resync.ID != "" || resync.Data["fields"].(map[string]any)["reason"] != "expired" {
+		t.Errorf("after a too-old Last-Event-ID: %+v, want an id-less resync hint (expired)", resync)
+	}
+
+	// just inside the window: the missed events are replayed instead
+	_, rd = openEvents(t, srv, f.path("events"), fmt.Sprint(oldest-1))
+	readFrame(t, rd)
+	for want := oldest; want <= latest; want++ {
+		if e := readFrame(t, rd); e.ID != fmt.Sprint(want) {
+			t.Fatalf("replay: got %+v, want event %d", e, want)
+		}
+	}
+}
+
+// ==== Input normalization ====
+
+func TestTitleAndDescriptionCleaning(t *testing.T) {
+	api := newTestAPI(t, newTestStore(t, false, nil))
+	f := newFixture(t, api, "  Team\x00 board\n ", "\tTodo\r\n")
+	if f.board.Title != "Team board" || f.lists[0].Title != "Todo" {
+		t.Errorf("board %q, list %q; want them trimmed and stripped", f.board.Title, f.lists[0].Title)
+	}
+
+	c := f.addCard(t, api, 0, map[string]any{
+		"title":       "  \tFix\x00 the\nbug \x07 ",
+		"description": "  line one\r\n\tindented\x1b[31m red\n\n ",
+	})
+	if c.Title != "Fix the bug" {
+		t.Errorf("created title %q, want %q", c.Title, "Fix the bug")
+	}
+	if want := "line one\n\tindented[31m red"; c.Description != want {
+		t.Errorf("created description %q, want %q", c.Description, want)
+	}
+
+	var upd Card
+	mustCall(t, api, 200, "PATCH", f.path("cards", string(c.ID)), map[string]any{"title": "new\r\ntitle\x7f", "description": "\x00kept\ttab\x08"}, &upd)
+	if upd.Title != "new  title" || upd.Description != "kept\ttab" {
+		t.Errorf("updated %q / %q, want %q / %q", upd.Title, upd.Description, "new  title", "kept\ttab")
+	}
+	for _, title := range []string{" \t\n", "\x00\x01"} {
+		if code := call(t, api, "PATCH", f.path("cards", string(c.ID)), map[string]any{"title": title}, nil); code != 400 {
+			t.Errorf("title %q: status %d, want 400 (nothing left after cleaning)", title, code)
+		}
+	}
+}
+
+// withSSELimits sets the global stream caps for the rest of the test.
+func withSSELimits(t testing.TB, total, perBoard int) {
+	t.Helper()
+	oldTotal, oldBoard := sseLimit, sseBoardLimit
+	sseLimit, sseBoardLimit = total, perBoard
+	t.Cleanup(func() { sseLimit, sseBoardLimit = oldTotal, oldBoard })
+}
+
+func TestSSEConnectionCap(t *testing.T) {
+	withSSELimits(t, 2, 0)
+	api := newTestAPI(t, newTestStore(t, false, nil))
+	srv := httptest.NewServer(api)
+	t.Cleanup(srv.Close)
+	f := newFixture(t, api, "Busy")
+
+	first, _ := openEvents(t, srv, f.path("events"), "")
+	second, _ := openEvents(t, srv, f.path("events"), "")
+	if first.StatusCode != 200 || second.StatusCode != 200 {
+		t.Fatalf("streams within the cap: %d, %d; want 200", first.StatusCode, second.StatusCode)
+	}
+	third, _ := openEvents(t, srv, f.path("events"), "")
+	if third.StatusCode != 503 || third.Header.Get("Retry-After") == "" {
+		t.Errorf("stream over the cap: %d (Retry-After %q), want 503 with Retry-After", third.StatusCode, third.Header.Get("Retry-After"))
+	}
+
+	// a disconnect frees its slot
+	first.Body.Close()
+	deadline := time.Now().Add(5 * time.Second)
+	for sseOpen.Load() >= 2 {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d streams still counted after a disconnect", sseOpen.Load())
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if again, _ := openEvents(t, srv, f.path("events"), ""); again.StatusCode != 200 {
+		t.Errorf("after a disconnect: status %d, want 200", again.StatusCode)
+	}
+}
+
+func TestSSEPerBoardCap(t *testing.T) {
+	withSSELimits(t, 0, 1)
+	api := newTestAPI(t, newTestStore(t, false, nil))
+	srv := httptest.NewServer(api)
+	t.Cleanup(srv.Close)
+	busy, quiet := newFixture(t, api, "Busy"), newFixture(t, api, "Quiet")
+
+	if resp, _ := openEvents(t, srv, busy.path("events"), ""); resp.StatusCode != 200 {
+		t.Fatalf("first stream: status %d, want 200", resp.StatusCode)
+	}
+	if resp, _ := openEvents(t, srv, busy.path("events"), ""); resp.StatusCode != 503 {
+		t.Errorf("second stream on the board: status %d, want 503", resp.StatusCode)
+	}
+	if resp, _ := openEvents(t, srv, quiet.path("events"), ""); resp.StatusCode != 200 {
+		t.Errorf("stream on another board: status %d, want 200", resp.StatusCode)
+	}
+}
+
+// ==== Unicode titles ====
+
+func TestUnicodeTitles(t *testing.T) {
+	api := newTestAPI(t, newTestStore(t, false, func(c *Config) { c.MaxDescription = 3; c.ExcerptLength = 2 }))
+	var b Board
+	for _, title := range []string{strings.Repeat("🚀", maxTitle), strings.Repeat("看", maxTitle)} {
+		mustCall(t, api, 201, "POST", "/boards", map[string]any{"title": title}, &b)
+		if b.Title != title {
+			t.Errorf("a %d-character title of %d bytes came back as %q", maxTitle, len(title), b.Title)
+		}
+		if code := call(t, api, "POST", "/boards", map[string]any{"title": title + "x"}, nil); code != 400 {
+			t.Errorf("%d characters: status %d, want 400", maxTitle+1, code)
+		}
+	}
+
+	for title, slug := range map[string]string{
+		"Café 🚀 Plan": "cafe-plan",
+		"看板 ボード":      "看板-ボード",
+		"🎉🎉":          "",
+	} {
+		var b Board
+		mustCall(t, api, 201, "POST", "/boards", map[string]any{"title": title}, &b)
+		if b.Slug != slug {
+			t.Errorf("slug of %q: %q, want %q", title, b.Slug, slug)
+		}
+		if slug != "" {
+			var got Board
+			mustCall(t, api, 200, "GET", "/boards/"+url.PathEscape(slug), nil, &got)
+			if got.ID != b.ID {
+				t.Errorf("GET by slug %q: board %v, want %v", slug, got.ID, b.ID)
+			}
+		}
+	}
+
+	f := newFixture(t, api, "Cuts", "Todo")
+	var c Card
+	mustCall(t, api, 201, "POST", f.path("lists", string(f.lists[0].ID), "cards")+"?truncate=true", map[string]any{"title": "t", "description": "👍🏽👍🏽"}, &c)
+	if !utf8.ValidString(c.Description) || c.Description != "👍🏽👍" {
+		t.Errorf("truncated description %q, want the first 3 characters, cut between code points", c.Description)
+	}
+	mustCall(t, api, 200, "GET", f.path()+"?descriptions=excerpt", nil, &b)
+	if ex := b.Lists[0].Cards[0].DescriptionExcerpt; ex != "👍🏽" {
+		t.Errorf("excerpt %q, want the first 2 characters", ex)
+	}
+}
+
+// ==== Encryption at rest ====
+
+func TestEncryptionAtRest(t *testing.T) {
+	key := base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{7}, 32))
+	store := newTestStore(t, true, func(c *Config) { c.EncryptionKey = key })
+	api := newTestAPI(t, store)
+	f := newFixture(t, api, "Top secret plans", "Todo")
+	f.addCard(t, api, 0, map[string]any{"title": "launch codes"})
+
+	data, err := os.ReadFile(store.cfg.DataPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(data, encHeader) || bytes.Contains(data, []byte("secret")) || bytes.Contains(data, []byte("launch")) {
+		t.Fatalf("data file is not encrypted: %.80q", data)
+	}
+	reopened := loadTestStore(t, store.cfg)
+	if got := f.get(t, newTestAPI(t, reopened)); got.Title != "Top secret plans" || titles(got, 0)[0] != "launch codes" {
+		t.Errorf("after reopening with the key: %+v", got)
+	}
+
+	for name, cfgKey := range map[string]string{
+		"wrong key": base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{8}, 32)),
+		"no key":    "",
+	} {
+		cfg := store.cfg
+		cfg.EncryptionKey = cfgKey
+		err := NewStore(cfg).load(context.Background())
+		if err == nil {
+			t.Errorf("%s: load succeeded, want an error rather than an empty store", name)
+		} else if !strings.Contains(err.Error(), "KANBAN_ENCRYPTION_KEY") {
+			t.Errorf("%s: error %q does not point at the key", name, err)
+		}
+		if after, _ := os.ReadFile(store.cfg.DataPath); !bytes.Equal(after, data) {
+			t.Errorf("%s: the data file was changed", name)
+		}
+	}
+
+	short := base64.StdEncoding.EncodeToString([]byte("short"))
+	if _, err := LoadConfig(nil, envOf(map[string]string{"KANBAN_ENCRYPTION_KEY": short})); err == nil || !strings.Contains(err.Error(), "KANBAN_ENCRYPTION_KEY") {
+		t.Errorf("5-byte key: config error %v, want KANBAN_ENCRYPTION_KEY rejected", err)
+	}
+}
+
+// ==== Card sorting ====
+
+func TestCardSort(t *testing.T) {
+	api := newTestAPI(t, newTestStore(t, false, nil))
+	f := newFixture(t, api, "Sorted", "Todo")
+	mustCall(t, api, 201, "POST", f.path("fields"), map[string]any{"name": "priority", "type": "number"}, nil)
+	day := time.Now().UTC().Add(24 * time.Hour).Truncate(time.Second)
+	f.addCard(t, api, 0, map[string]any{"title": "banana", "due": day.Add(48 * time.Hour), "customFields": map[string]any{"priority": 2}})
+	f.addCard(t, api, 0, map[string]any{"title": "Apple"})
+	f.addCard(t, api, 0, map[string]any{"title": "cherry", "due": day, "customFields": map[string]any{"priority": 5}})
+
+	for _, tc := range []struct {
+		query string
+		want  []string
+	}{
+		{"", []string{"banana", "Apple", "cherry"}},
+		{"?cardSort=position&cardSortDir=desc", []string{"cherry", "Apple", "banana"}},
+		{"?cardSort=due", []string{"cherry", "banana", "Apple"}}, // no due date: last
+		{"?cardSort=due&cardSortDir=desc", []string{"banana", "cherry", "Apple"}},
+		{"?cardSort=priority", []string{"banana", "cherry", "Apple"}},
+		{"?cardSort=priority&cardSortDir=desc", []string{"cherry", "banana", "Apple"}},
+		{"?cardSort=created", []string{"banana", "Apple", "cherry"}},
+		{"?cardSort=created&cardSortDir=desc", []string{"cherry", "Apple", "banana"}},
+		{"?cardSort=title", []string{"Apple", "banana", "cherry"}}, // case-insensitive
+		{"?cardSort=title&cardSortDir=desc", []string{"cherry", "banana", "Apple"}},
+	} {
+		var b Board
+		mustCall(t, api, 200, "GET", f.path()+tc.query, nil, &b)
+		if got := titles(b, 0); !slices.Equal(got, tc.want) {
+			t.Errorf("GET %s: %v, want %v", tc.query, got, tc.want)
+		}
+	}
+	if got := titles(f.get(t, api), 0); !slices.Equal(got, []string{"banana", "Apple", "cherry"}) {
+		t.Errorf("stored order after sorted reads: %v, want it unchanged", got)
+	}
+	for _, q := range []string{"?cardSort=rank", "?cardSortDir=up"} {
+		if code := call(t, api, "GET", f.path()+q, nil, nil); code != 400 {
+			t.Errorf("GET %s: status %d, want 400", q, code)
+		}
+	}
+}
+
+// ==== Board themes ====
+
+func TestBoardTheme(t *testing.T) {
+	api := newTestAPI(t, newTestStore(t, false, nil))
+	f := newFixture(t, api, "Themed")
+	theme := map[string]any{"primaryColor": "#1e90ff", "accentColor": "#FA0", "icon": "🚀"}
+	mustCall(t, api, 200, "PATCH", f.path(), map[string]any{"theme": theme}, nil)
+
+	want := Theme{PrimaryColor: "#1e90ff", AccentColor: "#FA0", Icon: "🚀"}
+	if got := f.get(t, api).Theme; got == nil || *got != want {
+		t.Errorf("board theme %+v, want %+v", got, want)
+	}
+	var boards []Board
+	mustCall(t, api, 200, "GET", "/boards", nil, &boards)
+	if len(boards) != 1 || boards[0].Theme == nil || *boards[0].Theme != want {
+		t.Errorf("listBoards theme: %+v, want %+v", boards, want)
+	}
+
+	for _, bad := range []map[string]any{
+		{"primaryColor": "blue"},
+		{"primaryColor": "#12345"},
+		{"accentColor": "1e90ff"},
+		{"accentColor": "#ggg"},
+		{"icon": "rocket"},
+		{"icon": "1"},
+		{"icon": "🚀🚀🚀🚀🚀🚀🚀🚀🚀🚀🚀"},
+	} {
+		if code := call(t, api, "PATCH", f.path(), map[string]any{"theme": bad}, nil); code != 400 {
+			t.Errorf("theme %v: status %d, want 400", bad, code)
+		}
+	}
+	if got := f.get(t, api).Theme; got == nil || *got != want {
+		t.Errorf("after rejected updates: %+v, want %+v", got, want)
+	}
+	for _, ok := range []string{"👍🏽", "👨‍👩‍👧", "1️⃣"} {
+		if code := call(t, api, "PATCH", f.path(), map[string]any{"theme": map[string]any{"icon": ok}}, nil); code != 200 {
+			t.Errorf("icon %q: status %d, want 200", ok, code)
+		}
+	}
+
+	mustCall(t, api, 200, "PATCH", f.path(), map[string]any{"theme": map[string]any{}}, nil)
+	if got := f.get(t, api).Theme; got != nil {
+		t.Errorf("after {}: theme %+v, want it cleared", got)
+	}
+}
+
+// ==== Mentions ====
+
+func TestCardMentions(t *testing.T) {
+	api := newTestAPI(t, newTestStore(t, false, nil))
+	f := newFixture(t, api, "Team", "Todo")
+	// mentioned returns the card.mention events after event id since.
+	type mention struct {
+		CardID ID `json:"cardId"`
+		Users  []string
+	}
+	mentioned := func(since int64) (out []mention) {
+		t.Helper()
+		var page struct{ Events []Event }
+		mustCall(t, api, 200, "GET", f.path("events", "history")+fmt.Sprint("?since=", since), nil, &page)
+		for _, e := range page.Events {
+			if e.Type == "card.mention" {
+				var m mention
+				json.Unmarshal(e.Fields, &m)
+				out = append(out, m)
+			}
+		}
+		return out
+	}
+
+	since := f.get(t, api).Events
+	f.addCard(t, api, 0, map[string]any{"title": "quiet", "description": "no one here; write to bob@example.com"})
+	if got := mentioned(since); len(got) != 0 {
+		t.Errorf("no mentions: events %v, want none", got)
+	}
+
+	since = f.get(t, api).Events
+	c := f.addCard(t, api, 0, map[string]any{"title": "loud", "description": "@alice and @Bob-2, cc @ALICE"})
+	got := mentioned(since)
+	if len(got) != 1 || got[0].CardID != c.ID {
+		t.Fatalf("mention events %v, want one for card %v", got, c.ID)
+	}
+	if !slices.Equal(got[0].Users, []string{"alice", "Bob-2"}) {
+		t.Errorf("mentioned users %v, want [alice Bob-2] (deduplicated)", got[0].Users)
+	}
+	if c.Watchers != nil {
+		t.Errorf("watchers %v without WatchMentions, want none", c.Watchers)
+	}
+
+	mustCall(t, api, 200, "PATCH", f.path(), map[string]any{"watchMentions": true}, nil)
+	since = f.get(t, api).Events
+	var upd Card
+	mustCall(t, api, 200, "PATCH", f.path("cards", string(c.ID)), map[string]any{"description": "@alice @Bob-2 now @carol"}, &upd)
+	if got := mentioned(since); len(got) != 1 || !slices.Equal(got[0].Users, []string{"carol"}) {
+		t.Errorf("after the edit: events %v, want one naming only the new @carol", got)
+	}
+	if !slices.Equal(upd.Watchers, []string{"carol"}) {
+		t.Errorf("watchers %v, want [carol]", upd.Watchers)
+	}
+}
+
+// ==== Configuration ====
+
+// envOf serves env as a getenv function.
+func envOf(env map[string]string) func(string) string {
+	return func(k string) string { return env[k] }
+}
+
+func TestLoadConfig(t *testing.T) {
+	cfg, err := LoadConfig(nil, envOf(nil))
+	if err != nil {
+		t.Fatalf("defaults: %v", err)
+	}
+	if !reflect.DeepEqual(cfg, DefaultConfig()) {
+		t.Errorf("with nothing set:\n got %+v\nwant %+v", cfg, DefaultConfig())
+	}
+	if cfg.DataPath != "./data/kanban.json" || !cfg.Persist || cfg.Addr != ":8080" {
+		t.Errorf("defaults: data %q persist %v addr %q", cfg.DataPath, cfg.Persist, cfg.Addr)
+	}
+
+	cfg, err = LoadConfig([]string{"-strict"}, envOf(map[string]string{
+		"KANBAN_DATA":                 "/srv/kanban.json",
+		"KANBAN_PERSIST":              "false",
+		"KANBAN_SAVE_TIMEOUT":         "3s",
+		"KANBAN_MAX_BATCH":            "7",
+		"KANBAN_ADMIN_TOKEN":          "hunter2",
+		"OTEL_EXPORTER_OTLP_ENDPOINT": "http://collector:4318/",
+	}))
+	if err != nil {
+		t.Fatalf("overrides: %v", err)
+	}
+	if cfg.DataPath != "/srv/kanban.json" || cfg.Persist || cfg.SaveTimeout != 3*time.Second || cfg.MaxBatch != 7 || !cfg.Strict {
+		t.Errorf("overrides not applied: %+v", cfg)
+	}
+	if cfg.OTLPEndpoint != "http://collector:4318/v1/traces" {
+		t.Errorf("OTLP endpoint %q, want the traces path under the base", cfg.OTLPEndpoint)
+	}
+	if s := cfg.String(); strings.Contains(s, "hunter2") || !strings.Contains(s, "/srv/kanban.json") {
+		t.Errorf("String() = %s, want the token masked and the rest shown", s)
+	}
+
+	// every bad value is reported, not just the first
+	_, err = LoadConfig(nil, envOf(map[string]string{
+		"KANBAN_PERSIST":      "sometimes",
+		"KANBAN_MAX_BATCH":    "-1",
+		"KANBAN_SAVE_TIMEOUT": "soon",
+		"KANBAN_ID_STRATEGY":  "random",
+	}))
+	for _, name := range []string{"KANBAN_PERSIST", "KANBAN_MAX_BATCH", "KANBAN_SAVE_TIMEOUT", "KANBAN_ID_STRATEGY"} {
+		if err == nil || !strings.Contains(err.Error(), name) {
+			t.Errorf("bad values: error %v does not name %s", err, name)
+		}
+	}
+	if _, err := LoadConfig([]string{"-cert", "c.pem"}, envOf(nil)); err == nil {
+		t.Error("-cert without -key: no error")
+	}
+}
+
+// ==== Idempotent list creation ====
+
+func TestIdempotentListCreation(t *testing.T) {
+	store := newTestStore(t, false, nil)
+	api := newTestAPI(t, store)
+	f, other := newFixture(t, api, "Retry"), newFixture(t, api, "Other")
+	post := func(fx fixture, key string, body map[string]any) (int, List) {
+		t.Helper()
+		data, _ := json.Marshal(body)
+		req := httptest.NewRequest("POST", fx.path("lists"), bytes.NewReader(data))
+		if key != "" {
+			req.Header.Set("Idempotency-Key", key)
+		}
+		rec := httptest.NewRecorder()
+		api.ServeHTTP(rec, req)
+		var l List
+		json.Unmarshal(rec.Body.Bytes(), &l)
+		return rec.Code, l
+	}
+
+	// a burst of retries of one request
+	var wg sync.WaitGroup
+	codes := make([]int, 8)
+	ids := make([]ID, 8)
+	for i := range codes {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var l List
+			codes[i], l = post(f, "done-col", map[string]any{"title": "Done"})
+			ids[i] = l.ID
+		}()
+	}
+	wg.Wait()
+	slices.Sort(codes)
+	if codes[0] != 200 || codes[6] != 200 || codes[7] != 201 {
+		t.Errorf("statuses %v, want one 201 and the rest 200", codes)
+	}
+	for _, id := range ids {
+		if id != ids[0] {
+			t.Errorf("retries returned lists %v, want one list", ids)
+			break
+		}
+	}
+	if n := len(f.get(t, api).Lists); n != 1 {
+		t.Fatalf("board has %d lists after keyed retries, want 1", n)
+	}
+
+	if code, l := post(f, "", map[string]any{"title": "Done", "key": "done-col"}); code != 200 || l.ID != ids[0] {
+		t.Errorf("same key in the body: %d %v, want 200 with list %v", code, l.ID, ids[0])
+	}
+	if code, _ := post(f, "other-key", map[string]any{"title": "Done"}); code != 201 {
+		t.Errorf("another key: status %d, want 201", code)
+	}
+	if code, _ := post(other, "done-col", map[string]any{"title": "Done"}); code != 201 {
+		t.Errorf("same key on another board: status %d, want 201", code)
+	}
+
+	store.mu.Lock()
+	k := listKey{f.board.ID, "done-col"}
+	store.listKeys[k] = keyedList{listID: store.listKeys[k].listID, expires: time.Now().Add(-time.Second)}
+	store.mu.Unlock()
+	if code, _ := post(f, "done-col", map[string]any{"title": "Done"}); code != 201 {
+		t.Errorf("expired key: status %d, want 201", code)
+	}
+	if code, _ := post(f, strings.Repeat("k", 256), map[string]any{"title": "Done"}); code != 400 {
+		t.Errorf("256-byte key: status %d, want 400", code)
+	}
+}
+
+func TestGetOrCreateList(t *testing.T) {
+	api := newTestAPI(t, newTestStore(t, false, nil))
+	f := newFixture(t, api, "Setup", "Done")
+	f.addCard(t, api, 0, map[string]any{"title": "shipped"})
+	ensure := f.path("lists") + "?getOrCreate=true"
+
+	var got List
+	mustCall(t, api, 200, "POST", ensure, map[string]any{"title": "dONE"}, &got)
+	if got.ID != f.lists[0].ID || len(got.Cards) != 1 {
+		t.Errorf("existing title (other case): list %v with %d cards, want %v with its card", got.ID, len(got.Cards), f.lists[0].ID)
+	}
+	var created List
+	mustCall(t, api, 201, "POST", ensure, map[string]any{"title": "Review"}, &created)
+	mustCall(t, api, 200, "POST", ensure, map[string]any{"title": "review"}, &got)
+	if got.ID != created.ID {
+		t.Errorf("second ensure of Review: list %v, want %v", got.ID, created.ID)
+	}
+	mustCall(t, api, 201, "POST", f.path("lists"), map[string]any{"title": "Done"}, nil)
+	if n := len(f.get(t, api).Lists); n != 3 {
+		t.Errorf("%d lists, want 3 (a plain create still duplicates)", n)
+	}
+}
+
+// ==== Batch limits ====
+
+// endless yields `1,` forever: a batch that would never finish decoding.
+type endless struct{}
+
+func (endless) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = "1,"[i%2]
+	}
+	return len(p) - len(p)%2, nil
+}
+
+func TestBatchLimit(t *testing.T) {
+	api := newTestAPI(t, newTestStore(t, false, func(c *Config) { c.MaxBatch = 3 }))
+	f := newFixture(t, api, "Batches", "Todo")
+	var ids []ID
+	for i := range 4 {
+		ids = append(ids, f.addCard(t, api, 0, map[string]any{"title": fmt.Sprint(i)}).ID)
+	}
+
+	label := map[string]any{"name": "bulk"}
+	if code := call(t, api, "POST", f.path("cards", "label"), map[string]any{"cardIds": ids, "label": label}, nil); code != 400 {
+		t.Errorf("labelling 4 cards with a limit of 3: status %d, want 400", code)
+	}
+	if code := call(t, api, "POST", f.path("cards", "delete"), map[string]any{"cardIds": ids}, nil); code != 400 {
+		t.Errorf("deleting 4 cards with a limit of 3: status %d, want 400", code)
+	}
+	if got := f.get(t, api); len(got.Lists[0].Cards) != 4 || len(got.Labels) != 0 {
+		t.Errorf("after the refused batches: %d cards, labels %v; want nothing changed", len(got.Lists[0].Cards), got.Labels)
+	}
+	mustCall(t, api, 200, "POST", f.path("cards", "label"), map[string]any{"cardIds": ids[:3], "label": label}, nil)
+	mustCall(t, api, 200, "POST", f.path("cards", "delete"), map[string]any{"cardIds": ids[:3]}, nil)
+	if got := titles(f.get(t, api), 0); !slices.Equal(got, []string{"3"}) {
+		t.Errorf("after batches at the limit: cards %v, want [3]", got)
+	}
+
+	// the limit is hit while decoding, not after reading the whole body
+	body := io.MultiReader(strings.NewReader(`{"cardIds": [`), endless{})
+	done := make(chan error, 1)
+	go func() {
+		_, err := decodeBatch(body, "cardIds", 3, nil)
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if !errors.Is(err, errBatchTooLarge) {
+			t.Errorf("endless batch: %v, want errBatchTooLarge", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("decodeBatch kept reading an endless batch")
+	}
+	if got, err := decodeBatch(strings.NewReader(`{"cardIds": [1, 2, 3]}`), "cardIds", 3, nil); err != nil || len(got) != 3 {
+		t.Errorf("3 ids with a limit of 3: %v, %v", got, err)
+	}
+}
+
+// ==== Moving cards ====
+
+// moveResult is moveCard's response.
+type moveResult struct {
+	Card  Card
+	Lists []List
+}
+
+func TestMoveCardReturnsLists(t *testing.T) {
+	api := newTestAPI(t, newTestStore(t, false, nil))
+	f := newFixture(t, api, "Moves", "Todo", "Doing")
+	a := f.addCard(t, api, 0, map[string]any{"title": "a"})
+	f.addCard(t, api, 0, map[string]any{"title": "b"})
+	c := f.addCard(t, api, 0, map[string]any{"title": "c"})
+	f.addCard(t, api, 1, map[string]any{"title": "x"})
+
+	var res moveResult
+	mustCall(t, api, 200, "POST", f.path("move"), map[string]any{"cardId": a.ID, "fromListId": f.lists[0].ID, "toListId": f.lists[1].ID, "toPos": 0}, &res)
+	if res.Card.ID != a.ID || res.Card.Position != 0 {
+		t.Errorf("moved card %v at %d, want %v at 0", res.Card.ID, res.Card.Position, a.ID)
+	}
+	if len(res.Lists) != 2 || res.Lists[0].ID != f.lists[0].ID || res.Lists[1].ID != f.lists[1].ID {
+		t.Fatalf("lists %+v, want the source then the target", res.Lists)
+	}
+	b := Board{Lists: res.Lists}
+	if got := titles(b, 0); !slices.Equal(got, []string{"b", "c"}) {
+		t.Errorf("source list %v, want [b c]", got)
+	}
+	if got := titles(b, 1); !slices.Equal(got, []string{"a", "x"}) {
+		t.Errorf("target list %v, want [a x]", got)
+	}
+	for _, l := range res.Lists {
+		for i, card := range l.Cards {
+			if card.Position != i {
+				t.Errorf("%s: card %s at position %d, want %d", l.Title, card.Title, card.Position, i)
+			}
+		}
+	}
+	if stored := f.get(t, api); !slices.Equal(titles(stored, 0), titles(b, 0)) || !slices.Equal(titles(stored, 1), titles(b, 1)) {
+		t.Errorf("response %v %v differs from the stored board %v %v", titles(b, 0), titles(b, 1), titles(stored, 0), titles(stored, 1))
+	}
+
+	res = moveResult{}
+	mustCall(t, api, 200, "POST", f.path("move"), map[string]any{"cardId": c.ID, "fromListId": f.lists[0].ID, "toListId": f.lists[0].ID, "toPos": 0}, &res)
+	if len(res.Lists) != 1 || !slices.Equal(titles(Board{Lists: res.Lists}, 0), []string{"c", "b"}) {
+		t.Errorf("reorder within a list: %+v, want the one list as [c b]", res.Lists)
+	}
+}
+
+func TestStrictMove(t *testing.T) {
+	api := newTestAPI(t, newTestStore(t, false, nil))
+	f := newFixture(t, api, "Strict", "Todo", "Doing")
+	var todo []Card
+	for _, title := range []string{"a", "b", "c", "d", "e"} {
+		todo = append(todo, f.addCard(t, api, 0, map[string]any{"title": title}))
+	}
+	f.addCard(t, api, 1, map[string]any{"title": "x"})
+	f.addCard(t, api, 1, map[string]any{"title": "y"})
+	move := func(query string, card Card, from, to, pos int, strict bool) (int, map[string]any) {
+		t.Helper()
+		body := map[string]any{"cardId": card.ID, "fromListId": f.lists[from].ID, "toListId": f.lists[to].ID, "toPos": pos}
+		if strict {
+			body["strict"] = true
+		}
+		var out map[string]any
+		return call(t, api, "POST", f.path("move")+query, body, &out), out
+	}
+
+	// Doing holds 2 cards: 0..2 are valid, 3 is past the end
+	if code, out := move("?strict=true", todo[0], 0, 1, 3, false); code != 409 || out["max"] != float64(2) {
+		t.Errorf("strict toPos 3 of 0..2: %d %v, want 409 with max 2", code, out)
+	}
+	if code, _ := move("", todo[0], 0, 1, -1, true); code != 409 {
+		t.Errorf(`"strict": true, toPos -1: status %d, want 409`, code)
+	}
+	if got := titles(f.get(t, api), 0); len(got) != 5 {
+		t.Errorf("refused moves changed the source: %v", got)
+	}
+	if code, _ := move("", todo[0], 0, 1, 2, true); code != 200 {
+		t.Errorf("strict toPos 2 (the end): status %d, want 200", code)
+	}
+	if got := titles(f.get(t, api), 1); !slices.Equal(got, []string{"x", "y", "a"}) {
+		t.Errorf("after the strict move: %v, want [x y a]", got)
+	}
+
+	// within one list the card leaves first: 4 cards, so 0..3
+	if code, _ := move("?strict=true", todo[1], 0, 0, 4, false); code != 409 {
+		t.Errorf("strict reorder to 4 of 0..3: status %d, want 409", code)
+	}
+	if code, _ := move("?strict=true", todo[1], 0, 0, 3, false); code != 200 {
+		t.Errorf("strict reorder to 3: status %d, want 200", code)
+	}
+
+	// lenient by default: out of range means the end
+	if code, _ := move("", todo[2], 0, 1, 99, false); code != 200 {
+		t.Errorf("lenient toPos 99: status %d, want 200", code)
+	}
+	if got := titles(f.get(t, api), 1); !slices.Equal(got, []string{"x", "y", "a", "c"}) {
+		t.Errorf("after the lenient move: %v, want c clamped to the end", got)
+	}
+}
+
+// ==== Labels ====
+
+// Label colors are checked the same way whether the label is defined on
+// its own or created by bulk labeling.
+func TestLabelColors(t *testing.T) {
+	api := newTestAPI(t, newTestStore(t, false, nil))
+	f := newFixture(t, api, "Paint", "Todo")
+	c := f.addCard(t, api, 0, map[string]any{"title": "tag me"})
+
+	for _, color := range []string{"banana", "#12", "#1234", "1e90ff"} {
+		if code := call(t, api, "POST", f.path("labels"), map[string]any{"name": "bad", "color": color}, nil); code != 400 {
+			t.Errorf("POST labels with color %q: status %d, want 400", color, code)
+		}
+		if code := call(t, api, "POST", f.path("cards", "label"), map[string]any{"cardIds": []ID{c.ID}, "label": map[string]any{"name": "bad", "color": color}}, nil); code != 400 {
+			t.Errorf("cards/label with color %q: status %d, want 400", color, code)
+		}
+	}
+	if b := f.get(t, api); len(b.Labels) != 0 {
+		t.Errorf("rejected labels were defined: %+v", b.Labels)
+	}
+
+	var lbl Label
+	mustCall(t, api, 201, "POST", f.path("labels"), map[string]any{"name": "bug", "color": "#f00"}, &lbl)
+	mustCall(t, api, 201, "POST", f.path("labels"), map[string]any{"name": "plain"}, nil)
+	mustCall(t, api, 200, "POST", f.path("cards", "label"), map[string]any{"cardIds": []ID{c.ID}, "label": map[string]any{"name": "idea", "color": "#1E90FF"}}, nil)
+	mustCall(t, api, 200, "POST", f.path("cards", "label"), map[string]any{"cardIds": []ID{c.ID}, "label": map[string]any{"id": lbl.ID}}, nil)
+	if b := f.get(t, api); len(b.Labels) != 3 || len(b.Lists[0].Cards[0].Labels) != 2 {
+		t.Errorf("after valid requests: labels %+v, card labels %v; want 3 and 2", b.Labels, b.Lists[0].Cards[0].Labels)
+	}
+}
+
+// ==== Concurrent inserts ====
+
+// Parallel creates aimed at the same spot all land, in some order, with
+// distinct positions and strictly increasing ranks. Run with -race.
+func TestConcurrentCardInserts(t *testing.T) {
+	const n = 20
+	for _, tc := range []struct {
+		name string
+		body map[string]any
+	}{
+		{"same toPos", map[string]any{"toPos": 0}},
+		{"same rank", map[string]any{"rank": 1.5}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			api := newTestAPI(t, newTestStore(t, false, nil))
+			f := newFixture(t, api, "Race", "Todo")
+			path := f.path("lists", string(f.lists[0].ID), "cards")
+			codes := make([]int, n)
+			var wg sync.WaitGroup
+			for i := range n {
+				body := map[string]any{"title": fmt.Sprintf("card %d", i)}
+				for k, v := range tc.body {
+					body[k] = v
+				}
+				data, _ := json.Marshal(body)
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					rec := httptest.NewRecorder()
+					api.ServeHTTP(rec, httptest.NewRequest("POST", path, bytes.NewReader(data)))
+					codes[i] = rec.Code
+				}()
+			}
+			wg.Wait()
+			for i, code := range codes {
+				if code != 201 {
+					t.Errorf("insert %d: status %d, want 201", i, code)
+				}
+			}
+
+			cards := f.get(t, api).Lists[0].Cards
+			if len(cards) != n {
+				t.Fatalf("%d cards in the list, want %d", len(cards), n)
+			}
+			seen := map[string]bool{}
+			for i, c := range cards {
+				if c.Position != i {
+					t.Errorf("card %d (%s) has position %d", i, c.Title, c.Position)
+				}
+				if i > 0 && c.Rank <= cards[i-1].Rank {
+					t.Errorf("rank %v at %d does not follow %v", c.Rank, i, cards[i-1].Rank)
+				}
+				seen[c.Title] = true
+			}
+			if len(seen) != n {
+				t.Errorf("%d distinct cards, want %d", len(seen), n)
+			}
+		})
+	}
+}
+
+// ==== Time zones ====
+
+// Due times keep their instant but are stored in UTC, whatever offset the
+// client sent.
+func TestDueStoredInUTC(t *testing.T) {
+	api := newTestAPI(t, newTestStore(t, false, nil))
+	f := newFixture(t, api, "Zones", "Todo")
+	want := time.Date(2026, time.November, 2, 3, 30, 0, 0, time.UTC)
+
+	type answer struct {
+		ID  ID     `json:"id"`
+		Due string `json:"due"` // as sent, offset included
+	}
+	var created answer
+	mustCall(t, api, 201, "POST", f.path("lists", string(f.lists[0].ID), "cards"), map[string]any{"title": "standup", "due": "2026-11-02T09:00:00+05:30"}, &created)
+	if created.Due != want.Format(time.RFC3339) {
+		t.Errorf("create answered due %s, want %s", created.Due, want.Format(time.RFC3339))
+	}
+	var updated answer
+	mustCall(t, api, 200, "PATCH", f.path("cards", string(created.ID)), map[string]any{"due": "2026-11-03T09:00:00+05:30"}, &updated)
+	if want := want.AddDate(0, 0, 1).Format(time.RFC3339); updated.Due != want {
+		t.Errorf("update answered due %s, want %s", updated.Due, want)
+	}
+	if c := f.get(t, api).Lists[0].Cards[0]; c.Due == nil || c.Due.Location() != time.UTC || !c.Due.Equal(want.AddDate(0, 0, 1)) {
+		t.Errorf("stored due %v, want %v in UTC", c.Due, want.AddDate(0, 0, 1))
+	}
+}
+
+// The agenda splits days at the client's midnight, given by ?tz or the
+// X-Timezone header, not the server's.
+func TestAgendaTimezone(t *testing.T) {
+	api := newTestAPI(t, newTestStore(t, false, nil))
+	f := newFixture(t, api, "Agenda", "Todo")
+	loc := time.FixedZone("+05:30", 5*3600+30*60)
+	now := time.Now().In(loc)
+	midnight := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, loc)
+	if time.Until(midnight) < 2*time.Minute {
+		t.Skip("too close to midnight in +05:30")
+	}
+	f.addCard(t, api, 0, map[string]any{"title": "before", "due": midnight.Add(-time.Minute)})
+	f.addCard(t, api, 0, map[string]any{"title": "after", "due": midnight.Add(time.Minute)})
+	tomorrow := "thisWeek"
+	if now.Weekday() == time.Sunday {
+		tomorrow = "later" // the week ends at Sunday midnight
+	}
+
+	bucketOf := func(req *http.Request) map[string]string {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		api.ServeHTTP(rec, req)
+		var buckets map[string][]struct {
+			Card Card `json:"card"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &buckets); rec.Code != 200 || err != nil {
+			t.Fatalf("GET %s: status %d: %s", req.URL, rec.Code, rec.Body)
+		}
+		out := map[string]string{}
+		for name, es := range buckets {
+			for _, e := range es {
+				out[e.Card.Title] = name
+			}
+		}
+		return out
+	}
+	header := httptest.NewRequest("GET", f.path("agenda"), nil)
+	header.Header.Set("X-Timezone", "+05:30")
+	for name, req := range map[string]*http.Request{
+		"X-Timezone": header,
+		"?tz":        httptest.NewRequest("GET", f.path("agenda")+"?tz="+url.QueryEscape("+05:30"), nil),
+	} {
+		if got := bucketOf(req); got["before"] != "today" || got["after"] != tomorrow {
+			t.Errorf("%s: buckets %v, want before in today and after in %s", name, got, tomorrow)
+		}
+	}
+	// Both are 18:29 and 18:31 UTC on the same day: one bucket in UTC.
+	if got := bucketOf(httptest.NewRequest("GET", f.path("agenda"), nil)); got["before"] != got["after"] {
+		t.Errorf("UTC: buckets %v, want both cards in the same one", got)
+	}
+	if code := call(t, api, "GET", f.path("agenda")+"?tz=Mars/Olympus", nil, nil); code != 400 {
+		t.Errorf("unknown zone: status %d, want 400", code)
+	}
+}
+
+// ==== Due date bounds ====
+
+func TestDueDateBounds(t *testing.T) {
+	open := newTestAPI(t, newTestStore(t, false, nil))
+	f := newFixture(t, open, "Anything goes", "Todo")
+	for _, due := range []time.Time{time.Unix(0, 0).UTC(), time.Date(3000, 1, 1, 0, 0, 0, 0, time.UTC)} {
+		if code := call(t, open, "POST", f.path("lists", string(f.lists[0].ID), "cards"), map[string]any{"title": "t", "due": due}, nil); code != 201 {
+			t.Errorf("without bounds, due %v: status %d, want 201", due, code)
+		}
+	}
+
+	api := newTestAPI(t, newTestStore(t, false, func(c *Config) { c.DueMinYear, c.DueMaxYears = 2000, 100 }))
+	f = newFixture(t, api, "Sane", "Todo")
+	create := f.path("lists", string(f.lists[0].ID), "cards")
+	card := f.addCard(t, api, 0, map[string]any{"title": "t"})
+	earliest := time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+	latest := time.Now().UTC().AddDate(100, 0, 0)
+	for _, tc := range []struct {
+		due  time.Time
+		want int
+	}{
+		{earliest, 201},
+		{earliest.Add(-time.Second), 400},
+		{time.Unix(0, 0).UTC(), 400},
+		{latest.Add(-time.Minute), 201},
+		{latest.Add(time.Hour), 400},
+	} {
+		var out map[string]any
+		code := call(t, api, "POST", create, map[string]any{"title": "t", "due": tc.due}, &out)
+		if code != tc.want {
+			t.Errorf("create with due %v: status %d, want %d", tc.due, code, tc.want)
+		}
+		if code == 400 && !strings.Contains(fmt.Sprint(out["error"]), "2000-01-01T00:00:00Z and ") {
+			t.Errorf("create with due %v: error %q, want the allowed range", tc.due, out["error"])
+		}
+		if tc.want == 201 {
+			tc.want = 200
+		}
+		if code := call(t, api, "PATCH", f.path("cards", string(card.ID)), map[string]any{"due": tc.due}, nil); code != tc.want {
+			t.Errorf("update to due %v: status %d, want %d", tc.due, code, tc.want)
+		}
+	}
+}
+
+// ==== Archived lists ====
+
+// Lists can't be archived, only their cards: an emptied list keeps taking
+// cards, whether created there or moved in.
+func TestArchivedCardsListStaysWritable(t *testing.T) {
+	api := newTestAPI(t, newTestStore(t, false, nil))
+	f := newFixture(t, api, "Shelf", "Todo", "Old")
+	c := f.addCard(t, api, 0, map[string]any{"title": "keep going"})
+	f.addCard(t, api, 1, map[string]any{"title": "stale"})
+	mustCall(t, api, 200, "POST", f.path("lists", string(f.lists[1].ID), "archiveAll"), nil, nil)
+
+	b := f.get(t, api)
+	if len(b.Lists) != 2 || len(b.Lists[1].Cards) != 0 || len(b.Archive) != 1 {
+		t.Fatalf("after archiveAll: %d lists, %d cards left in Old, %d archived; want the list kept and emptied", len(b.Lists), len(b.Lists[1].Cards), len(b.Archive))
+	}
+	f.addCard(t, api, 1, map[string]any{"title": "new"})
+	mustCall(t, api, 200, "POST", f.path("move"), map[string]any{"cardId": c.ID, "fromListId": f.lists[0].ID, "toListId": f.lists[1].ID, "toPos": 0}, nil)
+	if got := titles(f.get(t, api), 1); !slices.Equal(got, []string{"keep going", "new"}) {
+		t.Errorf("Old after create and move: %v, want [keep going new]", got)
+	}
+}
+
+// ==== Tracing ====
+
+// recordSpans installs an SDK tracer provider that keeps every ended span,
+// with W3C propagation, and puts the no-op defaults back afterwards.
+func recordSpans(t *testing.T) *tracetest.SpanRecorder {
+	t.Helper()
+	rec := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(rec)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() {
+		otel.SetTracerProvider(noop.NewTracerProvider())
+		otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator())
+	})
+	return rec
+}
+
+// spanNamed returns the last ended span called name.
+func spanNamed(t *testing.T, rec *tracetest.SpanRecorder, name string) sdktrace.ReadOnlySpan {
+	t.Helper()
+	spans := rec.Ended()
+	for i := len(spans) - 1; i >= 0; i-- {
+		if spans[i].Name() == name {
+			return spans[i]
+		}
+	}
+	var names []string
+	for _, sp := range spans {
+		names = append(names, sp.Name())
+	}
+	t.Fatalf("no span %q among %q", name, names)
+	return nil
+}
+
+func TestTraceRequests(t *testing.T) {
+	rec := recordSpans(t)
+	store := newTestStore(t, true, func(c *Config) { c.OTLPEndpoint = "http://collector.invalid/v1/traces" })
+	h := newRouter(store.cfg, store) // after the provider: otelhttp binds its tracer here
+	f := newFixture(t, h, "Traced")
+
+	const parent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	req := httptest.NewRequest("POST", f.path("lists"), strings.NewReader(`{"title":"Todo"}`))
+	req.Header.Set("traceparent", parent)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if w.Code != 201 {
+		t.Fatalf("POST lists: status %d: %s", w.Code, w.Body)
+	}
+
+	srv := spanNamed(t, rec, "POST /boards/{boardID}/lists")
+	if got := srv.SpanContext().TraceID().String(); got != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("server span trace %s, want the caller's", got)
+	}
+	if p := srv.Parent(); !p.IsRemote() || p.SpanID().String() != "00f067aa0ba902b7" {
+		t.Errorf("server span parent %s (remote %v), want the caller's span", p.SpanID(), p.IsRemote())
+	}
+	attrs := map[attribute.Key]attribute.Value{}
+	for _, kv := range srv.Attributes() {
+		attrs[kv.Key] = kv.Value
+	}
+	if got := attrs["http.route"].AsString(); got != "/boards/{boardID}/lists" {
+		t.Errorf("http.route %q, want the chi pattern", got)
+	}
+	if attrs["request.id"].AsString() == "" {
+		t.Errorf("server span has no request.id: %v", srv.Attributes())
+	}
+	if attrs["http.status_code"].AsInt64() != 201 && attrs["http.response.status_code"].AsInt64() != 201 {
+		t.Errorf("server span has no status code 201: %v", srv.Attributes())
+	}
+
+	save := spanNamed(t, rec, "store.save")
+	if save.SpanContext().TraceID() != srv.SpanContext().TraceID() || save.Parent().SpanID() != srv.SpanContext().SpanID() {
+		t.Errorf("store.save is not a child of the request span")
+	}
+
+	// No traceparent starts a fresh trace.
+	mustCall(t, h, 200, "GET", f.path(), nil, nil)
+	if got := spanNamed(t, rec, "GET /boards/{boardID}"); got.Parent().IsValid() || got.SpanContext().TraceID() == srv.SpanContext().TraceID() {
+		t.Errorf("untraced request joined trace %s", got.SpanContext().TraceID())
+	}
+}
+
+func TestTracingExport(t *testing.T) {
+	bodies := make(chan []byte, 10)
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if r.Method == "POST" && r.URL.Path == "/v1/traces" {
+			bodies <- body
+		}
+		w.Header().Set("Content-Type", r.Header.Get("Content-Type"))
+	}))
+	defer collector.Close()
+	t.Cleanup(func() {
+		otel.SetTracerProvider(noop.NewTracerProvider())
+		otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator())
+	})
+
+	cfg := DefaultConfig()
+	cfg.OTLPEndpoint = collector.URL + "/v1/traces"
+	cfg.ServiceName = "kanban-export-test"
+	shutdown, err := setupTracing(context.Background(), cfg)
+	if err != nil {
+		t.Fatalf("setupTracing: %v", err)
+	}
+	_, sp := startSpan(context.Background(), "store.save")
+	endSpan(sp, errors.New("disk full"))
+	if err := shutdown(context.Background()); err != nil {
+		t.Fatalf("shutdown: %v", err)
+	}
+	select {
+	case body := <-bodies:
+		// OTLP protobuf keeps strings as-is, so they can be looked for directly.
+		for _, want := range []string{"store.save", "kanban-export-test", "disk full"} {
+			if !bytes.Contains(body, []byte(want)) {
+				t.Errorf("exported batch lacks %q", want)
+			}
+		}
+	default:
+		t.Fatal("shutdown flushed nothing to the collector")
+	}
+}
@@ -0,0 +1,167 @@
+// Kanban Lite web UI: a thin client of the HTTP API, served at /app when
+// KANBAN_SERVE_UI=true. It works on the default store, not on workspaces.
+'use strict';
+
+const view = document.getElementById('view');
+const titleEl = document.getElementById('title');
+const statusEl = document.getElementById('status');
+
+// Numeric ids are nanosecond timestamps, too large for JavaScript numbers,
+// so they are read as strings and written back into request bodies unquoted.
+// UUID ids (KANBAN_ID_STRATEGY=uuid) are strings already.
+function parse(text) {
+  return JSON.parse(text.replace(/("(?:[^"\\]|\\.)*")|(-?\d{16,})/g, (m, str, big) => (str ? m : '"' + big + '"')));
+}
+
+function idJSON(id) {
+  return /^\d+$/.test(id) ? id : JSON.stringify(id);
+}
+
+async function api(method, path, body) {
+  const res = await fetch(path, { method, body, headers: body ? { 'Content-Type': 'application/json' } : {} });
+  const data = parse((await res.text()) || 'null');
+  if (!res.ok) throw new Error((data && data.error) || res.statusText);
+  return data;
+}
+
+function el(tag, props, ...children) {
+  const e = document.createElement(tag);
+  Object.assign(e, props);
+  e.append(...children);
+  return e;
+}
+
+function form(placeholder, onSubmit) {
+  const input = el('input', { placeholder, required: true });
+  const f = el('form', {}, input, el('button', { type: 'submit' }, 'Add'));
+  f.onsubmit = async (ev) => {
+    ev.preventDefault();
+    try {
+      await onSubmit(input.value.trim());
+      input.value = '';
+    } catch (err) {
+      status(err.message, true);
+    }
+  };
+  return f;
+}
+
+function status(text, error) {
+  statusEl.textContent = text;
+  statusEl.className = error ? 'error' : '';
+}
+
+// ---- boards ----
+
+async function showBoards() {
+  titleEl.textContent = '';
+  const boards = await api('GET', '/boards');
+  const grid = el('div', { className: 'boards' });
+  for (const b of boards) {
+    grid.append(el('a', { href: '#/b/' + (b.slug || b.id), className: b.protected ? 'locked' : '' }, b.title));
+  }
+  view.replaceChildren(grid, form('New board title', async (title) => {
+    const b = await api('POST', '/boards', JSON.stringify({ title }));
+    location.hash = '#/b/' + (b.slug || b.id);
+  }));
+}
+
+// ---- one board ----
+
+let board = null;
+let events = null;
+let reload = null;
+
+async function showBoard(ref) {
+  board = await api('GET', '/boards/' + encodeURIComponent(ref));
+  titleEl.textContent = board.title;
+  render();
+  events = new EventSource('/boards/' + board.id + '/events');
+  events.onopen = () => status('live');
+  events.onerror = () => status('reconnecting…', true);
+  // other viewers' changes: refetch, at most a few times a second
+  events.onmessage = () => {
+    clearTimeout(reload);
+    reload = setTimeout(async () => {
+      board = await api('GET', '/boards/' + board.id);
+      render();
+    }, 300);
+  };
+}
+
+function cardLabel(c) {
+  return c.number ? (board.prefix ? board.prefix + '-' : '#') + c.number : '';
+}
+
+function renderCard(c, list) {
+  const meta = [cardLabel(c)];
+  if (c.due) meta.push('due ' + new Date(c.due).toLocaleDateString());
+  if (c.assignees && c.assignees.length) meta.push(c.assignees.join(', '));
+  const e = el('div', { className: 'card', draggable: true }, el('div', {}, c.title), el('div', { className: 'meta' }, meta.filter(Boolean).join(' · ')));
+  e.ondragstart = (ev) => {
+    ev.dataTransfer.setData('text/plain', JSON.stringify({ cardId: c.id, fromListId: list.id }));
+    e.classList.add('dragging');
+  };
+  e.ondragend = () => e.classList.remove('dragging');
+  return e;
+}
+
+// dropIndex is the position among the other cards the pointer is above.
+function dropIndex(container, y) {
+  const others = [...container.querySelectorAll('.card:not(.dragging)')];
+  const i = others.findIndex((e) => y < e.getBoundingClientRect().top + e.offsetHeight / 2);
+  return i === -1 ? others.length : i;
+}
+
+function renderList(list) {
+  const cards = el('div', { className: 'cards' }, ...list.cards.map((c) => renderCard(c, list)));
+  cards.ondragover = (ev) => ev.preventDefault();
+  cards.ondrop = async (ev) => {
+    ev.preventDefault();
+    const drag = JSON.parse(ev.dataTransfer.getData('text/plain'));
+    const body = `{"cardId":${idJSON(drag.cardId)},"fromListId":${idJSON(drag.fromListId)},"toListId":${idJSON(list.id)},"toPos":${dropIndex(cards, ev.clientY)}}`;
+    try {
+      // the answer carries the affected lists in their new order
+      const res = await api('POST', '/boards/' + board.id + '/move', body);
+      for (const l of res.lists) {
+        const i = board.lists.findIndex((x) => x.id === l.id);
+        if (i !== -1) board.lists[i] = l;
+      }
+      render();
+    } catch (err) {
+      status(err.message, true);
+    }
+  };
+  return el('section', { className: 'list' }, el('h2', {}, list.title), cards, form('New card', async (title) => {
+    await api('POST', `/boards/${board.id}/lists/${list.id}/cards`, JSON.stringify({ title }));
+    board = await api('GET', '/boards/' + board.id);
+    render();
+  }));
+}
+
+function render() {
+  const lists = el('div', { className: 'lists' }, ...board.lists.map(renderList));
+  lists.append(el('section', { className: 'list' }, form('New list', async (title) => {
+    await api('POST', `/boards/${board.id}/lists`, JSON.stringify({ title }));
+    board = await api('GET', '/boards/' + board.id);
+    render();
+  })));
+  view.replaceChildren(lists);
+}
+
+// ---- routing ----
+
+async function route() {
+  if (events) events.close();
+  events = null;
+  status('');
+  const m = location.hash.match(/^#\/b\/(.+)$/);
+  try {
+    await (m ? showBoard(decodeURIComponent(m[1])) : showBoards());
+  } catch (err) {
+    view.replaceChildren(el('p', { className: 'error' }, err.message));
+  }
+}
+
+window.onhashchange = route;
+route();